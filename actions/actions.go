@@ -0,0 +1,356 @@
+// Perspective: Graphing library for quality control in event-driven systems
+
+// Copyright (C) 2016 Christian Paro <christian.paro@gmail.com>,
+//                                   <cparo@digitalocean.com>
+
+// This program is free software: you can redistribute it and/or modify it under
+// the terms of the GNU General Public License version 2 as published by the
+// Free Software Foundation.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+
+// You should have received a copy of the GNU General Public License along with
+// this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package actions holds the registry of actions (visualizations and reports)
+// which can be taken on a feed, and of the parameters they take, shared by the
+// command-line and HTTP front ends so each is available through both.
+// Visualizations are those registered in the perspective package.
+package actions
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/cparo/perspective"
+	"github.com/cparo/perspective/feeds"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FeedParams are the parameters taken by all actions to select the events from
+// a feed which they act on.
+var FeedParams = []perspective.Param{
+	{
+		Name:    "status-filter",
+		Type:    perspective.IntParam,
+		Default: "-1",
+		Usage:   "Bitmask for event statuses; LSB are {done,failed,running}."},
+	{
+		Name:    "event-type",
+		Alias:   "event-type-id",
+		Type:    perspective.IntParam,
+		Default: "-1",
+		Usage:   "Event type ID (or name) to filter for."},
+	{
+		Name:    "region",
+		Alias:   "region-id",
+		Type:    perspective.IntParam,
+		Default: "-1",
+		Usage:   "Event region ID (or name) to filter for."},
+	perspective.MinTimeParam,
+	perspective.MaxTimeParam,
+	{
+		Name:    "lookback",
+		Type:    perspective.IntParam,
+		Default: "0",
+		Usage: "Number of events to scan, from end of log (or 0 for all " +
+			"events)."},
+}
+
+// Report describes an action which writes out a report on the events in a
+// feed, rather than a visualization of them.
+type Report struct {
+	Usage       string                 // Description, for help
+	Params      []perspective.Param    // Parameters besides FeedParams
+	Check       perspective.ParamCheck // Validation across parameters
+	ContentType string                 // MIME type of the report
+
+	// Writes the report on the events selected from the feed, giving up with
+	// the context's error if the context is done before the scan of the feed
+	// is complete (where the report scans ahead of writing).
+	Write func(
+		context.Context,
+		*feeds.Feed,
+		perspective.Params,
+		io.Writer) error
+}
+
+// Reports maps the names of report actions to their descriptions.
+var Reports = make(map[string]*Report)
+
+func init() {
+
+	cdf := perspective.LookupVisualizer("vis-cdf")
+	Reports["cdf-data"] = &Report{
+		"Cumulative distributions of run times, as plotted by vis-cdf, as " +
+			"JSON.",
+		cdf.Params,
+		func(p perspective.Params) *perspective.ParamError {
+			if err := perspective.CheckTimeRange(p); err != nil {
+				return err
+			}
+			return cdf.Check(p)
+		},
+		"application/json",
+		func(
+			ctx context.Context,
+			feed *feeds.Feed,
+			p perspective.Params,
+			out io.Writer) error {
+
+			v := cdf.New(p).(perspective.CDFVisualizer)
+			err := feeds.RecordBinLog(
+				ctx,
+				feed,
+				[]feeds.Layer{{Filter: Filter(p), Visualizer: v}})
+			if err != nil {
+				return err
+			}
+			return json.NewEncoder(out).Encode(v.Curves())
+		}}
+
+	Reports["event-data"] = &Report{
+		"Binary dump of the events, as 32-bit values (with times in " +
+			"seconds) or 64-bit values (with times in nanoseconds).",
+		[]perspective.Param{{
+			Name:    "dump-bits",
+			Type:    perspective.ChoiceParam,
+			Default: "32",
+			Choices: []string{"32", "64"},
+			Usage:   "Width of values in event-data dumps: 32 or 64."}},
+		perspective.CheckTimeRange,
+		"application/octet-stream",
+		func(
+			ctx context.Context,
+			feed *feeds.Feed,
+			p perspective.Params,
+			out io.Writer) error {
+
+			return feeds.DumpEventData(
+				ctx,
+				feed,
+				p.Time("min-time"),
+				p.Time("max-time"),
+				p.Int("event-type"),
+				p.Int("region"),
+				p.Int("status-filter"),
+				p.String("dump-bits") == "64",
+				out)
+		}}
+
+	Reports["stalled-events"] = &Report{
+		"Listing of in-progress events progressing too slowly, as JSON.",
+		[]perspective.Param{perspective.MinProgressRateParam},
+		perspective.CheckTimeRange,
+		"application/json",
+		func(
+			ctx context.Context,
+			feed *feeds.Feed,
+			p perspective.Params,
+			out io.Writer) error {
+
+			return feeds.ListStalledEvents(
+				ctx,
+				feed,
+				p.Time("min-time"),
+				p.Time("max-time"),
+				p.Int("event-type"),
+				p.Int("region"),
+				p.Float("min-progress-rate"),
+				out)
+		}}
+
+	Reports["success-rate"] = &Report{
+		"Percentage of completed events which succeeded.",
+		nil,
+		perspective.CheckTimeRange,
+		"text/plain; charset=utf-8",
+		func(
+			ctx context.Context,
+			feed *feeds.Feed,
+			p perspective.Params,
+			out io.Writer) error {
+
+			return feeds.GetSuccessRate(
+				ctx,
+				feed,
+				p.Time("min-time"),
+				p.Time("max-time"),
+				p.Int("event-type"),
+				p.Int("region"),
+				out)
+		}}
+}
+
+// Names returns the names of all actions, in sorted order.
+func Names() []string {
+	names := perspective.VisualizerNames()
+	for name := range Reports {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Returns the description of the named action, the parameters it takes
+// (besides those for selecting events from the feed), and its validation
+// across parameters, if any.
+func describe(
+	action string) (string, []perspective.Param, perspective.ParamCheck) {
+
+	if spec := perspective.LookupVisualizer(action); spec != nil {
+		return spec.Usage, spec.Params, spec.Check
+	}
+	if report, exists := Reports[action]; exists {
+		return report.Usage, report.Params, report.Check
+	}
+	return "", nil, nil
+}
+
+// Params returns the parameters taken by the named action, including those for
+// selecting events from the feed, or nil if there is no such action.
+func Params(action string) []perspective.Param {
+	if !Exists(action) {
+		return nil
+	}
+	_, params, _ := describe(action)
+	return merge(FeedParams, params)
+}
+
+// Exists reports whether there is an action with the given name.
+func Exists(action string) bool {
+	_, isReport := Reports[action]
+	return isReport || perspective.LookupVisualizer(action) != nil
+}
+
+// AllParams returns the parameters taken by any action.
+func AllParams() []perspective.Param {
+	var params []perspective.Param
+	for _, name := range Names() {
+		params = merge(params, Params(name))
+	}
+	return params
+}
+
+// Returns the given parameters followed by the additional ones, leaving out
+// any of the additional ones with the same name as one already given.
+func merge(
+	params []perspective.Param,
+	additional []perspective.Param) []perspective.Param {
+
+	merged := append([]perspective.Param{}, params...)
+	for _, a := range additional {
+		exists := false
+		for _, p := range params {
+			exists = exists || p.Name == a.Name
+		}
+		if !exists {
+			merged = append(merged, a)
+		}
+	}
+	return merged
+}
+
+// Parse parses values for the parameters of the named action, as ParseParams
+// does, and then checks them against each other. Rejected values are passed to
+// the malformed function.
+func Parse(
+	action string,
+	lookup func(name string) string,
+	malformed func(err *perspective.ParamError)) perspective.Params {
+
+	p := perspective.ParseParams(Params(action), lookup, malformed)
+	if _, _, check := describe(action); check != nil {
+		if err := check(p); err != nil {
+			malformed(err)
+		}
+	}
+	return p
+}
+
+// Named returns a lookup function for parameter values from the given one, with
+// event types and regions given by name translated into their codes by the
+// given names. Names with no code are left as they are, to be rejected.
+func Named(
+	lookup func(name string) string,
+	names *feeds.Metadata) func(name string) string {
+
+	return func(name string) string {
+		value := lookup(name)
+		var codes feeds.Names
+		switch name {
+		case "event-type", "event-type-id":
+			codes = names.Types
+		case "region", "region-id":
+			codes = names.Regions
+		default:
+			return value
+		}
+		if code, exists := codes.Code(value); exists {
+			return strconv.Itoa(int(code))
+		}
+		return value
+	}
+}
+
+// Filter returns the filter for the events selected by the given parameters.
+func Filter(p perspective.Params) feeds.Filter {
+	return feeds.Filter{
+		MinTime: p.Time("min-time"),
+		MaxTime: p.Time("max-time"),
+		Type:    p.Int("event-type"),
+		Region:  p.Int("region"),
+		Status:  p.Int("status-filter")}
+}
+
+// Lookback returns the number of events, from the end of the feed, to be read
+// for the given parameters (with 0 for all events).
+func Lookback(p perspective.Params) int64 {
+	// All lookback values should be positive.
+	lookback := int64(p.Int("lookback"))
+	if lookback < 0 {
+		return -lookback
+	}
+	return lookback
+}
+
+// Help writes a description of the named action and the parameters it takes,
+// or a list of all actions if no action is named.
+func Help(out io.Writer, action string) error {
+
+	if action == "" {
+		fmt.Fprintln(out, "Actions:")
+		for _, name := range Names() {
+			usage, _, _ := describe(name)
+			fmt.Fprintf(out, "  %s\n    \t%s\n", name, usage)
+		}
+		return nil
+	}
+
+	if !Exists(action) {
+		return fmt.Errorf("unrecognized action: \"%s\"", action)
+	}
+	usage, _, _ := describe(action)
+	fmt.Fprintf(out, "%s: %s\n\nParameters:\n", action, usage)
+	for _, p := range Params(action) {
+		kind := p.Type.String()
+		if p.Type == perspective.ChoiceParam {
+			kind = strings.Join(p.Choices, "|")
+		}
+		fmt.Fprintf(out, "  %s %s", p.Name, kind)
+		if p.Default != "" {
+			fmt.Fprintf(out, " (default %s)", p.Default)
+		}
+		if p.Alias != "" {
+			fmt.Fprintf(out, " (alias %s)", p.Alias)
+		}
+		fmt.Fprintf(out, "\n    \t%s\n", p.Usage)
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+// Perspective: Graphing library for quality control in event-driven systems
+
+// Copyright (C) 2016 Christian Paro <christian.paro@gmail.com>,
+//                                   <cparo@digitalocean.com>
+
+// This program is free software: you can redistribute it and/or modify it under
+// the terms of the GNU General Public License version 2 as published by the
+// Free Software Foundation.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+
+// You should have received a copy of the GNU General Public License along with
+// this program. If not, see <http://www.gnu.org/licenses/>.
+
+package actions
+
+import (
+	"bytes"
+	"context"
+	"github.com/cparo/perspective"
+	"github.com/cparo/perspective/feeds"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Returns a lookup function for the given parameter values.
+func lookup(values map[string]string) func(string) string {
+	return func(name string) string {
+		return values[name]
+	}
+}
+
+// Returns a handler for rejected parameter values which fails the test.
+func reject(t *testing.T) func(*perspective.ParamError) {
+	return func(err *perspective.ParamError) {
+		t.Error(err)
+	}
+}
+
+func testFeed() *feeds.Feed {
+	s := int64(time.Second)
+	return feeds.NewFeed64(
+		[]perspective.EventData64{
+			{ID: 1, Start: 10 * s, Run: 5 * s},
+			{ID: 2, Start: 20 * s, Run: 50 * s, Status: 1},
+			{ID: 3, Start: 30 * s, Run: 500 * s, Status: -1, Progress: 1}},
+		s)
+}
+
+var testValues = map[string]string{"min-time": "0", "max-time": "600"}
+
+func TestParseFeedParams(t *testing.T) {
+	p := Parse(
+		"vis-scatter",
+		lookup(map[string]string{
+			"event-type-id": "3",
+			"region":        "2",
+			"min-time":      "1470659696",
+			"lookback":      "-100"}),
+		reject(t))
+	f := Filter(p)
+	if f.Type != 3 || f.Region != 2 || f.Status != -1 {
+		t.Errorf("Got filter %+v", f)
+	}
+	if f.MinTime != 1470659696*int64(time.Second) || f.MaxTime <= f.MinTime {
+		t.Errorf("Got time range [%d, %d]", f.MinTime, f.MaxTime)
+	}
+	if Lookback(p) != 100 {
+		t.Errorf("Got lookback %d", Lookback(p))
+	}
+}
+
+// Event types and regions may be given by name, with unknown names left to be
+// rejected.
+func TestParseNamed(t *testing.T) {
+	names := &feeds.Metadata{
+		Types:   feeds.Names{7: "snapshot"},
+		Regions: feeds.Names{3: "nyc3"}}
+	values := map[string]string{"event-type-id": "snapshot", "region": "nyc3"}
+	p := Parse("vis-scatter", Named(lookup(values), names), reject(t))
+	if f := Filter(p); f.Type != 7 || f.Region != 3 {
+		t.Errorf("Got filter %+v", f)
+	}
+
+	var rejected []*perspective.ParamError
+	Parse(
+		"vis-scatter",
+		Named(lookup(map[string]string{"region": "ams2"}), names),
+		func(err *perspective.ParamError) {
+			rejected = append(rejected, err)
+		})
+	if len(rejected) != 1 || rejected[0].Name != "region" {
+		t.Errorf("Unknown region name rejected as %v", rejected)
+	}
+}
+
+func TestParseChecks(t *testing.T) {
+	cases := []struct {
+		action   string
+		values   map[string]string
+		rejected string
+	}{
+		{"vis-histogram", map[string]string{"run-time-base": "1"},
+			"run-time-base"},
+		{"vis-histogram", map[string]string{"run-time-scale": "0"},
+			"run-time-scale"},
+		{"vis-histogram", map[string]string{"run-time-scale": "-4"},
+			"run-time-scale"},
+		{"vis-scatter", map[string]string{"min-time": "60", "max-time": "60"},
+			"min-time"},
+		{"success-rate", map[string]string{"min-time": "-1h", "max-time": "0"},
+			"min-time"},
+		{"vis-scatter", map[string]string{"width": "4096", "height": "4096"},
+			"width"},
+		{"vis-heatmap", map[string]string{"width": "100000"}, "width"},
+		{"vis-heatmap", map[string]string{"width": "4096", "height": "2048"},
+			""},
+	}
+	for _, c := range cases {
+		var rejected []string
+		Parse(
+			c.action,
+			lookup(c.values),
+			func(err *perspective.ParamError) {
+				rejected = append(rejected, err.Name)
+			})
+		if c.rejected == "" && len(rejected) > 0 ||
+			c.rejected != "" && (len(rejected) != 1 || rejected[0] != c.rejected) {
+			t.Errorf("%s %v: rejected %v, expected [%s]",
+				c.action, c.values, rejected, c.rejected)
+		}
+	}
+}
+
+func TestAllParams(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, p := range AllParams() {
+		if seen[p.Name] {
+			t.Errorf("Parameter %s listed twice", p.Name)
+		}
+		seen[p.Name] = true
+	}
+	for _, name := range []string{"status-filter", "dump-bits", "survival"} {
+		if !seen[name] {
+			t.Errorf("Parameter %s missing", name)
+		}
+	}
+}
+
+func TestHelp(t *testing.T) {
+	var out bytes.Buffer
+	if err := Help(&out, "vis-scatter"); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"width int (default 256)",
+		"jitter random|seeded|none (default random)",
+		"event-type int (default -1) (alias event-type-id)"} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("Help lacks \"%s\":\n%s", expected, out.String())
+		}
+	}
+	if err := Help(&out, "vis-nothing"); err == nil {
+		t.Error("Help for an unrecognized action should have failed")
+	}
+}
+
+func TestReports(t *testing.T) {
+	for name, report := range Reports {
+		var out bytes.Buffer
+		p := Parse(name, lookup(testValues), reject(t))
+		err := report.Write(context.Background(), testFeed(), p, &out)
+		if err != nil {
+			t.Errorf("%s failed: %v", name, err)
+		} else if out.Len() == 0 {
+			t.Errorf("%s wrote nothing", name)
+		}
+	}
+}
+
+func TestVisualizers(t *testing.T) {
+	for _, name := range perspective.VisualizerNames() {
+		var out bytes.Buffer
+		p := Parse(name, lookup(testValues), reject(t))
+		f := Filter(p)
+		err := feeds.GeneratePNGFromBinLog(
+			context.Background(),
+			testFeed(),
+			f.MinTime,
+			f.MaxTime,
+			f.Type,
+			f.Region,
+			f.Status,
+			perspective.LookupVisualizer(name).New(p),
+			&out)
+		if err != nil {
+			t.Errorf("%s failed: %v", name, err)
+		} else if out.Len() == 0 {
+			t.Errorf("%s wrote nothing", name)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+// Perspective: Graphing library for quality control in event-driven systems
+
+// Copyright (C) 2016 Christian Paro <christian.paro@gmail.com>,
+//                                   <cparo@digitalocean.com>
+
+// This program is free software: you can redistribute it and/or modify it under
+// the terms of the GNU General Public License version 2 as published by the
+// Free Software Foundation.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+
+// You should have received a copy of the GNU General Public License along with
+// this program. If not, see <http://www.gnu.org/licenses/>.
+
+package perspective
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"math"
+)
+
+// Minimum spacing, in pixels, between grid lines on a linear run-time axis.
+const minLinearGridSpacing = 16
+
+// Minimum spacing, in pixels, between grid lines drawn along any run-time axis.
+// Grid lines are left out entirely on an axis fitted so tightly that they would
+// fall closer together than this.
+const minGridStep = 1
+
+// Color for indicators of events clipped at the bounds of a run-time axis.
+var clipColor = color.RGBA{191, 127, 0, opaque}
+
+// RunTimeAxis describes the mapping of event run times to pixel offsets along
+// the run-time axis of a visualization. Run times below Min (if it is set) are
+// pinned to the origin of the axis, as are those above Max (if it is set) to
+// its far end, and visualizations mark the bounds at which such clipping has
+// occurred. With no Min, the origin lies at one second on a logarithmic axis
+// (or zero on a linear one), and shorter run times are left where the original
+// mapping put them: at negative offsets, outside the plot.
+type RunTimeAxis struct {
+	Scale float64 // Pixels per Base-fold (or per second, if linear) increase.
+	Base  float64 // Logarithm base, or 0 for a linear axis.
+	Min   float64 // Run time at the origin of the axis, or 0 for none.
+	Max   float64 // Run time beyond which events are clipped, or 0 for none.
+}
+
+// NewLogAxis returns a logarithmic run-time axis with the specified scale (in
+// pixels per base-fold increase in run time) and bounds (in seconds). A scale of
+// zero fits the bounds to the length of the axis.
+func NewLogAxis(
+	scale float64,
+	base float64,
+	min float64,
+	max float64) RunTimeAxis {
+
+	return RunTimeAxis{scale, base, min, max}
+}
+
+// NewLinearAxis returns a linear run-time axis with the specified scale (in
+// pixels per second of run time) and bounds (in seconds). A scale of zero fits
+// the bounds to the length of the axis.
+func NewLinearAxis(scale float64, min float64, max float64) RunTimeAxis {
+	return RunTimeAxis{scale, 0, min, max}
+}
+
+// NewLog2Axis returns the axis originally used by all visualizations, with run
+// times doubling over every yLog2 pixels from an origin of one second.
+func NewLog2Axis(yLog2 float64) RunTimeAxis {
+	return RunTimeAxis{yLog2, 2, 0, 0}
+}
+
+// Validate returns an error describing the problem with the axis, if it does
+// not describe a usable mapping of run times.
+func (a RunTimeAxis) Validate() error {
+	_, err := a.validate()
+	return err
+}
+
+// Returns an error describing the problem with the axis, if it does not
+// describe a usable mapping of run times, along with the name of the field of
+// the axis at fault.
+func (a RunTimeAxis) validate() (string, error) {
+	if a.Base != 0 && a.Base <= 1 {
+		return "Base", errors.New("run-time axis base must be greater than one")
+	}
+	if a.Min < 0 {
+		return "Min", errors.New("run-time axis minimum must not be negative")
+	}
+	if a.Min != 0 && a.Min < 1e-9 {
+		return "Min", errors.New("run-time axis minimum must be zero or at " +
+			"least one nanosecond, the resolution of event run times")
+	}
+	if a.Max != 0 && a.Max <= a.origin() {
+		return "Max", errors.New("run-time axis maximum must exceed its " +
+			"minimum (or one second, on a logarithmic axis with none)")
+	}
+	if !(a.Scale >= 0) || math.IsInf(a.Scale, 1) ||
+		a.Scale == 0 && a.Max == 0 {
+		return "Scale", errors.New("run-time axis scale must be positive, " +
+			"or zero with a maximum run time to fit the axis to its bounds")
+	}
+	if a.Base != 0 && a.Scale != 0 && a.Scale < minGridStep {
+		return "Scale", errors.New("logarithmic run-time axis scale must be " +
+			"at least one pixel per base-fold increase in run time")
+	}
+	return "", nil
+}
+
+// Returns a copy of the axis with its scale fitted to the given length in
+// pixels, if no explicit scale was given.
+func (a RunTimeAxis) fitted(length int) RunTimeAxis {
+	if a.Scale <= 0 && a.Max > a.origin() {
+		a.Scale = float64(length) / a.span(a.Max)
+	}
+	return a
+}
+
+// Returns the run time at the origin of the axis.
+func (a *RunTimeAxis) origin() float64 {
+	if a.Min == 0 && a.Base > 0 {
+		return 1
+	}
+	return a.Min
+}
+
+// Returns the unscaled offset of the given run time from the axis origin.
+func (a *RunTimeAxis) span(t float64) float64 {
+	if a.Base > 0 {
+		return math.Log(t/a.origin()) / math.Log(a.Base)
+	}
+	return t - a.origin()
+}
+
+// Returns the offset in pixels from the axis origin at which the given run time
+// should be plotted, along with -1 or 1 if it was pinned to the lower or upper
+// bound of the axis (or 0 if it lies within them). With no minimum set, run
+// times below the origin have negative offsets, or an offset of -Inf if they
+// are not positive on a logarithmic axis.
+func (a *RunTimeAxis) offset(t float64) (float64, int) {
+	if a.Min > 0 && t < a.Min {
+		return 0, -1
+	}
+	if a.Max > 0 && t > a.Max {
+		return a.Scale * a.span(a.Max), 1
+	}
+	if a.Base > 0 && t <= 0 {
+		return math.Inf(-1), 0
+	}
+	return a.Scale * a.span(t), 0
+}
+
+// Returns the offset in pixels from the axis origin at which the given run time
+// should be counted, as for offset, but with run times below the origin of an
+// axis with no minimum set floored to the origin (without being counted as
+// clipped), as the original mapping did for visualizations which bin run times.
+func (a *RunTimeAxis) flooredOffset(t float64) (float64, int) {
+	offset, clip := a.offset(t)
+	return math.Max(0, offset), clip
+}
+
+// Returns the run time plotted at the given offset in pixels from the axis
+// origin, as the inverse of offset for run times within the axis bounds.
+func (a *RunTimeAxis) at(offset float64) float64 {
+	if a.Base > 0 {
+		return a.origin() * math.Pow(a.Base, offset/a.Scale)
+	}
+	return a.origin() + offset/a.Scale
+}
+
+// Returns the spacing in pixels between grid lines along the axis, which fall
+// on each Base-fold increase in run time for a logarithmic axis, or on the
+// smallest round number of seconds which leaves some room between lines for a
+// linear axis. Visualizations draw no grid lines if the spacing is less than
+// minGridStep.
+func (a *RunTimeAxis) gridStep() float64 {
+	if a.Base > 0 {
+		return a.Scale
+	}
+	raw := minLinearGridSpacing / a.Scale
+	magnitude := math.Pow(10, math.Floor(math.Log10(raw)))
+	for _, m := range []float64{1, 2, 5} {
+		if m*magnitude >= raw {
+			return m * magnitude * a.Scale
+		}
+	}
+	return 10 * magnitude * a.Scale
+}
+
+// Counts of events pinned to the lower and upper bounds of a run-time axis, so
+// rendered visualizations can indicate where clipping has occurred.
+type axisClips struct {
+	lo int
+	hi int
+}
+
+func (c *axisClips) count(clip int) {
+	if clip < 0 {
+		c.lo++
+	} else if clip > 0 {
+		c.hi++
+	}
+}
+
+func (c *axisClips) merge(o *axisClips) {
+	c.lo += o.lo
+	c.hi += o.hi
+}
+
+// Utility function to draw a dashed vertical line at the specified x position
+// to indicate that events have been clipped there.
+func drawXClipLine(vis *image.RGBA, x int) {
+	h := vis.Bounds().Max.Y
+	for y := 0; y < h; y++ {
+		if y%4 < 2 {
+			vis.Set(x, y, clipColor)
+		}
+	}
+}
+
+// Utility function to draw a dashed horizontal line at the specified y position
+// to indicate that events have been clipped there.
+func drawYClipLine(vis *image.RGBA, y int) {
+	w := vis.Bounds().Max.X
+	for x := 0; x < w; x++ {
+		if x%4 < 2 {
+			vis.Set(x, y, clipColor)
+		}
+	}
+}
+
+// Utility function to draw a dashed circle at the specified radius from the
+// center of a polar visualization to indicate that events have been clipped
+// there.
+func drawPolarClipCircle(vis *image.RGBA, r float64) {
+	x0 := vis.Bounds().Max.X / 2
+	y0 := vis.Bounds().Max.Y / 2
+	res := math.Max(2*math.Pi*r, 8)
+	ϕΔ := 2 * math.Pi / res
+	for i := 0.0; i < res; i++ {
+		if int(i)%4 < 2 {
+			ϕ := i * ϕΔ
+			vis.Set(x0+int(r*math.Cos(ϕ)), y0+int(r*math.Sin(ϕ)), clipColor)
+		}
+	}
+}
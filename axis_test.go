@@ -0,0 +1,117 @@
+// Perspective: Graphing library for quality control in event-driven systems
+
+// Copyright (C) 2016 Christian Paro <christian.paro@gmail.com>,
+//                                   <cparo@digitalocean.com>
+
+// This program is free software: you can redistribute it and/or modify it under
+// the terms of the GNU General Public License version 2 as published by the
+// Free Software Foundation.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+
+// You should have received a copy of the GNU General Public License along with
+// this program. If not, see <http://www.gnu.org/licenses/>.
+
+package perspective
+
+import (
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestLog2AxisMatchesOriginalMapping(t *testing.T) {
+	axis := NewLog2Axis(16)
+	for _, run := range []float64{1.5, 2, 60, 3600} {
+		offset, clip := axis.offset(run)
+		if clip != 0 || math.Abs(offset-16*math.Log2(run)) > 1e-9 {
+			t.Errorf("Run time %f mapped to %f (clip %d)", run, offset, clip)
+		}
+	}
+	for _, run := range []float64{0.5, 0.001} {
+		offset, clip := axis.offset(run)
+		if clip != 0 || math.Abs(offset-16*math.Log2(run)) > 1e-9 {
+			t.Errorf("Sub-second run time %f mapped to %f (clip %d)",
+				run, offset, clip)
+		}
+		if floored, clip := axis.flooredOffset(run); floored != 0 || clip != 0 {
+			t.Errorf("Sub-second run time %f floored to %f (clip %d)",
+				run, floored, clip)
+		}
+	}
+	if offset, clip := axis.offset(0); !math.IsInf(offset, -1) || clip != 0 {
+		t.Errorf("Zero run time mapped to %f (clip %d)", offset, clip)
+	}
+
+	// Run times are only clipped below an explicit minimum.
+	bounded := NewLogAxis(16, 2, 1, 0)
+	if offset, clip := bounded.offset(0.5); offset != 0 || clip != -1 {
+		t.Errorf("Run time below minimum mapped to %f (clip %d)", offset, clip)
+	}
+	if offset, clip := bounded.offset(1); offset != 0 || clip != 0 {
+		t.Errorf("Run time at minimum mapped to %f (clip %d)", offset, clip)
+	}
+}
+
+func TestAxisClipsAndFits(t *testing.T) {
+	axis := NewLogAxis(0, 10, 0.1, 1000).fitted(200)
+	if axis.Scale != 50 {
+		t.Errorf("Fitted scale is %f, expected 50", axis.Scale)
+	}
+	if offset, clip := axis.offset(5000); offset != 200 || clip != 1 {
+		t.Errorf("Clipped run time mapped to %f (clip %d)", offset, clip)
+	}
+	linear := NewLinearAxis(0, 600, 1200).fitted(300)
+	if offset, clip := linear.offset(900); offset != 150 || clip != 0 {
+		t.Errorf("Linear run time mapped to %f (clip %d)", offset, clip)
+	}
+	if step := linear.gridStep(); step != 25 {
+		t.Errorf("Linear grid step is %f pixels, expected 25", step)
+	}
+}
+
+// A log axis fitted to bounds spanning more base-fold increases than it has
+// pixels puts grid lines less than a pixel apart, so none should be drawn.
+func TestAxisSubPixelGrid(t *testing.T) {
+	axis := NewLogAxis(0, 2, 1e-9, 1e300)
+	if err := axis.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	v := NewScatter(256, 128, 32, testA, testΩ, axis, 1, 0, JitterNone)
+	vis := toRGBA(v.Render())
+	if c := vis.RGBAAt(0, 64); c != (color.RGBA{32, 32, 32, opaque}) {
+		t.Errorf("Grid drawn on sub-pixel steps: %v", c)
+	}
+}
+
+func TestAxisValidate(t *testing.T) {
+	valid := []RunTimeAxis{
+		NewLog2Axis(16),
+		NewLogAxis(0, 10, 0.1, 1000),
+		NewLogAxis(0, 10, 0, 1000),
+		NewLinearAxis(1, 0, 0)}
+	for _, axis := range valid {
+		if err := axis.Validate(); err != nil {
+			t.Errorf("%+v: %v", axis, err)
+		}
+	}
+	invalid := []RunTimeAxis{
+		NewLogAxis(16, 1, 1, 0),
+		NewLogAxis(16, 2, -1, 0),
+		NewLogAxis(0, 2, 0, 0.5),
+		NewLinearAxis(1, 10, 5),
+		NewLogAxis(16, 2, 1e-320, 0),
+		NewLinearAxis(0, 0, 0),
+		NewLinearAxis(-1, 0, 0),
+		NewLinearAxis(math.NaN(), 0, 0),
+		NewLogAxis(0.00001, 2, 0, 0),
+		NewLogAxis(math.Inf(1), 2, 0, 0)}
+	for _, axis := range invalid {
+		if axis.Validate() == nil {
+			t.Errorf("%+v: accepted invalid axis", axis)
+		}
+	}
+}
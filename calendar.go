@@ -0,0 +1,306 @@
+// Perspective: Graphing library for quality control in event-driven systems
+
+// Copyright (C) 2016 Christian Paro <christian.paro@gmail.com>,
+//                                   <cparo@digitalocean.com>
+
+// This program is free software: you can redistribute it and/or modify it under
+// the terms of the GNU General Public License version 2 as published by the
+// Free Software Foundation.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+
+// You should have received a copy of the GNU General Public License along with
+// this program. If not, see <http://www.gnu.org/licenses/>.
+
+package perspective
+
+import (
+	"fmt"
+	"image"
+	"time"
+)
+
+// CalendarLayout selects the arrangement of cells on a calendar heatmap.
+type CalendarLayout int
+
+const (
+	// CalendarDayHour lays out a column for each day, with a row for each hour
+	// of the day from midnight at the top.
+	CalendarDayHour CalendarLayout = iota
+	// CalendarWeekWeekday lays out a column for each week, with a row for each
+	// day of the week from Monday at the top.
+	CalendarWeekWeekday
+)
+
+var calendarLayoutNames = map[CalendarLayout]string{
+	CalendarDayHour:     "day-hour",
+	CalendarWeekWeekday: "week-weekday",
+}
+
+// ParseCalendarLayout returns the calendar layout with the given name
+// ("day-hour" or "week-weekday").
+func ParseCalendarLayout(name string) (CalendarLayout, error) {
+	for l, n := range calendarLayoutNames {
+		if n == name {
+			return l, nil
+		}
+	}
+	return CalendarDayHour, fmt.Errorf(
+		"unrecognized calendar layout: \"%s\"", name)
+}
+
+func (l CalendarLayout) String() string {
+	return calendarLayoutNames[l]
+}
+
+// CalendarValue selects the value by which the cells of a calendar heatmap are
+// colored.
+type CalendarValue int
+
+const (
+	// CalendarSuccessRate colors cells by the rate of successful completions
+	// among the completed events in them, from dark for a 0% success rate to
+	// bright for 100%.
+	CalendarSuccessRate CalendarValue = iota
+	// CalendarCount colors cells by the number of events in them.
+	CalendarCount
+)
+
+var calendarValueNames = map[CalendarValue]string{
+	CalendarSuccessRate: "success-rate",
+	CalendarCount:       "count",
+}
+
+// ParseCalendarValue returns the calendar value with the given name
+// ("success-rate" or "count").
+func ParseCalendarValue(name string) (CalendarValue, error) {
+	for c, n := range calendarValueNames {
+		if n == name {
+			return c, nil
+		}
+	}
+	return CalendarSuccessRate, fmt.Errorf(
+		"unrecognized calendar value: \"%s\"", name)
+}
+
+func (c CalendarValue) String() string {
+	return calendarValueNames[c]
+}
+
+type calendar struct {
+	w      int            // Width of the visualization
+	h      int            // Height of the visualization
+	pw     int            // Width of the plot area, less any legend
+	bg     int            // Background gray level
+	layout CalendarLayout // Arrangement of cells
+	value  CalendarValue  // Value by which cells are colored
+	scale  CountScale     // Scaling of counts onto the color ramp
+	loc    *time.Location // Time zone in which days and hours are reckoned
+	c0     int64          // Day or week number of the first column
+	cols   int            // Number of columns of cells
+	rows   int            // Number of rows of cells
+	pass   []int          // Counts of successful events by cell
+	fail   []int          // Counts of failed events by cell
+	total  []int          // Counts of all events by cell
+	legend bool           // Whether to include a color-scale legend
+}
+
+func init() {
+	RegisterVisualizer(&VisualizerSpec{
+		"vis-calendar",
+		"Calendar heatmap of success rates or event counts by day and hour " +
+			"or by week and weekday.",
+		timeRangeParams(
+			Param{
+				"calendar-layout", "", ChoiceParam, "day-hour",
+				[]string{"day-hour", "week-weekday"}, nil,
+				"Calendar heatmap layout: day-hour or week-weekday."},
+			Param{
+				"calendar-value", "", ChoiceParam, "success-rate",
+				[]string{"success-rate", "count"}, nil,
+				"Calendar heatmap cell value: success-rate or count."},
+			CountScaleParam,
+			Param{
+				"time-zone", "", LocationParam, "UTC", nil, nil,
+				"Time zone for calendar days and hours (like " +
+					"America/New_York)."},
+			LegendParam),
+		allChecks(CheckTimeRange, checkArea(maxArea)),
+		func(p Params) Visualizer {
+			return NewCalendar(
+				p.Int("width"), p.Int("height"), p.Int("bg"),
+				p.Time("min-time"), p.Time("max-time"), p.calendarLayout(),
+				p.calendarValue(), p.countScale(), p.Location("time-zone"),
+				p.Bool("legend"))
+		}})
+}
+
+// NewCalendar returns a calendar-heatmap-visualization generator, which lays
+// out the time range to be visualized as a grid of days by hours or weeks by
+// weekdays (in the given time zone) and colors each cell by the success rate or
+// count of the events started within it. If the time range covers more days or
+// weeks than there are pixels across the plot area, only the most recent are
+// shown.
+func NewCalendar(
+	width int,
+	height int,
+	bg int,
+	minTime int64,
+	maxTime int64,
+	layout CalendarLayout,
+	value CalendarValue,
+	scale CountScale,
+	loc *time.Location,
+	legend bool) Visualizer {
+
+	plotWidth := width
+	if legend {
+		plotWidth = width - legendWidth
+	}
+
+	v := &calendar{
+		width,
+		height,
+		plotWidth,
+		bg,
+		layout,
+		value,
+		scale,
+		loc,
+		0,
+		0,
+		24,
+		nil,
+		nil,
+		nil,
+		legend}
+	if layout == CalendarWeekWeekday {
+		v.rows = 7
+	}
+
+	c0, _ := v.cell(minTime)
+	cΩ, _ := v.cell(maxTime)
+	v.c0 = c0
+	v.cols = int(cΩ - c0 + 1)
+	if v.cols > plotWidth {
+		v.c0 += int64(v.cols - plotWidth)
+		v.cols = plotWidth
+	}
+	if v.cols < 1 {
+		v.cols = 1
+	}
+
+	v.pass = make([]int, v.cols*v.rows)
+	v.fail = make([]int, v.cols*v.rows)
+	v.total = make([]int, v.cols*v.rows)
+	return v
+}
+
+// Returns the absolute column (day or week number, counted from the start of
+// the Unix epoch) and row (hour or weekday) of the cell for the given time.
+func (v *calendar) cell(ns int64) (int64, int) {
+	t := time.Unix(0, ns).In(v.loc)
+	y, m, d := t.Date()
+	day := time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Unix() / 86400
+	if v.layout == CalendarWeekWeekday {
+		// The epoch began on a Thursday, three days into a Monday-based week.
+		week := floorDiv(day+3, 7)
+		return week, int(day + 3 - week*7)
+	}
+	return day, t.Hour()
+}
+
+// Record accepts an EventData64 pointer and counts it in its cell.
+func (v *calendar) Record(e *EventData64) {
+	c, row := v.cell(e.Start)
+	col := int(c - v.c0)
+	if col < 0 || col >= v.cols {
+		return
+	}
+	i := row*v.cols + col
+	v.total[i]++
+	if e.Status == 0 {
+		v.pass[i]++
+	} else if e.Status > 0 {
+		v.fail[i]++
+	}
+}
+
+// Shard returns an empty calendar-heatmap-visualization generator with the same
+// configuration, for recording a share of the events in parallel.
+func (v *calendar) Shard() ShardedVisualizer {
+	shard := *v
+	shard.pass = make([]int, len(v.pass))
+	shard.fail = make([]int, len(v.fail))
+	shard.total = make([]int, len(v.total))
+	return &shard
+}
+
+// Merge folds the counts of a shard back into the visualization.
+func (v *calendar) Merge(shard ShardedVisualizer) {
+	o := shard.(*calendar)
+	mergeInts(v.pass, o.pass)
+	mergeInts(v.fail, o.fail)
+	mergeInts(v.total, o.total)
+}
+
+// Render returns the visualization constructed from all previously-recorded
+// data points.
+func (v *calendar) Render() image.Image {
+
+	vis := initializeVisualization(v.w, v.h, v.bg)
+
+	maxCount := 0
+	for _, count := range v.total {
+		if count > maxCount {
+			maxCount = count
+		}
+	}
+
+	// Fill each cell with a value to show with the color for that value,
+	// leaving a gap between cells which are large enough to spare one.
+	for row := 0; row < v.rows; row++ {
+		yMin, yMax := row*v.h/v.rows, (row+1)*v.h/v.rows
+		if yMax-yMin >= 4 {
+			yMax--
+		}
+		for col := 0; col < v.cols; col++ {
+			xMin, xMax := col*v.pw/v.cols, (col+1)*v.pw/v.cols
+			if xMax-xMin >= 4 {
+				xMax--
+			}
+			i := row*v.cols + col
+			var f float64
+			if v.value == CalendarCount {
+				if v.total[i] == 0 {
+					continue
+				}
+				f = v.scale.fraction(v.total[i], maxCount)
+			} else {
+				if v.pass[i]+v.fail[i] == 0 {
+					continue
+				}
+				f = float64(v.pass[i]) / float64(v.pass[i]+v.fail[i])
+			}
+			c := rampColor(f)
+			for y := yMin; y < yMax; y++ {
+				for x := xMin; x < xMax; x++ {
+					*getRGBA(vis, x, y) = c
+				}
+			}
+		}
+	}
+
+	if v.legend {
+		if v.value == CalendarCount {
+			drawRampLegend(vis, v.scale.ticks(maxCount))
+		} else {
+			drawRampLegend(vis, []float64{0, 0.25, 0.5, 0.75, 1})
+		}
+	}
+
+	return vis
+}
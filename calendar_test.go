@@ -0,0 +1,86 @@
+// Perspective: Graphing library for quality control in event-driven systems
+
+// Copyright (C) 2016 Christian Paro <christian.paro@gmail.com>,
+//                                   <cparo@digitalocean.com>
+
+// This program is free software: you can redistribute it and/or modify it under
+// the terms of the GNU General Public License version 2 as published by the
+// Free Software Foundation.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+
+// You should have received a copy of the GNU General Public License along with
+// this program. If not, see <http://www.gnu.org/licenses/>.
+
+package perspective
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCalendarCells(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("Time zone data not available.")
+	}
+	at := func(value string) int64 {
+		tm, _ := time.ParseInLocation("2006-01-02 15:04", value, loc)
+		return tm.UnixNano()
+	}
+
+	// The day of the change to daylight saving time has only 23 hours, but the
+	// hour after it should still land in the first hour of the next column.
+	v := NewCalendar(
+		256, 128, 32, at("2016-03-12 00:00"), at("2016-03-15 00:00"),
+		CalendarDayHour, CalendarCount, CountLinear, loc, false).(*calendar)
+	if v.cols != 4 || v.rows != 24 {
+		t.Fatalf("Day-hour calendar has %dx%d cells", v.cols, v.rows)
+	}
+	c, row := v.cell(at("2016-03-14 00:30"))
+	if c-v.c0 != 2 || row != 0 {
+		t.Errorf("Midnight after DST change in column %d, row %d", c-v.c0, row)
+	}
+	c, row = v.cell(at("2016-03-13 03:30"))
+	if c-v.c0 != 1 || row != 3 {
+		t.Errorf("3:30 on DST change in column %d, row %d", c-v.c0, row)
+	}
+
+	// Weeks start on Monday, including for times before the epoch.
+	v = NewCalendar(
+		256, 128, 32, at("1969-12-22 00:00"), at("1970-01-12 00:00"),
+		CalendarWeekWeekday, CalendarCount, CountLinear, loc, false).(*calendar)
+	if v.cols != 4 || v.rows != 7 {
+		t.Fatalf("Week-weekday calendar has %dx%d cells", v.cols, v.rows)
+	}
+	for value, expected := range map[string][2]int{
+		"1969-12-22 12:00": {0, 0}, // Monday
+		"1969-12-28 12:00": {0, 6}, // Sunday
+		"1970-01-01 12:00": {1, 3}, // Thursday
+		"1970-01-11 23:59": {2, 6}, // Sunday
+		"1970-01-12 00:00": {3, 0}, // Monday
+	} {
+		c, row := v.cell(at(value))
+		if int(c-v.c0) != expected[0] || row != expected[1] {
+			t.Errorf("%s in column %d, row %d, expected %v",
+				value, c-v.c0, row, expected)
+		}
+	}
+}
+
+// Long time ranges are cut down to the most recent days that fit.
+func TestCalendarLimitsColumns(t *testing.T) {
+	v := NewCalendar(
+		64, 24, 32, 0, testΩ, CalendarDayHour, CalendarCount, CountLinear,
+		time.UTC, false).(*calendar)
+	if v.cols != 64 {
+		t.Fatalf("Calendar has %d columns, expected 64", v.cols)
+	}
+	c, _ := v.cell(testΩ)
+	if int(c-v.c0) != 63 {
+		t.Errorf("Last day in column %d, expected 63", c-v.c0)
+	}
+}
@@ -0,0 +1,307 @@
+// Perspective: Graphing library for quality control in event-driven systems
+
+// Copyright (C) 2016 Christian Paro <christian.paro@gmail.com>,
+//                                   <cparo@digitalocean.com>
+
+// This program is free software: you can redistribute it and/or modify it under
+// the terms of the GNU General Public License version 2 as published by the
+// Free Software Foundation.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+
+// You should have received a copy of the GNU General Public License along with
+// this program. If not, see <http://www.gnu.org/licenses/>.
+
+package perspective
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// CDFVisualizer is a visualization generator for cumulative distributions of
+// run times, which can also give the distributions it plots as numbers.
+type CDFVisualizer interface {
+	Visualizer
+	Curves() []CDFCurve
+}
+
+// CDFCurve is the cumulative distribution of run times for a group of events,
+// sampled at the upper edge of each x-position of the visualization. Events
+// with run times beyond the end of the run-time axis are counted in the group
+// but in none of its samples, so the distribution falls short of 1 at the last
+// sample by their share.
+type CDFCurve struct {
+	Grouping string     `json:"grouping"`       // Grouping of events in curves
+	Group    int        `json:"group"`          // Type or region, if grouped
+	Name     string     `json:"name,omitempty"` // Name of the type or region
+	Outcome  string     `json:"outcome"`        // "success" or "failure"
+	Count    int        `json:"count"`          // Number of events in the group
+	Clipped  int        `json:"clipped"`        // Number beyond the axis
+	Points   []CDFPoint `json:"points"`         // Samples of the distribution
+}
+
+// CDFPoint is the fraction of a group of events with run times up to a given
+// run time.
+type CDFPoint struct {
+	RunTime  float64 `json:"run_time"` // Run time, in seconds
+	Fraction float64 `json:"fraction"` // Fraction of events up to it
+}
+
+// Names of the outcomes for which separate curves are plotted.
+var cdfOutcomes = []string{"success", "failure"}
+
+type cdf struct {
+	w        int         // Width of the visualization
+	h        int         // Height of the visualization
+	bg       int         // Background gray level
+	axis     RunTimeAxis // Mapping of run times to the x-axis
+	clips    axisClips   // Counts of events clipped at run-time axis bounds
+	grouping Grouping    // Grouping of events into curves
+	survival bool        // Whether to plot survival rather than the CDF
+	counts   [][]int     // Counts by curve and x-position, then beyond the axis
+	names    groupNames  // Names of event types and regions, for labels
+}
+
+func init() {
+	RegisterVisualizer(&VisualizerSpec{
+		"vis-cdf",
+		"Cumulative distributions of the run times of successful and " +
+			"failed events.",
+		sizeParams(
+			withAxis(
+				GroupByParam,
+				Param{
+					"survival", "", BoolParam, "false", nil, nil,
+					"Plot survival curves (fraction still running) rather " +
+						"than CDFs."})...),
+		allChecks(checkAxis, checkArea(maxArea)),
+		func(p Params) Visualizer {
+			return NewCDF(
+				p.Int("width"), p.Int("height"), p.Int("bg"),
+				p.runTimeAxis(), p.grouping(), p.Bool("survival"))
+		}})
+}
+
+// NewCDF returns a visualization generator for the cumulative distributions of
+// the run times of completed events, plotted along the given run-time axis
+// with separate curves for successful and failed events. Grouping by type or
+// region further separates the curves for each type or region, and grouping by
+// status gives just the two curves. If survival is set, the fraction of events
+// still running after each run time (one minus the cumulative distribution) is
+// plotted instead.
+func NewCDF(
+	width int,
+	height int,
+	bg int,
+	axis RunTimeAxis,
+	grouping Grouping,
+	survival bool) CDFVisualizer {
+
+	return &cdf{
+		width,
+		height,
+		bg,
+		axis.fitted(width),
+		axisClips{},
+		grouping,
+		survival,
+		make([][]int, 2*maxGroups),
+		groupNames{}}
+}
+
+// Returns the curve for events in the given group with the given outcome.
+func (v *cdf) curve(group int, outcome int) int {
+	if v.grouping == GroupStatus {
+		group = 0
+	}
+	return group*2 + outcome
+}
+
+// Record accepts an EventData64 pointer and counts it in its curve.
+func (v *cdf) Record(e *EventData64) {
+
+	if e.Status < 0 {
+		return
+	}
+	outcome := 0
+	if e.Status > 0 {
+		outcome = 1
+	}
+	c := v.curve(v.grouping.group(e), outcome)
+	if v.counts[c] == nil {
+		v.counts[c] = make([]int, v.w+1)
+	}
+
+	// Run times clipped at the lower bound of the run-time axis are counted in
+	// the first x-position, as are those below the origin of an axis with no
+	// minimum set. Those clipped at its upper bound, or beyond the last
+	// x-position, are counted past the end, where they are left out of the
+	// samples of the distribution.
+	xOffset, clip := v.axis.flooredOffset(seconds(e.Run))
+	if math.IsNaN(xOffset) {
+		return
+	}
+	if xOffset > float64(v.w) {
+		clip = 1
+	}
+	v.clips.count(clip)
+	x := int(math.Min(float64(v.w-1), xOffset))
+	if clip > 0 {
+		x = v.w
+	}
+	v.counts[c][x]++
+}
+
+// Truncated returns the number of events left out of the distributions for
+// run times beyond the end of the run-time axis.
+func (v *cdf) Truncated() int {
+	return v.clips.hi
+}
+
+// Shard returns an empty CDF-visualization generator with the same
+// configuration, for recording a share of the events in parallel.
+func (v *cdf) Shard() ShardedVisualizer {
+	shard := *v
+	shard.counts = make([][]int, len(v.counts))
+	return &shard
+}
+
+// Merge folds the counts of a shard back into the visualization.
+func (v *cdf) Merge(shard ShardedVisualizer) {
+	o := shard.(*cdf)
+	for c := range o.counts {
+		if o.counts[c] == nil {
+			continue
+		}
+		if v.counts[c] == nil {
+			v.counts[c] = o.counts[c]
+			continue
+		}
+		mergeInts(v.counts[c], o.counts[c])
+	}
+	v.clips.merge(&o.clips)
+}
+
+// SetNames sets the names of event types and regions, by code, with which the
+// curves for each type or region are labeled.
+func (v *cdf) SetNames(types map[uint8]string, regions map[uint8]string) {
+	v.names = groupNames{types, regions}
+}
+
+// Curves returns the cumulative distributions of run times recorded so far,
+// for each group of events recorded.
+func (v *cdf) Curves() []CDFCurve {
+	var curves []CDFCurve
+	for c := range v.counts {
+		if v.counts[c] == nil {
+			continue
+		}
+		total := 0
+		for _, n := range v.counts[c] {
+			total += n
+		}
+		curve := CDFCurve{
+			v.grouping.String(),
+			c / 2,
+			v.grouping.name(v.names, c/2),
+			cdfOutcomes[c%2],
+			total,
+			v.counts[c][v.w],
+			make([]CDFPoint, v.w)}
+		sum := 0
+		for x, n := range v.counts[c][:v.w] {
+			sum += n
+			curve.Points[x] = CDFPoint{
+				v.axis.at(float64(x + 1)),
+				float64(sum) / float64(total)}
+		}
+		curves = append(curves, curve)
+	}
+	return curves
+}
+
+// Render returns the visualization constructed from all previously-recorded
+// data points.
+func (v *cdf) Render() image.Image {
+
+	w, h := v.w, v.h
+	vis := initializeVisualization(w, h, v.bg)
+
+	// Draw vertical grid lines on each step along the run-time axis, and
+	// horizontal grid lines at each quartile.
+	step := v.axis.gridStep()
+	for x := step; x < float64(w) && step >= minGridStep; x += step {
+		drawXGridLine(vis, int(x))
+	}
+	for i := 1; i < 4; i++ {
+		drawYGridLine(vis, i*(h-1)/4)
+	}
+	if v.clips.lo > 0 {
+		drawXClipLine(vis, 0)
+	}
+	if v.clips.hi > 0 {
+		drawXClipLine(vis, w-1)
+	}
+
+	// Draw each curve as a line connecting its value at each x-position, with
+	// the curves for failures dashed.
+	curves := v.Curves()
+	groups := make(map[int]int)
+	var names []string
+	for _, curve := range curves {
+		if _, exists := groups[curve.Group]; !exists {
+			groups[curve.Group] = len(groups)
+			names = append(names, curve.Name)
+		}
+	}
+	for _, curve := range curves {
+		dashed := curve.Outcome == cdfOutcomes[1]
+		var c color.RGBA
+		if v.grouping != GroupStatus {
+			c = v.grouping.color(curve.Group, groups[curve.Group], len(groups))
+		} else if dashed {
+			c = statusGroupColors[statusGroup(1)]
+		} else {
+			c = statusGroupColors[statusGroup(0)]
+		}
+		yLast := -1
+		for x, p := range curve.Points {
+			f := p.Fraction
+			if v.survival {
+				f = 1 - f
+			}
+			y := int(float64(h-1) * (1 - f))
+			if yLast < 0 {
+				yLast = y
+			}
+			if dashed && x%4 >= 2 {
+				yLast = y
+				continue
+			}
+			yMin, yMax := y, yLast
+			if yMin > yMax {
+				yMin, yMax = yMax, yMin
+			}
+			for yP := yMin; yP <= yMax; yP++ {
+				vis.Set(x, yP, c)
+			}
+			yLast = y
+		}
+	}
+
+	// Name the curves for each type or region in a legend.
+	if v.grouping != GroupStatus {
+		colors := make([]color.RGBA, len(names))
+		for g, rank := range groups {
+			colors[rank] = v.grouping.color(g, rank, len(groups))
+		}
+		drawLegend(vis, v.bg, names, colors)
+	}
+
+	return vis
+}
@@ -0,0 +1,77 @@
+// Perspective: Graphing library for quality control in event-driven systems
+
+// Copyright (C) 2016 Christian Paro <christian.paro@gmail.com>,
+//                                   <cparo@digitalocean.com>
+
+// This program is free software: you can redistribute it and/or modify it under
+// the terms of the GNU General Public License version 2 as published by the
+// Free Software Foundation.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+
+// You should have received a copy of the GNU General Public License along with
+// this program. If not, see <http://www.gnu.org/licenses/>.
+
+package perspective
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestCDFCurves(t *testing.T) {
+	s := int64(time.Second)
+	v := NewCDF(100, 50, 32, NewLinearAxis(1, 0, 0), GroupType, false)
+	events := []EventData64{
+		{Run: 10 * s, Type: 1},
+		{Run: 20 * s, Type: 1},
+		{Run: 30 * s, Type: 1},
+		{Run: 40 * s, Type: 1},
+		{Run: 15 * s, Type: 1, Status: 2},
+		{Run: 99 * s, Type: 2},
+		{Run: 5 * s, Type: 2, Status: -1}, // In progress, so ignored
+		{Run: 500 * s, Type: 2},           // Beyond the end of the axis
+	}
+	for i := range events {
+		v.Record(&events[i])
+	}
+	curves := v.Curves()
+	if len(curves) != 3 {
+		t.Fatalf("Got %d curves, expected 3", len(curves))
+	}
+	expected := []struct {
+		group   int
+		outcome string
+		count   int
+		clipped int
+		at21s   float64
+		at100s  float64
+	}{
+		{1, "success", 4, 0, 0.5, 1},
+		{1, "failure", 1, 0, 1, 1},
+		{2, "success", 2, 1, 0, 0.5}}
+	for i, e := range expected {
+		c := curves[i]
+		if c.Group != e.group || c.Outcome != e.outcome || c.Count != e.count {
+			t.Errorf("Curve %d is %s %d of %d events, expected %s %d of %d",
+				i, c.Outcome, c.Group, c.Count, e.outcome, e.group, e.count)
+		}
+		// The point at x-position 20 covers run times below 21 seconds.
+		p := c.Points[20]
+		if p.RunTime != 21 || math.Abs(p.Fraction-e.at21s) > 1e-9 {
+			t.Errorf("Curve %d has %+v, expected %f at 21s", i, p, e.at21s)
+		}
+		if c.Clipped != e.clipped || c.Points[99].Fraction != e.at100s {
+			t.Errorf("Curve %d ends at %f with %d clipped, expected %f and %d",
+				i, c.Points[99].Fraction, c.Clipped, e.at100s, e.clipped)
+		}
+	}
+	if v.(TruncatedVisualizer).Truncated() != 1 {
+		t.Errorf("Truncated %d events, expected 1",
+			v.(TruncatedVisualizer).Truncated())
+	}
+}
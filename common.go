@@ -22,6 +22,7 @@ import (
 	"image/color"
 	"image/draw"
 	"math"
+	"time"
 	"unsafe"
 )
 
@@ -46,8 +47,8 @@ var pointConvolutionKernel = [25]float64{
 	0.000004, 0.000455, 0.001978, 0.000455, 0.000004,
 }
 
-// Struct to represent data to submit to the visualization generators, and to be
-// used for the binary log format.
+// Struct to represent event data in the original binary log format, with 32-bit
+// times measured in seconds.
 type EventData struct {
 	ID       int32 // Event identifier.
 	Start    int32 // In seconds since the beginning of the Unix epoch.
@@ -58,12 +59,87 @@ type EventData struct {
 	Progress uint8 // Event progress percentage.
 }
 
+// Struct to represent high-resolution event data, with 64-bit times measured in
+// nanoseconds. This is the form in which event data is submitted to the
+// visualization generators, and is used for the high-resolution binary log
+// format. The trailing padding is explicit so the struct is written out to a
+// binary log with the same layout it has in memory.
+type EventData64 struct {
+	ID       int64    // Event identifier.
+	Start    int64    // In nanoseconds since the beginning of the Unix epoch.
+	Run      int64    // Event run time, in nanoseconds.
+	Type     uint8    // Event type indication.
+	Status   int8     // 0 for success, >0 for failure, <0 for in-progress.
+	Region   uint8    // Region identifier, 0 if undefined.
+	Progress uint8    // Event progress percentage.
+	_        [4]uint8 // Padding to an eight-byte boundary.
+}
+
+// Widen copies the event into its high-resolution representation.
+func (e *EventData) Widen(w *EventData64) {
+	w.ID = int64(e.ID)
+	w.Start = int64(e.Start) * int64(time.Second)
+	w.Run = int64(e.Run) * int64(time.Second)
+	w.Type = e.Type
+	w.Status = e.Status
+	w.Region = e.Region
+	w.Progress = e.Progress
+}
+
 // Abstract interface for visualization generators.
 type Visualizer interface {
-	Record(*EventData)
+	Record(*EventData64)
 	Render() image.Image
 }
 
+// Abstract interface for visualization generators which need to know the
+// resolution at which the run times they are given were measured, as for the
+// generators which apply noise to run times to hide quantization artifacts. The
+// resolution is given in seconds, and is assumed to be one second if not set.
+type QuantizedVisualizer interface {
+	Visualizer
+	SetResolution(float64)
+}
+
+// Abstract interface for visualization generators which can record events in
+// parallel. Shard returns an empty generator with the same configuration as the
+// one it is called on, which can be given a share of the events to be recorded
+// independently of the original. Merge folds the state recorded by such a shard
+// back into the generator it was split from, ahead of rendering.
+type ShardedVisualizer interface {
+	Visualizer
+	Shard() ShardedVisualizer
+	Merge(ShardedVisualizer)
+}
+
+// Abstract interface for visualization generators which may leave out some of
+// the events they are given, as for those which draw each event individually and
+// so can only legibly show a limited number of them, or those which cannot show
+// run times beyond the end of their run-time axis. Truncated returns the number
+// of events which were left out of the rendered visualization.
+type TruncatedVisualizer interface {
+	Visualizer
+	Truncated() int
+}
+
+// Abstract interface for visualization generators which show each event over
+// the span of time it was in flight, rather than only at its start, and so need
+// to be given the events still in flight at the start of their time range as
+// well as those which started within it. InFlight is only a marker, and does
+// nothing.
+type SpanningVisualizer interface {
+	Visualizer
+	InFlight()
+}
+
+// Abstract interface for visualization generators which can group events by
+// type or region, and which label each group with the name given for its code,
+// if it has one. SetNames sets the names of event types and regions by code.
+type LabeledVisualizer interface {
+	Visualizer
+	SetNames(types map[uint8]string, regions map[uint8]string)
+}
+
 // Utility function to draw a vertical grid line at the specified x position.
 func drawXGridLine(vis *image.RGBA, x int) {
 	c := color.RGBA{grid, grid, grid, opaque}
@@ -166,6 +242,11 @@ func initializeVisualization(width int, height int, bg int) *image.RGBA {
 	return vis
 }
 
+// Utility function to convert a time in nanoseconds to seconds.
+func seconds(ns int64) float64 {
+	return float64(ns) / float64(time.Second)
+}
+
 // Get the largest of three integers (without a lot of casting)
 func intMaxOfThree(a int, b int, c int) int {
 	if a > b {
@@ -193,3 +274,27 @@ func intMinOfThree(a int, b int, c int) int {
 	}
 	return c
 }
+
+// Utility function to add the values of one slice into another, as is needed for
+// merging the recorded state of sharded visualization generators.
+func mergeFloat64s(dst []float64, src []float64) {
+	for i := range src {
+		dst[i] += src[i]
+	}
+}
+
+// Utility function to add the values of one slice into another, as is needed for
+// merging the recorded state of sharded visualization generators.
+func mergeInts(dst []int, src []int) {
+	for i := range src {
+		dst[i] += src[i]
+	}
+}
+
+// Integer division rounding toward negative infinity, rather than toward zero.
+func floorDiv(a int64, b int64) int64 {
+	if a%b != 0 && (a < 0) != (b < 0) {
+		return a/b - 1
+	}
+	return a / b
+}
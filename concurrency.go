@@ -0,0 +1,224 @@
+// Perspective: Graphing library for quality control in event-driven systems
+
+// Copyright (C) 2016 Christian Paro <christian.paro@gmail.com>,
+//                                   <cparo@digitalocean.com>
+
+// This program is free software: you can redistribute it and/or modify it under
+// the terms of the GNU General Public License version 2 as published by the
+// Free Software Foundation.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+
+// You should have received a copy of the GNU General Public License along with
+// this program. If not, see <http://www.gnu.org/licenses/>.
+
+package perspective
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+type concurrency struct {
+	w        int         // Width of the visualization
+	h        int         // Height of the visualization
+	bg       int         // Background gray level
+	tA       int64       // Lower limit of time range to be visualized
+	tτ       float64     // Length of time range to be visualized
+	grouping Grouping    // Grouping of events into stacked layers
+	delta    [][]float64 // Changes in in-flight counts, by group and x-position
+	partial  [][]float64 // Partial-column in-flight time, by group and position
+	xGrid    int         // Number of vertical grid divisions
+	names    groupNames  // Names of event types and regions, for labels
+}
+
+func init() {
+	RegisterVisualizer(&VisualizerSpec{
+		"vis-concurrency",
+		"Stacked area graph of the number of events in flight over time.",
+		timeRangeParams(GroupByParam, XGridParam),
+		allChecks(CheckTimeRange, checkArea(maxArea)),
+		func(p Params) Visualizer {
+			return NewConcurrency(
+				p.Int("width"), p.Int("height"), p.Int("bg"),
+				p.Time("min-time"), p.Time("max-time"), p.grouping(),
+				p.Int("x-grid"))
+		}})
+}
+
+// NewConcurrency returns a concurrency-visualization generator, which plots the
+// number of events in flight over time, as a stack of layers by the given
+// grouping. Each x-position shows the average number of events in flight over
+// the span of time it covers, so short-lived events are accounted for even if
+// they start and end between the boundaries of an x-position. In-progress
+// events are counted as in flight for their run time so far. As a spanning
+// visualization, it is given the events which started before its time range but
+// were still in flight at its start, so they are counted from its left edge.
+func NewConcurrency(
+	width int,
+	height int,
+	bg int,
+	minTime int64,
+	maxTime int64,
+	grouping Grouping,
+	xGrid int) Visualizer {
+
+	return &concurrency{
+		width,
+		height,
+		bg,
+		minTime,
+		float64(maxTime - minTime),
+		grouping,
+		make([][]float64, maxGroups),
+		make([][]float64, maxGroups),
+		xGrid,
+		groupNames{}}
+}
+
+// Record accepts an EventData64 pointer and adds its span of time in flight to
+// the visualization.
+func (v *concurrency) Record(e *EventData64) {
+
+	// Positions on the x-axis of the start and end of the event, clamped to the
+	// bounds of the visualization.
+	w := float64(v.w)
+	a := math.Max(0, w*float64(e.Start-v.tA)/v.tτ)
+	b := math.Min(w, w*float64(e.Start+e.Run-v.tA)/v.tτ)
+	if a >= b {
+		return
+	}
+
+	g := v.grouping.group(e)
+	if v.delta[g] == nil {
+		v.delta[g] = make([]float64, v.w+1)
+		v.partial[g] = make([]float64, v.w)
+	}
+	delta, partial := v.delta[g], v.partial[g]
+
+	// Columns covered entirely by the event are counted through the running
+	// sum of changes, and those covered partially by the fraction covered.
+	xA, xB := int(a), int(b)
+	if xA == xB {
+		partial[xA] += b - a
+		return
+	}
+	partial[xA] += float64(xA+1) - a
+	delta[xA+1]++
+	delta[xB]--
+	if xB < v.w {
+		partial[xB] += b - float64(xB)
+	}
+}
+
+// SetNames sets the names of event types and regions, by code, with which the
+// layers of the stack are labeled in a legend.
+func (v *concurrency) SetNames(
+	types map[uint8]string,
+	regions map[uint8]string) {
+
+	v.names = groupNames{types, regions}
+}
+
+// InFlight marks the concurrency visualization as one which counts events over
+// the span of time they were in flight.
+func (v *concurrency) InFlight() {}
+
+// Shard returns an empty concurrency-visualization generator with the same
+// configuration, for recording a share of the events in parallel.
+func (v *concurrency) Shard() ShardedVisualizer {
+	shard := *v
+	shard.delta = make([][]float64, maxGroups)
+	shard.partial = make([][]float64, maxGroups)
+	return &shard
+}
+
+// Merge folds the in-flight counts of a shard back into the visualization.
+func (v *concurrency) Merge(shard ShardedVisualizer) {
+	o := shard.(*concurrency)
+	for g := range o.delta {
+		if o.delta[g] == nil {
+			continue
+		}
+		if v.delta[g] == nil {
+			v.delta[g], v.partial[g] = o.delta[g], o.partial[g]
+			continue
+		}
+		mergeFloat64s(v.delta[g], o.delta[g])
+		mergeFloat64s(v.partial[g], o.partial[g])
+	}
+}
+
+// Render returns the visualization constructed from all previously-recorded
+// data points.
+func (v *concurrency) Render() image.Image {
+
+	vis := initializeVisualization(v.w, v.h, v.bg)
+	if v.xGrid > 0 {
+		for i := 1; i < v.xGrid; i++ {
+			drawXGridLine(vis, i*v.w/v.xGrid)
+		}
+	}
+
+	// Resolve the average in-flight count for each group at each x-position,
+	// and the stacked total, to normalize the height of the stack.
+	var groups []int
+	counts := make([][]float64, maxGroups)
+	totals := make([]float64, v.w)
+	for g := range v.delta {
+		if v.delta[g] == nil {
+			continue
+		}
+		groups = append(groups, g)
+		counts[g] = make([]float64, v.w)
+		running := 0.0
+		for x := 0; x < v.w; x++ {
+			running += v.delta[g][x]
+			counts[g][x] = running + v.partial[g][x]
+			totals[x] += counts[g][x]
+		}
+	}
+	maxTotal := 0.0
+	for x := 0; x < v.w; x++ {
+		maxTotal = math.Max(maxTotal, totals[x])
+	}
+	if maxTotal == 0 {
+		return vis
+	}
+	scale := float64(v.h) / maxTotal
+
+	// Draw the stack, with the first group at the bottom. Layer boundaries are
+	// rounded from the running total so rounding errors don't accumulate up
+	// the stack.
+	colors := make([]color.RGBA, len(groups))
+	for rank, g := range groups {
+		colors[rank] = v.grouping.color(g, rank, len(groups))
+	}
+	for x := 0; x < v.w; x++ {
+		sum := 0.0
+		for rank, g := range groups {
+			yMin := int(math.Floor(sum*scale + 0.5))
+			sum += counts[g][x]
+			yMax := int(math.Floor(sum*scale + 0.5))
+			for y := yMin; y < yMax; y++ {
+				*getRGBA(vis, x, v.h-1-y) = colors[rank]
+			}
+		}
+	}
+
+	// Name the layers in a legend, listed from the top of the stack down.
+	names := make([]string, len(groups))
+	legendColors := make([]color.RGBA, len(groups))
+	for rank, g := range groups {
+		i := len(groups) - 1 - rank
+		names[i] = v.grouping.name(v.names, g)
+		legendColors[i] = colors[rank]
+	}
+	drawLegend(vis, v.bg, names, legendColors)
+
+	return vis
+}
@@ -0,0 +1,104 @@
+// Perspective: Graphing library for quality control in event-driven systems
+
+// Copyright (C) 2016 Christian Paro <christian.paro@gmail.com>,
+//                                   <cparo@digitalocean.com>
+
+// This program is free software: you can redistribute it and/or modify it under
+// the terms of the GNU General Public License version 2 as published by the
+// Free Software Foundation.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+
+// You should have received a copy of the GNU General Public License along with
+// this program. If not, see <http://www.gnu.org/licenses/>.
+
+package perspective
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+	"time"
+)
+
+// In-flight counts should be averaged over the time covered by each column,
+// including for events which start and end within a single column.
+func TestConcurrencyCounts(t *testing.T) {
+	s := int64(time.Second)
+	v := NewConcurrency(10, 10, 32, 0, 10*s, GroupStatus, 0).(*concurrency)
+	events := []EventData64{
+		{Start: 0, Run: 10 * s},                   // All columns
+		{Start: 2*s + s/2, Run: 2 * s},            // 2.5 to 4.5
+		{Start: 7*s + s/4, Run: s / 2, Status: 1}, // Within column 7
+		{Start: 8 * s, Run: 999 * s, Status: -1},  // Past the end
+		{Start: -5 * s, Run: 6 * s},               // Before, into 0
+		{Start: 11 * s, Run: s},                   // After the end
+	}
+	for i := range events {
+		v.Record(&events[i])
+	}
+	expected := []float64{2, 1, 1.5, 2, 1.5, 1, 1, 1.5, 2, 2}
+	for x := range expected {
+		total, running := 0.0, 0.0
+		for g := range v.delta {
+			if v.delta[g] == nil {
+				continue
+			}
+			running = 0
+			for i := 0; i <= x; i++ {
+				running += v.delta[g][i]
+			}
+			total += running + v.partial[g][x]
+		}
+		if math.Abs(total-expected[x]) > 1e-9 {
+			t.Errorf("Column %d has %f in flight, expected %f",
+				x, total, expected[x])
+		}
+	}
+}
+
+// Layers with names should be labeled in a legend, and those without left out
+// of it.
+func TestConcurrencyLegend(t *testing.T) {
+	s := int64(time.Second)
+	events := []EventData64{
+		{Start: 0, Run: 10 * s, Type: 1},
+		{Start: 0, Run: 10 * s, Type: 2}}
+	render := func(names map[uint8]string) *image.RGBA {
+		v := NewConcurrency(40, 20, 32, 0, 10*s, GroupType, 0)
+		v.(LabeledVisualizer).SetNames(names, nil)
+		for i := range events {
+			v.Record(&events[i])
+		}
+		return v.Render().(*image.RGBA)
+	}
+
+	// The top layer (type 2) fills the top half of the plot, so the legend is
+	// drawn over it.
+	top := GroupType.color(2, 1, 2)
+	if c := render(nil).RGBAAt(glyphH+2, 1); c != top {
+		t.Errorf("Unlabeled plot has %v under the legend, expected %v",
+			c, top)
+	}
+	vis := render(map[uint8]string{2: "b"})
+	label := color.RGBA{labelGray, labelGray, labelGray, opaque}
+	bg := color.RGBA{32, 32, 32, opaque}
+	cases := []struct {
+		x, y     int
+		expected color.RGBA
+	}{
+		{1, 1, top},            // Swatch
+		{glyphH + 1, 1, bg},    // Box
+		{glyphH + 2, 1, label}, // Top-left of the "B"
+		{1, glyphH + 2, top}}   // Below the single row
+	for _, c := range cases {
+		if vis.RGBAAt(c.x, c.y) != c.expected {
+			t.Errorf("Legend has %v at (%d, %d), expected %v",
+				vis.RGBAAt(c.x, c.y), c.x, c.y, c.expected)
+		}
+	}
+}
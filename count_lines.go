@@ -25,7 +25,7 @@ import (
 type countLines struct {
 	w         int       // Width of the visualization
 	h         int       // Height of the visualization
-	tA        float64   // Lower limit of time range to be visualized
+	tA        int64     // Lower limit of time range to be visualized
 	tτ        float64   // Length of time range to be visualized
 	s         []float64 // Counts of successful events by x-axis position
 	f         []float64 // Counts of failed events by x-axis position
@@ -35,13 +35,28 @@ type countLines struct {
 	bg        int       // Background grey level
 }
 
+func init() {
+	RegisterVisualizer(&VisualizerSpec{
+		"vis-count-lines",
+		"Smoothed lines of counts of successful and failed events over " +
+			"their start times (in-progress events are left out).",
+		timeRangeParams(ResonanceParam, XGridParam),
+		allChecks(CheckTimeRange, checkArea(maxArea)),
+		func(p Params) Visualizer {
+			return NewCountLines(
+				p.Int("width"), p.Int("height"), p.Int("bg"),
+				p.Time("min-time"), p.Time("max-time"),
+				p.Float("smoothing-resonance"), p.Int("x-grid"))
+		}})
+}
+
 // NewCountLines returns an line-graph event-count-visualization generator.
 func NewCountLines(
 	width int,
 	height int,
 	bg int,
-	minTime int,
-	maxTime int,
+	minTime int64,
+	maxTime int64,
 	resonance float64,
 	xGrid int) Visualizer {
 
@@ -56,7 +71,7 @@ func NewCountLines(
 	return &countLines{
 		width,
 		height,
-		float64(minTime),
+		minTime,
 		float64(maxTime - minTime),
 		make([]float64, width),
 		make([]float64, width),
@@ -66,8 +81,8 @@ func NewCountLines(
 		bg}
 }
 
-// Record accepts an EventData pointer and plots it onto the visualization.
-func (v *countLines) Record(e *EventData) {
+// Record accepts an EventData64 pointer and plots it onto the visualization.
+func (v *countLines) Record(e *EventData64) {
 
 	resonance := v.resonance
 	window := v.window
@@ -75,7 +90,7 @@ func (v *countLines) Record(e *EventData) {
 	// Position on the x-axis corresponds to the event's start time. Event run
 	// times are not taken into account in this visualization. A margin is left
 	// on each edge for smoothing purposes.
-	x := int(float64(v.w) * (float64(e.Start) - v.tA) / v.tτ)
+	x := int(float64(v.w) * float64(e.Start-v.tA) / v.tτ)
 
 	// Ignore active events
 	if e.Status < 0 {
@@ -105,6 +120,23 @@ func (v *countLines) Record(e *EventData) {
 	}
 }
 
+// Shard returns an empty event-count-visualization generator with the same
+// configuration, for recording a share of the events in parallel.
+func (v *countLines) Shard() ShardedVisualizer {
+	shard := *v
+	shard.s = make([]float64, len(v.s))
+	shard.f = make([]float64, len(v.f))
+	return &shard
+}
+
+// Merge folds the (already smoothed) counts of a shard back into the
+// visualization.
+func (v *countLines) Merge(shard ShardedVisualizer) {
+	o := shard.(*countLines)
+	mergeFloat64s(v.s, o.s)
+	mergeFloat64s(v.f, o.f)
+}
+
 // Render returns the visualization constructed from all previously-recorded
 // data points.
 func (v *countLines) Render() image.Image {
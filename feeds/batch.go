@@ -0,0 +1,100 @@
+// Perspective: Graphing library for quality control in event-driven systems
+
+// Copyright (C) 2016 Christian Paro <christian.paro@gmail.com>,
+//                                   <cparo@digitalocean.com>
+
+// This program is free software: you can redistribute it and/or modify it under
+// the terms of the GNU General Public License version 2 as published by the
+// Free Software Foundation.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+
+// You should have received a copy of the GNU General Public License along with
+// this program. If not, see <http://www.gnu.org/licenses/>.
+
+package feeds
+
+import (
+	"context"
+	"github.com/cparo/perspective"
+	"image/png"
+	"io"
+)
+
+// Filter holds the event-filtering criteria applied to a feed before its events
+// are handed off to a visualization generator.
+type Filter struct {
+	MinTime int64 // Lower limit of time range to be visualized, in ns.
+	MaxTime int64 // Upper limit of time range to be visualized, in ns.
+	Type    int   // Event type to filter for, if non-negative.
+	Region  int   // Region to filter for, if non-negative.
+	Status  int   // Least significant bits: {done, failed, running}.
+}
+
+// Layer pairs a visualization generator with the filter for the events it is to
+// be given, for use in rendering several visualizations in a single pass over
+// an event-data feed.
+type Layer struct {
+	Name       string                 // Name for the rendered output.
+	Filter     Filter                 // Filter for events to be recorded.
+	Visualizer perspective.Visualizer // Visualization generator.
+}
+
+func (f *Filter) match(e *perspective.EventData64) bool {
+	return eventFilter(e, f.MinTime, f.MaxTime, f.Type, f.Region, f.Status)
+}
+
+// Reports whether the event matches the filter, or would if it had started
+// within the time range, having started before it but still been in flight at
+// its start.
+func (f *Filter) matchInFlight(e *perspective.EventData64) bool {
+	if e.Start > f.MinTime || e.Start+e.Run <= f.MinTime {
+		return f.match(e)
+	}
+	return eventFilter(e, e.Start-1, f.MaxTime, f.Type, f.Region, f.Status)
+}
+
+// RecordBinLog reads a binary-log formatted event-data dump and records each
+// event into the visualization generator of every layer whose filter it
+// matches, without rendering them, for use with generators which can give what
+// they have recorded in forms other than an image. Recording stops early,
+// returning the context's error, if the context is done before all events have
+// been recorded.
+func RecordBinLog(ctx context.Context, feed *Feed, layers []Layer) error {
+	return record(ctx, feed, layers)
+}
+
+// GeneratePNGsFromBinLog reads a binary-log formatted event-data dump and
+// renders a PNG file for each of the given layers, dispatching each event to
+// every layer whose filter it matches in a single pass over the event data
+// (rather than the pass per visualization which would be needed to do the same
+// with GeneratePNGFromBinLog). The out function is called for each layer in
+// turn, after all events have been recorded, to get the writer its rendered
+// visualization should be encoded to. If the context is done before all events
+// have been recorded, the context's error is returned without calling out.
+func GeneratePNGsFromBinLog(
+	ctx context.Context,
+	feed *Feed,
+	layers []Layer,
+	out func(*Layer) (io.Writer, error)) error {
+
+	if err := record(ctx, feed, layers); err != nil {
+		return err
+	}
+
+	for l, _ := range layers {
+		w, err := out(&layers[l])
+		if err != nil {
+			return err
+		}
+		err = png.Encode(w, layers[l].Visualizer.Render())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,85 @@
+// Perspective: Graphing library for quality control in event-driven systems
+
+// Copyright (C) 2016 Christian Paro <christian.paro@gmail.com>,
+//                                   <cparo@digitalocean.com>
+
+// This program is free software: you can redistribute it and/or modify it under
+// the terms of the GNU General Public License version 2 as published by the
+// Free Software Foundation.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+
+// You should have received a copy of the GNU General Public License along with
+// this program. If not, see <http://www.gnu.org/licenses/>.
+
+package feeds
+
+import (
+	"bytes"
+	"context"
+	"github.com/cparo/perspective"
+	"io"
+	"testing"
+	"time"
+)
+
+// Rendering several layers in one pass should give each the same image as
+// rendering it on its own with its own filter.
+func TestGeneratePNGsMatchesSeparate(t *testing.T) {
+	events := benchEventData()[:1<<14]
+	feed := NewFeed(events)
+	tΩ := int64(events[len(events)-1].Start+1) * int64(time.Second)
+	filters := []Filter{
+		{benchA - 1, tΩ, -1, -1, 2},
+		{benchA - 1, tΩ, 1, 2, 7}}
+	newVisualizers := func() []perspective.Visualizer {
+		return []perspective.Visualizer{
+			perspective.NewHistogram(
+				256, 128, 32, perspective.NewLog2Axis(16),
+				perspective.JitterNone),
+			perspective.NewGantt(
+				256, 128, 32, benchA, tΩ, perspective.GroupStatus, 1000, 0)}
+	}
+
+	visualizers := newVisualizers()
+	layers := make([]Layer, len(filters))
+	for l := range layers {
+		layers[l] = Layer{Filter: filters[l], Visualizer: visualizers[l]}
+	}
+	var batch []*bytes.Buffer
+	err := GeneratePNGsFromBinLog(
+		context.Background(),
+		feed,
+		layers,
+		func(l *Layer) (io.Writer, error) {
+			batch = append(batch, &bytes.Buffer{})
+			return batch[len(batch)-1], nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for l, v := range newVisualizers() {
+		var separate bytes.Buffer
+		f := filters[l]
+		err := GeneratePNGFromBinLog(
+			context.Background(),
+			feed,
+			f.MinTime,
+			f.MaxTime,
+			f.Type,
+			f.Region,
+			f.Status,
+			v,
+			&separate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(batch[l].Bytes(), separate.Bytes()) {
+			t.Errorf("Layer %d rendered differently in a batch.", l)
+		}
+	}
+}
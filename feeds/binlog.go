@@ -18,6 +18,7 @@
 package feeds
 
 import (
+	"context"
 	"encoding/binary"
 	"fmt"
 	"github.com/cparo/perspective"
@@ -27,6 +28,7 @@ import (
 	"os"
 	"reflect"
 	"syscall"
+	"time"
 	"unsafe"
 )
 
@@ -35,73 +37,109 @@ import (
 // criteria. These values are written as all int32 values for the sake of making
 // the output easier to consume with such things as a JavaScript Typed Array
 // parser (which lacks native support for such concepts as c-style structs).
+// Times are truncated to whole seconds, as in the original binary log format,
+// unless wide output is requested, in which case all values are written as
+// int64 values and times are given in nanoseconds (which is necessary for
+// times past the 32-bit overflow of Unix epoch time in 2038). If the context is
+// done before all events have been read, the context's error is returned and
+// the listing is left incomplete.
 func DumpEventData(
-	events *[]perspective.EventData,
-	tA int32,
-	tΩ int32,
+	ctx context.Context,
+	feed *Feed,
+	tA int64,
+	tΩ int64,
 	typeFilter int,
 	regionFilter int,
 	statusFilter int,
-	out io.Writer) {
+	wide bool,
+	out io.Writer) error {
 
-	for i, _ := range *events {
-		e := (*perspective.EventData)(unsafe.Pointer(&(*events)[i]))
-		if eventFilter(e, tA, tΩ, typeFilter, regionFilter, statusFilter) {
+	var scratch perspective.EventData64
+	for i := 0; i < feed.Len(); i++ {
+		if i%cancelCheckEvents == 0 && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		e := feed.event(i, &scratch)
+		if !eventFilter(e, tA, tΩ, typeFilter, regionFilter, statusFilter) {
+			continue
+		}
+		if wide {
+			binary.Write(out, binary.LittleEndian, e.ID)
+			binary.Write(out, binary.LittleEndian, e.Start)
+			binary.Write(out, binary.LittleEndian, e.Run)
+			binary.Write(out, binary.LittleEndian, int64(e.Type))
+			binary.Write(out, binary.LittleEndian, int64(e.Status))
+			binary.Write(out, binary.LittleEndian, int64(e.Region))
+			binary.Write(out, binary.LittleEndian, int64(e.Progress))
+		} else {
+			start := e.Start / int64(time.Second)
+			run := e.Run / int64(time.Second)
 			binary.Write(out, binary.LittleEndian, int32(e.ID))
-			binary.Write(out, binary.LittleEndian, int32(e.Start))
-			binary.Write(out, binary.LittleEndian, int32(e.Run))
+			binary.Write(out, binary.LittleEndian, int32(start))
+			binary.Write(out, binary.LittleEndian, int32(run))
 			binary.Write(out, binary.LittleEndian, int32(e.Type))
 			binary.Write(out, binary.LittleEndian, int32(e.Status))
 			binary.Write(out, binary.LittleEndian, int32(e.Region))
 			binary.Write(out, binary.LittleEndian, int32(e.Progress))
 		}
 	}
+	return nil
 }
 
 // GeneratePNGFromBinLog reads a binary-log formatted event-data dump and
 // renders a visualization as a PNG file using the specified visualization
-// generator and input-filtering parameters.
+// generator and input-filtering parameters. If the context is done before all
+// events have been recorded, the context's error is returned and nothing is
+// written.
 func GeneratePNGFromBinLog(
-	events *[]perspective.EventData,
-	tA int32,
-	tΩ int32,
+	ctx context.Context,
+	feed *Feed,
+	tA int64,
+	tΩ int64,
 	typeFilter int,
 	regionFilter int,
 	statusFilter int,
 	v perspective.Visualizer,
-	out io.Writer) {
-
-	// Passing event data by reference instead of passing it by value cuts about
-	// 12-15% off of run time in repeated before/after tests with the scatter
-	// visualization through the HTTP API.
-	for i, _ := range *events {
-		e := (*perspective.EventData)(unsafe.Pointer(&(*events)[i]))
-		if eventFilter(e, tA, tΩ, typeFilter, regionFilter, statusFilter) {
-			v.Record(e)
-		}
+	out io.Writer) error {
+
+	err := record(
+		ctx,
+		feed,
+		[]Layer{{
+			Filter: Filter{tA, tΩ, typeFilter, regionFilter, statusFilter},
+			Visualizer: v}})
+	if err != nil {
+		return err
 	}
 
-	png.Encode(out, v.Render())
+	return png.Encode(out, v.Render())
 }
 
 // GetSuccessRate reads a binary-log formatted event-data dump and writes out
 // the rate of successful event completions relative to all event completions
 // within the specified time range and event type filter criteria, encoded as
-// a string percentage value of up to five places (like "99.997%").
+// a string percentage value of up to five places (like "99.997%"). If the
+// context is done before all events have been read, the context's error is
+// returned and nothing is written.
 func GetSuccessRate(
-	events *[]perspective.EventData,
-	tA int32,
-	tΩ int32,
+	ctx context.Context,
+	feed *Feed,
+	tA int64,
+	tΩ int64,
 	typeFilter int,
 	regionFilter int,
-	out io.Writer) {
+	out io.Writer) error {
 
 	var (
-		pass  = 0
-		total = 0
+		pass    = 0
+		total   = 0
+		scratch perspective.EventData64
 	)
-	for i, _ := range *events {
-		e := (*perspective.EventData)(unsafe.Pointer(&(*events)[i]))
+	for i := 0; i < feed.Len(); i++ {
+		if i%cancelCheckEvents == 0 && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		e := feed.event(i, &scratch)
 		if eventFilter(e, tA, tΩ, typeFilter, regionFilter, 4) {
 			pass++
 		}
@@ -109,14 +147,21 @@ func GetSuccessRate(
 			total++
 		}
 	}
+	var err error
 	if total > 0 {
-		fmt.Fprintf(out, "%.3f%%", 100*float64(pass)/float64(total))
+		_, err = fmt.Fprintf(
+			out, "%.3f%%", 100*float64(pass)/float64(total))
 	} else {
-		fmt.Fprint(out, "NaN%")
+		_, err = fmt.Fprint(out, "NaN%")
 	}
+	return err
 }
 
-func MapBinLogFile(path string, lookback int64) *[]perspective.EventData {
+// MapBinLogFile memory-maps the binary log at the given path, in either the
+// original or the high-resolution format, and returns it as a feed. If lookback
+// is positive, only (at least) that many events from the end of the log are
+// mapped.
+func MapBinLogFile(path string, lookback int64) *Feed {
 
 	iFile, err := os.Open(path)
 	if err != nil {
@@ -134,14 +179,31 @@ func MapBinLogFile(path string, lookback int64) *[]perspective.EventData {
 
 	fileSize := iStat.Size()
 
+	// Check for the header which marks a binary log in the high-resolution
+	// format, and otherwise assume the original headerless format.
+	header := make([]byte, feedHeaderSize)
+	n, _ := iFile.ReadAt(header, 0)
+	resolution := readHeader(header[:n])
+	headerSize := int64(feedHeaderSize)
+	eventSize := int64(unsafe.Sizeof(perspective.EventData64{}))
+	if resolution == 0 {
+		resolution = int64(time.Second)
+		headerSize = 0
+		eventSize = int64(unsafe.Sizeof(perspective.EventData{}))
+	} else if resolution < 0 {
+		log.Println("Invalid resolution in binary log header.")
+		return nil
+	}
+
 	var start, length int64
 	// Multiply event lookback by event struct size to get the number of actual
 	// bytes we should seek back in the input feed.
-	seekback := lookback * int64(unsafe.Sizeof(perspective.EventData{}))
-	if seekback > 0 && seekback < fileSize {
+	seekback := lookback * eventSize
+	if seekback > 0 && seekback < fileSize-headerSize {
 		start = fileSize - seekback
 		// Round down start position to fall on an even page boundary so the
-		// mmap will succeed:
+		// mmap will succeed. Since the header and event sizes both divide the
+		// page size evenly, this will still fall on an event boundary.
 		start = start - start % int64(syscall.Getpagesize())
 		length = fileSize - start
 	} else {
@@ -159,6 +221,12 @@ func MapBinLogFile(path string, lookback int64) *[]perspective.EventData {
 		return nil
 	}
 
+	// Skip past the header, if it was mapped along with the event data.
+	records := binLog
+	if start < headerSize {
+		records = binLog[headerSize-start:]
+	}
+
 	// Using this mmap-and-cast method of parsing the input log instead of the
 	// more idiomatic use of Go's bufio and encoding/binary packages for reading
 	// the input log into EventData structs yields a sixfold improvement in run
@@ -169,25 +237,29 @@ func MapBinLogFile(path string, lookback int64) *[]perspective.EventData {
 	// blank image canvas to a png file. Which should help to illustrate the
 	// absurd cost of avoiding an "unsafe" method for reading a file which would
 	// be considered perfectly valid in traditional systems development.
-	events := (*[]perspective.EventData)(unsafe.Pointer(&binLog))
-
-	// Correct the length and capacity of the events slice now that we have
-	// re-cast its type, so anything using that slice will know what to iterate
-	// over without running past the end.
-	header := (*reflect.SliceHeader)(unsafe.Pointer(events))
-	header.Len /= int(unsafe.Sizeof(perspective.EventData{}))
-	header.Cap /= int(unsafe.Sizeof(perspective.EventData{}))
+	feed := &Feed{mapping: binLog, resolution: resolution}
+	if headerSize > 0 {
+		feed.events64 = *(*[]perspective.EventData64)(unsafe.Pointer(&records))
+		castSlice(unsafe.Pointer(&feed.events64), int(eventSize))
+	} else {
+		feed.events = *(*[]perspective.EventData)(unsafe.Pointer(&records))
+		castSlice(unsafe.Pointer(&feed.events), int(eventSize))
+	}
 
-	return events
+	return feed
 }
 
-func UnmapBinLogFile(eventData *[]perspective.EventData) error {
-
-	mapping := (*[]byte)(unsafe.Pointer(eventData))
-
-	header := (*reflect.SliceHeader)(unsafe.Pointer(eventData))
-	header.Len *= int(unsafe.Sizeof(perspective.EventData{}))
-	header.Cap *= int(unsafe.Sizeof(perspective.EventData{}))
+// Corrects the length and capacity of a slice re-cast from a byte slice, so
+// anything using that slice will know what to iterate over without running
+// past the end.
+func castSlice(slice unsafe.Pointer, size int) {
+	header := (*reflect.SliceHeader)(slice)
+	header.Len /= size
+	header.Cap /= size
+}
 
-	return syscall.Munmap(*mapping)
+// UnmapBinLogFile releases the memory mapping backing a feed returned by
+// MapBinLogFile.
+func UnmapBinLogFile(feed *Feed) error {
+	return syscall.Munmap(feed.mapping)
 }
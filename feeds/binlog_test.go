@@ -0,0 +1,339 @@
+// Perspective: Graphing library for quality control in event-driven systems
+
+// Copyright (C) 2016 Christian Paro <christian.paro@gmail.com>,
+//                                   <cparo@digitalocean.com>
+
+// This program is free software: you can redistribute it and/or modify it under
+// the terms of the GNU General Public License version 2 as published by the
+// Free Software Foundation.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+
+// You should have received a copy of the GNU General Public License along with
+// this program. If not, see <http://www.gnu.org/licenses/>.
+
+package feeds
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"github.com/cparo/perspective"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Writes the given events out to a binary log in a temporary directory, with a
+// header for the high-resolution format if a resolution is given, and returns
+// the path to the log along with a function to clean it up.
+func writeBinLog(
+	t testing.TB,
+	resolution int64,
+	events interface{}) (string, func()) {
+
+	dir, err := ioutil.TempDir("", "perspective")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "feed.dat")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := bufio.NewWriter(f)
+	if resolution > 0 {
+		if err := writeHeader(w, resolution); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := binary.Write(w, binary.LittleEndian, events); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	return path, func() { os.RemoveAll(dir) }
+}
+
+// Generates high-resolution events with sub-second times, measured to the
+// millisecond.
+func highResolutionEvents(n int) []perspective.EventData64 {
+	events := make([]perspective.EventData64, n)
+	for i := range events {
+		events[i] = perspective.EventData64{
+			ID:     int64(i) << 33,
+			Start:  benchA + int64(i)*int64(time.Millisecond),
+			Run:    int64(i%1000) * int64(time.Millisecond),
+			Status: int8(i%3 - 1)}
+	}
+	return events
+}
+
+func TestMapBinLogFile(t *testing.T) {
+	events := benchEventData()[:10000]
+	path, cleanup := writeBinLog(t, 0, events)
+	defer cleanup()
+
+	mapped := MapBinLogFile(path, 0)
+	if mapped == nil {
+		t.Fatal("Failed to map binary log.")
+	}
+	defer UnmapBinLogFile(mapped)
+	if mapped.HighResolution() {
+		t.Error("Binary log mapped as high-resolution.")
+	}
+	if mapped.Resolution() != int64(time.Second) {
+		t.Errorf("Mapped resolution %d, expected 1s", mapped.Resolution())
+	}
+	if mapped.Len() != 10000 {
+		t.Fatalf("Mapped %d events, expected 10000", mapped.Len())
+	}
+	for i := range mapped.events {
+		if mapped.events[i] != events[i] {
+			t.Fatalf("Event %d mapped as %+v, expected %+v",
+				i, mapped.events[i], events[i])
+		}
+	}
+}
+
+func TestMapBinLogFileHighResolution(t *testing.T) {
+	events := highResolutionEvents(10000)
+	path, cleanup := writeBinLog(t, int64(time.Millisecond), events)
+	defer cleanup()
+
+	mapped := MapBinLogFile(path, 0)
+	if mapped == nil {
+		t.Fatal("Failed to map binary log.")
+	}
+	defer UnmapBinLogFile(mapped)
+	if !mapped.HighResolution() {
+		t.Error("Binary log not mapped as high-resolution.")
+	}
+	if mapped.Resolution() != int64(time.Millisecond) {
+		t.Errorf("Mapped resolution %d, expected 1ms", mapped.Resolution())
+	}
+	if mapped.Len() != 10000 {
+		t.Fatalf("Mapped %d events, expected 10000", mapped.Len())
+	}
+	var scratch perspective.EventData64
+	for i := 0; i < mapped.Len(); i++ {
+		if *mapped.event(i, &scratch) != events[i] {
+			t.Fatalf("Event %d mapped as %+v, expected %+v",
+				i, *mapped.event(i, &scratch), events[i])
+		}
+	}
+}
+
+// A lookback should map at least the requested number of events from the end
+// of the log, rounded out to a page boundary.
+func TestMapBinLogFileLookback(t *testing.T) {
+	legacy := benchEventData()[:10000]
+	path, cleanup := writeBinLog(t, 0, legacy)
+	defer cleanup()
+	events := make([]perspective.EventData64, len(legacy))
+	for i := range legacy {
+		legacy[i].Widen(&events[i])
+	}
+	testLookback(t, path, events)
+
+	events = highResolutionEvents(10000)
+	path, cleanup = writeBinLog(t, int64(time.Millisecond), events)
+	defer cleanup()
+	testLookback(t, path, events)
+}
+
+func testLookback(t *testing.T, path string, events []perspective.EventData64) {
+	mapped := MapBinLogFile(path, 1000)
+	if mapped == nil {
+		t.Fatal("Failed to map binary log.")
+	}
+	defer UnmapBinLogFile(mapped)
+	n := mapped.Len()
+	if n < 1000 || n >= len(events) {
+		t.Fatalf("Mapped %d events for a lookback of 1000", n)
+	}
+	var scratch perspective.EventData64
+	for i := 0; i < n; i++ {
+		if *mapped.event(i, &scratch) != events[len(events)-n+i] {
+			t.Fatal("Lookback mapping is not aligned to the end of the log.")
+		}
+	}
+}
+
+func TestGetSuccessRate(t *testing.T) {
+	feed := NewFeed([]perspective.EventData{
+		{ID: 1, Start: 10, Status: 0},
+		{ID: 2, Start: 11, Status: 0},
+		{ID: 3, Start: 12, Status: 0},
+		{ID: 4, Start: 13, Status: 2},
+		{ID: 5, Start: 14, Status: -1},
+		{ID: 6, Start: 99, Status: 1}})
+	s := int64(time.Second)
+	ctx := context.Background()
+	var out bytes.Buffer
+	GetSuccessRate(ctx, feed, 0, 50*s, -1, -1, &out)
+	if out.String() != "75.000%" {
+		t.Errorf("Success rate was %s, expected 75.000%%", out.String())
+	}
+	out.Reset()
+	GetSuccessRate(ctx, feed, 50*s, 60*s, -1, -1, &out)
+	if out.String() != "NaN%" {
+		t.Errorf("Success rate was %s, expected NaN%%", out.String())
+	}
+	out.Reset()
+	GetSuccessRate(ctx, feed, 10*s+1, 12*s+1, -1, -1, &out)
+	if out.String() != "100.000%" {
+		t.Errorf("Success rate was %s, expected 100.000%%", out.String())
+	}
+}
+
+// Filtering on sub-second time bounds should work for high-resolution feeds.
+func TestGetSuccessRateHighResolution(t *testing.T) {
+	feed := NewFeed64(highResolutionEvents(10), int64(time.Millisecond))
+	var out bytes.Buffer
+	GetSuccessRate(
+		context.Background(),
+		feed,
+		benchA,
+		benchA+int64(5*time.Millisecond)+1,
+		-1,
+		-1,
+		&out)
+	if out.String() != "50.000%" {
+		t.Errorf("Success rate was %s, expected 50.000%%", out.String())
+	}
+}
+
+func TestDumpEventData(t *testing.T) {
+	feed := NewFeed([]perspective.EventData{
+		{ID: 1, Start: 10, Run: 5, Type: 2, Status: 0, Region: 3, Progress: 100},
+		{ID: 2, Start: 11, Run: 6, Type: 1, Status: 1, Region: 3, Progress: 50}})
+	var out bytes.Buffer
+	DumpEventData(
+		context.Background(),
+		feed,
+		0,
+		int64(50*time.Second),
+		2,
+		-1,
+		7,
+		false,
+		&out)
+	dumped := make([]int32, 7)
+	if err := binary.Read(&out, binary.LittleEndian, dumped); err != nil {
+		t.Fatal(err)
+	}
+	expected := []int32{1, 10, 5, 2, 0, 3, 100}
+	for i := range expected {
+		if dumped[i] != expected[i] {
+			t.Fatalf("Dumped %v, expected %v", dumped, expected)
+		}
+	}
+	if out.Len() != 0 {
+		t.Error("Dump includes events which should have been filtered out.")
+	}
+}
+
+// Wide dumps should carry times past 2038 through intact, in nanoseconds.
+func TestDumpEventDataWide(t *testing.T) {
+	start := 4102444800 * int64(time.Second) // 2100-01-01 00:00:00 UTC
+	feed := NewFeed64(
+		[]perspective.EventData64{
+			{ID: 1 << 40, Start: start, Run: 1500, Type: 2, Progress: 100}},
+		1)
+	var out bytes.Buffer
+	DumpEventData(context.Background(), feed, 0, start+1, -1, -1, 7, true, &out)
+	dumped := make([]int64, 7)
+	if err := binary.Read(&out, binary.LittleEndian, dumped); err != nil {
+		t.Fatal(err)
+	}
+	expected := []int64{1 << 40, start, 1500, 2, 0, 0, 100}
+	for i := range expected {
+		if dumped[i] != expected[i] {
+			t.Fatalf("Dumped %v, expected %v", dumped, expected)
+		}
+	}
+}
+
+// Reports over a feed should stop, writing nothing, once their context is done.
+func TestReportsCancelled(t *testing.T) {
+	feed := NewFeed(benchEventData())
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	reports := map[string]func(io.Writer) error{
+		"dump": func(out io.Writer) error {
+			return DumpEventData(
+				ctx, feed, benchA, benchΩ, -1, -1, 7, false, out)
+		},
+		"success-rate": func(out io.Writer) error {
+			return GetSuccessRate(ctx, feed, benchA, benchΩ, -1, -1, out)
+		},
+		"stalled": func(out io.Writer) error {
+			return ListStalledEvents(
+				ctx, feed, benchA, benchΩ, -1, -1, 10, out)
+		}}
+	for name, report := range reports {
+		var out bytes.Buffer
+		if err := report(&out); err != context.Canceled {
+			t.Errorf("Cancelled %s report returned %v.", name, err)
+		}
+		if out.Len() != 0 {
+			t.Errorf("Cancelled %s report wrote %q.", name, out.String())
+		}
+	}
+}
+
+func BenchmarkMapBinLogFile(b *testing.B) {
+	path, cleanup := writeBinLog(b, 0, benchEventData())
+	defer cleanup()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		UnmapBinLogFile(MapBinLogFile(path, 0))
+	}
+}
+
+func BenchmarkEventFilter(b *testing.B) {
+	feed := NewFeed(benchEventData())
+	var scratch perspective.EventData64
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < feed.Len(); j++ {
+			eventFilter(
+				feed.event(j, &scratch),
+				benchA,
+				benchA+int64(time.Hour),
+				1,
+				-1,
+				6)
+		}
+	}
+}
+
+func BenchmarkGeneratePNGFromBinLog(b *testing.B) {
+	feed := NewFeed(benchEventData())
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		GeneratePNGFromBinLog(
+			context.Background(),
+			feed,
+			benchA-1,
+			benchΩ,
+			-1,
+			-1,
+			7,
+			perspective.NewScatter(
+				512, 256, 32, benchA, benchΩ,
+				perspective.NewLog2Axis(16), 1, 0,
+				perspective.JitterRandom),
+			ioutil.Discard)
+	}
+}
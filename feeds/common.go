@@ -23,9 +23,9 @@ import (
 )
 
 func eventFilter(
-	event *perspective.EventData,
-	minTime int32,
-	maxTime int32,
+	event *perspective.EventData64,
+	minTime int64,
+	maxTime int64,
 	typeFilter int,
 	regionFilter int,
 	statusFilter int) bool {
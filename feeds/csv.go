@@ -24,65 +24,51 @@ import (
 	"fmt"
 	"github.com/cparo/perspective"
 	"io"
-	"log"
+	"math"
 	"os"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
+// ConvertCSVToBinary converts event data from CSV to a binary log, keeping only
+// the events which match the specified filtering criteria. Start and run times
+// are read in the given unit (in nanoseconds). Event data given in seconds is
+// written in the original binary log format unless wide output is requested,
+// and event data given in any finer unit in the high-resolution format, with
+// the unit as its resolution. Wide output should be used for any event data
+// with times beyond the 32-bit overflow of Unix epoch time in 2038. Event types
+// and regions may be given by name if a metadata file is given, which serves as
+// a dictionary of their codes: names not already in it are given new codes and
+// added to it, so each name keeps the same code across conversions. A copy of
+// the metadata is kept alongside the binary log. The CSV is laid out as
+// described by the schema file at the given path, if any, and as described by
+// DefaultCSVSchema otherwise.
 func ConvertCSVToBinary(
 	iPath string,
 	oPath string,
-	minTime int32,
-	maxTime int32,
+	minTime int64,
+	maxTime int64,
 	typeFilter int,
 	regionFilter int,
 	statusFilter int,
-	errorReasonFilterConf string) {
+	errorReasonFilterConf string,
+	metadataPath string,
+	schemaPath string,
+	timeUnit int64,
+	wide bool) {
 
-	// Initial filter is to match for the lack of an error reason string, as
-	// signified by an empty or all-whitespace string. This is implied even if
-	// we aren't given a configuration file to ensure that we minimally produce
-	// output which differentiates errors given with reasons from errors for
-	// which no explanation was provided.
-	filterString := "^\\s*$"
-	filter, err := regexp.Compile(filterString)
-	panicOnError(
-		err,
-		fmt.Sprintf("Failed to compile regex '%s'.\n", filterString))
-	errorFilters := []*regexp.Regexp{filter}
-	if errorReasonFilterConf != "" {
-		cFile, err := os.Open(errorReasonFilterConf)
-		panicOnError(err, "Failed to open error-reason filter config file.")
-		confReader := csv.NewReader(bufio.NewReader(cFile))
-		// Filter conf file is designed to look nicely tabular in plain text,
-		// so it has a pipe field delimiter and extra white space.
-		confReader.Comma = '|'
-		for {
-			fields, err := confReader.Read()
-			if atEOF(err, "Error encountered consuming filter config.") {
-				break
-			}
-			// NOTE: We ignore any fields beyond the first here. They can be
-			//       parsed out elsewhere for purposes like correlating
-			//       human-friendly textual descriptions with the numeric codes
-			//       we assign to our output. Ignoring and such additional info
-			//       here makes for one less thing that would have to be updated
-			//       if we change our minds about what should be provided along
-			//       with a list of regex filters in the error-reason filter
-			//       config.
-			if len(fields) < 1 {
-				panic("Incorrect field count in filter config.")
-			}
-			filterString = strings.TrimSpace(fields[0])
-			filter, err = regexp.Compile(filterString)
-			panicOnError(
-				err,
-				fmt.Sprintf("Failed to compile regex '%s'.\n", filterString))
-			errorFilters = append(errorFilters, filter)
-		}
-		cFile.Close()
+	errorFilters, err := LoadErrorReasonFilters(errorReasonFilterConf)
+	panicOnError(err, "Failed to load error-reason filter config.")
+
+	schema, err := LoadCSVSchema(schemaPath)
+	panicOnError(err, "Failed to load CSV schema.")
+
+	names := &Metadata{}
+	if metadataPath != "" {
+		names, err = LoadMetadata(metadataPath)
+		panicOnError(err, "Failed to load metadata.")
 	}
 
 	iFile, err := os.Open(iPath)
@@ -93,94 +79,330 @@ func ConvertCSVToBinary(
 	panicOnError(err, "Failed to open output file for writing.")
 	defer oFile.Close()
 
-	csvReader := csv.NewReader(bufio.NewReader(iFile))
 	binWriter := bufio.NewWriter(oFile)
+	_, err = ConvertCSV(
+		bufio.NewReader(iFile),
+		binWriter,
+		schema,
+		&Filter{minTime, maxTime, typeFilter, regionFilter, statusFilter},
+		errorFilters,
+		names,
+		metadataPath != "",
+		timeUnit,
+		wide)
+	panicOnError(err, "Error encountered converting CSV input.")
+	panicOnError(binWriter.Flush(), "Error flushing data to binary log.")
+
+	if metadataPath != "" {
+		panicOnError(names.Write(metadataPath), "Failed to write metadata.")
+		if metadataPath != MetadataPath(oPath) {
+			err = names.Write(MetadataPath(oPath))
+			panicOnError(err, "Failed to write metadata for binary log.")
+		}
+	}
+}
+
+// LoadErrorReasonFilters reads the regular expressions used to classify the
+// error reasons of failed events into status codes from the given error-reason
+// filter config file. The first filter, which is implied even without a config
+// file (so the path may be empty), matches a blank error reason.
+func LoadErrorReasonFilters(path string) ([]*regexp.Regexp, error) {
+
+	// Initial filter is to match for the lack of an error reason string, as
+	// signified by an empty or all-whitespace string. This is implied even if
+	// we aren't given a configuration file to ensure that we minimally produce
+	// output which differentiates errors given with reasons from errors for
+	// which no explanation was provided.
+	errorFilters := []*regexp.Regexp{regexp.MustCompile("^\\s*$")}
+	if path == "" {
+		return errorFilters, nil
+	}
+
+	cFile, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer cFile.Close()
+	confReader := csv.NewReader(bufio.NewReader(cFile))
+	// Filter conf file is designed to look nicely tabular in plain text, so it
+	// has a pipe field delimiter and extra white space.
+	confReader.Comma = '|'
+	confReader.FieldsPerRecord = -1
+	for {
+		fields, err := confReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		// NOTE: We ignore any fields beyond the first here. They can be parsed
+		//       out elsewhere for purposes like correlating human-friendly
+		//       textual descriptions with the numeric codes we assign to our
+		//       output. Ignoring and such additional info here makes for one
+		//       less thing that would have to be updated if we change our
+		//       minds about what should be provided along with a list of regex
+		//       filters in the error-reason filter config.
+		filterString := strings.TrimSpace(fields[0])
+		filter, err := regexp.Compile(filterString)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"failed to compile regex '%s': %v", filterString, err)
+		}
+		errorFilters = append(errorFilters, filter)
+	}
+	return errorFilters, nil
+}
+
+// ConvertCSV reads event data as CSV laid out as described by the given schema
+// (or the default schema, if it is nil) from r and writes it to w as a binary
+// log, as ConvertCSVToBinary does, keeping only the events which match the
+// given filter (or all events, if it is nil) and classifying the error reasons
+// of failed events with the given error-reason filters. Start times may be
+// given in the time unit since the Unix epoch or as RFC 3339 timestamps. Event
+// types and regions may be given by the names in the given metadata (if any)
+// as well as by their codes, with names not in the metadata added to it with
+// new codes if assign is set (and rejected otherwise). New names are not given
+// codes which the data gives as numbers earlier in the same column, and a code
+// given as a number after being assigned to a name is rejected. It returns the
+// number of events written, or an error naming the record at fault if any of
+// the input is malformed.
+func ConvertCSV(
+	r io.Reader,
+	w io.Writer,
+	schema *CSVSchema,
+	filter *Filter,
+	errorFilters []*regexp.Regexp,
+	names *Metadata,
+	assign bool,
+	timeUnit int64,
+	wide bool) (int, error) {
+
+	if schema == nil {
+		schema = DefaultCSVSchema()
+	}
+	if err := schema.validate(); err != nil {
+		return 0, err
+	}
+	if names == nil {
+		names = &Metadata{}
+	}
+	if assign && names.Types == nil {
+		names.Types = make(Names)
+	}
+	if assign && names.Regions == nil {
+		names.Regions = make(Names)
+	}
+
+	// The codes given in each column are tracked when assigning codes to new
+	// names, so that no name is given a code the data also gives as a number.
+	var typeCodes, regionCodes *codeUse
+	if assign {
+		typeCodes, regionCodes = &codeUse{}, &codeUse{}
+	}
+
+	csvReader := csv.NewReader(r)
+	csvReader.Comma = schema.Delimiter
+	csvReader.FieldsPerRecord = -1
+
+	// Times given in whole seconds fit the original binary log format, which
+	// remains the more compact and more widely-readable choice for them. The
+	// IDs and times are range-checked against the width of their fields in the
+	// output format.
+	highResolution := wide || timeUnit != int64(time.Second)
+	fieldBits := 32
+	if highResolution {
+		fieldBits = 64
+		if err := writeHeader(w, timeUnit); err != nil {
+			return 0, err
+		}
+	}
+
+	// Columns are resolved up front unless they are named in a header, which
+	// then also fixes the number of fields in each record (unless the schema
+	// does).
+	var (
+		columns  []int
+		needed   int
+		expected = schema.Fields
+	)
+	if !schema.Header {
+		columns, needed, _ = schema.resolve(nil)
+	}
 
 	var (
-		eventData     perspective.EventData
+		eventData     perspective.EventData64
 		signedValue   int64
 		unsignedValue uint64
+		written       int
 	)
 
-	for {
+	for record := 1; ; record++ {
 
 		fields, err := csvReader.Read()
-		if atEOF(err, "Error encountered consuming CSV input.") {
+		if err == io.EOF {
 			break
 		}
-		// INPUT FIELDS:
-		// 0) event_id
-		// 1) event_type_id
-		// 2) event_start_time (in seconds since UNIX epoch)
-		// 3) event_run_time (in seconds)
-		// 4) exit_status (success if 0, >0 for failure, <0 for in-progress)
-		// 5) event_region (region identifier)
-		// 6) event_progress (percentage value)
-		// 7) errror_reason (text field)
-		if len(fields) != 8 {
-			panic("Incorrect field count in filter config.")
-		}
-
-		unsignedValue, err = strconv.ParseUint(fields[1], 10, 8)
-		panicOnError(err, "Error encountered parsing event type.")
-		eventData.Type = uint8(unsignedValue)
-
-		signedValue, err = strconv.ParseInt(fields[2], 10, 32)
-		panicOnError(err, "Error encountered parsing event start time.")
-		eventData.Start = int32(signedValue)
-
-		if eventFilter(
-			&eventData,
-			minTime,
-			maxTime,
-			typeFilter,
-			regionFilter,
-			statusFilter) {
-
-			signedValue, err = strconv.ParseInt(fields[0], 10, 32)
-			panicOnError(err, "Error encountered parsing event ID.")
-			eventData.ID = int32(signedValue)
-
-			signedValue, err = strconv.ParseInt(fields[3], 10, 32)
-			panicOnError(err, "Error encountered parsing event run time.")
-			eventData.Run = int32(signedValue)
-
-			signedValue, err = strconv.ParseInt(fields[4], 10, 8)
-			panicOnError(err, "Error encountered parsing event status.")
-			if signedValue > 0 {
-				eventData.Status = getErrorCode(fields[7], errorFilters)
-			} else {
-				// Event is successful (0) or in-progress (negative)
-				eventData.Status = int8(signedValue)
+		if err != nil {
+			return written, err
+		}
+		malformed := func(field string, err error) error {
+			return fmt.Errorf("record %d: malformed %s: %v", record, field, err)
+		}
+
+		if columns == nil {
+			columns, needed, err = schema.resolve(fields)
+			if err != nil {
+				return written, fmt.Errorf("record %d: %v", record, err)
+			}
+			if expected == 0 {
+				expected = len(fields)
+			}
+			if needed > expected {
+				return written, fmt.Errorf(
+					"record %d: %d columns in header, expected at least %d",
+					record,
+					len(fields),
+					needed)
 			}
+			continue
+		}
+
+		switch {
+		case expected > 0 && len(fields) != expected:
+			return written, fmt.Errorf(
+				"record %d: %d fields, expected %d",
+				record,
+				len(fields),
+				expected)
+		case len(fields) < needed:
+			return written, fmt.Errorf(
+				"record %d: %d fields, expected at least %d",
+				record,
+				len(fields),
+				needed)
+		}
 
-			unsignedValue, err = strconv.ParseUint(fields[5], 10, 8)
-			panicOnError(err, "Error encountered parsing event region.")
-			eventData.Region = uint8(unsignedValue)
+		// Fields with no column, or left blank, take their default values.
+		value := func(field int) string {
+			var v string
+			if columns[field] >= 0 {
+				v = fields[columns[field]]
+			}
+			if v == "" {
+				if d, exists := schema.defaultValue(csvFields[field]); exists {
+					return d
+				}
+			}
+			return v
+		}
 
-			unsignedValue, err = strconv.ParseUint(fields[6], 10, 8)
-			panicOnError(err, "Error encountered parsing event progress.")
-			eventData.Progress = uint8(unsignedValue)
+		eventData.Type, err = names.Types.parse(value(fieldType), typeCodes)
+		if err != nil {
+			return written, malformed("event type", err)
+		}
+
+		eventData.Start, err = parseTimestamp(
+			value(fieldStart), fieldBits, timeUnit)
+		if err != nil {
+			return written, malformed("event start time", err)
+		}
+
+		eventData.ID, err = strconv.ParseInt(value(fieldID), 10, fieldBits)
+		if err != nil {
+			return written, malformed("event ID", err)
+		}
 
-			panicOnError(
-				binary.Write(binWriter, binary.LittleEndian, eventData),
-				"Error writing event data to binary log.")
+		eventData.Run, err = parseTime(value(fieldRun), fieldBits, timeUnit)
+		if err != nil {
+			return written, malformed("event run time", err)
 		}
+
+		signedValue, err = strconv.ParseInt(value(fieldStatus), 10, 8)
+		if err != nil {
+			return written, malformed("event status", err)
+		}
+		if signedValue > 0 {
+			eventData.Status = getErrorCode(value(fieldReason), errorFilters)
+		} else {
+			// Event is successful (0) or in-progress (negative)
+			eventData.Status = int8(signedValue)
+		}
+
+		eventData.Region, err = names.Regions.parse(
+			value(fieldRegion), regionCodes)
+		if err != nil {
+			return written, malformed("event region", err)
+		}
+
+		unsignedValue, err = strconv.ParseUint(value(fieldProgress), 10, 8)
+		if err != nil {
+			return written, malformed("event progress", err)
+		}
+		eventData.Progress = uint8(unsignedValue)
+
+		if filter != nil && !filter.match(&eventData) {
+			continue
+		}
+
+		if highResolution {
+			err = binary.Write(w, binary.LittleEndian, eventData)
+		} else {
+			err = binary.Write(
+				w,
+				binary.LittleEndian,
+				perspective.EventData{
+					ID:       int32(eventData.ID),
+					Start:    int32(eventData.Start / timeUnit),
+					Run:      int32(eventData.Run / timeUnit),
+					Type:     eventData.Type,
+					Status:   eventData.Status,
+					Region:   eventData.Region,
+					Progress: eventData.Progress})
+		}
+		if err != nil {
+			return written, err
+		}
+		written++
 	}
 
-	panicOnError(binWriter.Flush(), "Error flushing data to binary log.")
+	return written, nil
 }
 
-func atEOF(err error, message string) bool {
+// Parses a time value given in the specified unit, checking that it fits in the
+// given number of bits in that unit, and returns it in nanoseconds.
+func parseTime(value string, bits int, unit int64) (int64, error) {
+	t, err := strconv.ParseInt(value, 10, bits)
 	if err != nil {
-		if err == io.EOF {
-			return true
-		}
-		log.Println(message)
+		return 0, err
+	}
+	if t > math.MaxInt64/unit || t < math.MinInt64/unit {
+		return 0, fmt.Errorf("time out of range: \"%s\"", value)
+	}
+	return t * unit, nil
+}
 
-		panic(err)
+// Parses a point in time given either in the specified unit since the Unix
+// epoch or as an RFC 3339 timestamp (which is truncated to the unit), checking
+// that it fits in the given number of bits in that unit, and returns it in
+// nanoseconds since the epoch.
+func parseTimestamp(value string, bits int, unit int64) (int64, error) {
+	if !strings.ContainsAny(value, "T:") {
+		return parseTime(value, bits, unit)
+	}
+	timestamp, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return 0, err
+	}
+	// Nanoseconds since the epoch only reach years 1678 through 2262.
+	if year := timestamp.Year(); year < 1678 || year > 2261 {
+		return 0, fmt.Errorf("time out of range: \"%s\"", value)
+	}
+	t := timestamp.UnixNano() / unit
+	if bits < 64 && (t >= 1<<uint(bits-1) || t < -1<<uint(bits-1)) {
+		return 0, fmt.Errorf("time out of range: \"%s\"", value)
 	}
-	return false
+	return t * unit, nil
 }
 
 func getErrorCode(errorReason string, errorFilters []*regexp.Regexp) int8 {
@@ -0,0 +1,219 @@
+// Perspective: Graphing library for quality control in event-driven systems
+
+// Copyright (C) 2016 Christian Paro <christian.paro@gmail.com>,
+//                                   <cparo@digitalocean.com>
+
+// This program is free software: you can redistribute it and/or modify it under
+// the terms of the GNU General Public License version 2 as published by the
+// Free Software Foundation.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+
+// You should have received a copy of the GNU General Public License along with
+// this program. If not, see <http://www.gnu.org/licenses/>.
+
+package feeds
+
+import (
+	"bytes"
+	"github.com/cparo/perspective"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testCSV = `1,2,1470659696789,1500,0,3,100,
+2,1,1470659697001,250,1,3,50,timeout
+`
+
+// Converts the given CSV with times in the given unit into a binary log in the
+// given directory, and returns the mapped binary log.
+func convertTestCSV(
+	t *testing.T,
+	dir string,
+	data string,
+	unit time.Duration,
+	wide bool) *Feed {
+
+	iPath := filepath.Join(dir, "feed.csv")
+	oPath := filepath.Join(dir, "feed.dat")
+	if err := ioutil.WriteFile(iPath, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ConvertCSVToBinary(
+		iPath, oPath, 0, 1<<62, -1, -1, 7, "", "", "", int64(unit), wide)
+	feed := MapBinLogFile(oPath, 0)
+	if feed == nil {
+		t.Fatal("Failed to map converted binary log.")
+	}
+	return feed
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "perspective")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestConvertCSVToBinaryHighResolution(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	feed := convertTestCSV(t, dir, testCSV, time.Millisecond, false)
+	defer UnmapBinLogFile(feed)
+	if !feed.HighResolution() || feed.Resolution() != int64(time.Millisecond) {
+		t.Fatal("Converted binary log is not at millisecond resolution.")
+	}
+	expected := []perspective.EventData64{
+		{ID: 1, Start: 1470659696789 * 1e6, Run: 1500 * 1e6, Type: 2,
+			Status: 0, Region: 3, Progress: 100},
+		{ID: 2, Start: 1470659697001 * 1e6, Run: 250 * 1e6, Type: 1,
+			Status: 2, Region: 3, Progress: 50}}
+	if feed.Len() != len(expected) {
+		t.Fatalf("Converted %d events, expected %d", feed.Len(), len(expected))
+	}
+	var scratch perspective.EventData64
+	for i := range expected {
+		if e := feed.event(i, &scratch); *e != expected[i] {
+			t.Errorf("Event %d converted as %+v, expected %+v",
+				i, *e, expected[i])
+		}
+	}
+}
+
+// Times in seconds which don't fit the original format should be rejected
+// rather than silently truncated.
+func TestConvertCSVToBinaryRejectsOverflow(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	defer func() {
+		if recover() == nil {
+			t.Error("Conversion of out-of-range times did not fail.")
+		}
+	}()
+	UnmapBinLogFile(convertTestCSV(t, dir, testCSV, time.Second, false))
+}
+
+// Times in seconds beyond 2038 can be converted to a wide binary log.
+func TestConvertCSVToBinaryWide(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	feed := convertTestCSV(
+		t, dir, "1,2,4102444800,1500,0,3,100,\n", time.Second, true)
+	defer UnmapBinLogFile(feed)
+	if !feed.HighResolution() || feed.Resolution() != int64(time.Second) {
+		t.Fatal("Converted binary log is not 64-bit at second resolution.")
+	}
+	var scratch perspective.EventData64
+	if feed.event(0, &scratch).Start != 4102444800*int64(time.Second) {
+		t.Errorf("Start time converted as %d", feed.event(0, &scratch).Start)
+	}
+}
+
+func TestConvertCSV(t *testing.T) {
+	var out bytes.Buffer
+	n, err := ConvertCSV(
+		strings.NewReader(testCSV),
+		&out,
+		nil,
+		nil,
+		[]*regexp.Regexp{regexp.MustCompile(`^\s*$`)},
+		nil,
+		false,
+		int64(time.Millisecond),
+		false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 || out.Len() != feedHeaderSize+2*32 {
+		t.Errorf("Converted %d events into %d bytes", n, out.Len())
+	}
+}
+
+// Filters apply to the status of each event itself, so only the failed event
+// is kept when filtering for failures.
+func TestConvertCSVFilter(t *testing.T) {
+	var out bytes.Buffer
+	n, err := ConvertCSV(
+		strings.NewReader(testCSV),
+		&out,
+		nil,
+		&Filter{0, 1 << 62, -1, -1, 2},
+		nil,
+		nil,
+		false,
+		int64(time.Millisecond),
+		false)
+	if err != nil || n != 1 {
+		t.Errorf("Converted %d events with filter: %v", n, err)
+	}
+}
+
+// Malformed input is reported with the record at fault, rather than panicking.
+func TestConvertCSVMalformed(t *testing.T) {
+	cases := []struct {
+		input  string
+		reason string
+	}{
+		{"1,2,3,4,0,3,100\n", "record 1: 7 fields"},
+		{"1,2,x,4,0,3,100,\n", "record 1: malformed event start time"},
+		{"1,256,3,4,0,3,100,\n", "record 1: malformed event type"},
+		{"1,2,3,4,0,nyc3,100,\n", "record 1: malformed event region"},
+		{"1,2,3,4,0,3,full,\n", "record 1: malformed event progress"},
+		{"1,2,3,4,failed,3,100,\n", "record 1: malformed event status"},
+		{"1,2,9999999999,4,0,3,0,\n", "record 1: malformed event start"},
+		{"id,type,start,run,s,r,p,e\n", "record 1: malformed event type"},
+		{"1,2,3,4,0,3,100,\n1,2,3,4,0,3,100,x,y\n", "record 2: 9 fields"},
+		{"1,2,3,4,0,3,100,\n1,2,3,4,0,3,100,\"x\n", "line 2"}}
+	for _, c := range cases {
+		_, err := ConvertCSV(
+			strings.NewReader(c.input),
+			ioutil.Discard,
+			nil,
+			nil,
+			nil,
+			nil,
+			false,
+			int64(time.Second),
+			false)
+		if err == nil || !strings.Contains(err.Error(), c.reason) {
+			t.Errorf("%q: error %v, expected %q", c.input, err, c.reason)
+		}
+	}
+}
+
+func TestLoadErrorReasonFilters(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "errors.conf")
+	conf := "timeout    | Timed out\ndisk.*full | Out of disk\n"
+	if err := ioutil.WriteFile(path, []byte(conf), 0644); err != nil {
+		t.Fatal(err)
+	}
+	filters, err := LoadErrorReasonFilters(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes := map[string]int8{"": 1, "timeout": 2, "disk is full": 3, "?": 4}
+	for reason, code := range codes {
+		if c := getErrorCode(reason, filters); c != code {
+			t.Errorf("Error reason %q classified as %d, expected %d",
+				reason, c, code)
+		}
+	}
+
+	if err := ioutil.WriteFile(path, []byte("(unclosed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadErrorReasonFilters(path); err == nil {
+		t.Error("Malformed error-reason filter accepted.")
+	}
+}
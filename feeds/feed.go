@@ -0,0 +1,127 @@
+// Perspective: Graphing library for quality control in event-driven systems
+
+// Copyright (C) 2016 Christian Paro <christian.paro@gmail.com>,
+//                                   <cparo@digitalocean.com>
+
+// This program is free software: you can redistribute it and/or modify it under
+// the terms of the GNU General Public License version 2 as published by the
+// Free Software Foundation.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+
+// You should have received a copy of the GNU General Public License along with
+// this program. If not, see <http://www.gnu.org/licenses/>.
+
+package feeds
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/cparo/perspective"
+	"io"
+	"time"
+)
+
+// Magic number identifying a binary log in the high-resolution format. Binary
+// logs in the original format have no header, and are identified by the lack of
+// this magic number at the start of the file.
+const feedMagic = "PSPCTV64"
+
+// Size, in bytes, of the header of a binary log in the high-resolution format:
+// the magic number, the resolution at which run times were measured (as a
+// little-endian int64 count of nanoseconds), and space reserved for later use.
+// This is a multiple of the record size so records stay aligned within pages.
+const feedHeaderSize = 32
+
+// Feed holds the event data from a binary log, in either the original format
+// (with 32-bit times in seconds) or the high-resolution format (with 64-bit
+// times in nanoseconds).
+type Feed struct {
+	mapping    []byte                    // Memory-mapped binary log, if any
+	events     []perspective.EventData   // Events in the original format
+	events64   []perspective.EventData64 // Events in high-resolution format
+	resolution int64                     // Resolution of run times, in ns
+	names      *Metadata                 // Names of event types and regions
+}
+
+// NewFeed returns a feed holding the given events in the original format.
+func NewFeed(events []perspective.EventData) *Feed {
+	return &Feed{nil, events, nil, int64(time.Second), nil}
+}
+
+// NewFeed64 returns a feed holding the given events in the high-resolution
+// format, with run times measured at the given resolution in nanoseconds.
+func NewFeed64(events []perspective.EventData64, resolution int64) *Feed {
+	return &Feed{nil, nil, events, resolution, nil}
+}
+
+// Len returns the number of events in the feed.
+func (f *Feed) Len() int {
+	if f.events64 != nil {
+		return len(f.events64)
+	}
+	return len(f.events)
+}
+
+// HighResolution reports whether the feed is in the high-resolution format.
+func (f *Feed) HighResolution() bool {
+	return f.events64 != nil
+}
+
+// Resolution returns the resolution, in nanoseconds, at which the run times of
+// the events in the feed were measured.
+func (f *Feed) Resolution() int64 {
+	return f.resolution
+}
+
+// Names returns the names of the event types and regions in the feed, which
+// are empty unless set with SetNames.
+func (f *Feed) Names() *Metadata {
+	if f.names == nil {
+		return &Metadata{}
+	}
+	return f.names
+}
+
+// SetNames sets the names of the event types and regions in the feed.
+func (f *Feed) SetNames(names *Metadata) {
+	f.names = names
+}
+
+// Returns a pointer to the high-resolution form of the event at the given
+// index. Events in the original format are widened into the given scratch
+// space, so the result is only valid until the next call with the same scratch
+// space, and should not be modified.
+func (f *Feed) event(
+	i int,
+	scratch *perspective.EventData64) *perspective.EventData64 {
+
+	if f.events64 != nil {
+		return &f.events64[i]
+	}
+	f.events[i].Widen(scratch)
+	return scratch
+}
+
+// Writes the header for a binary log in the high-resolution format, with the
+// given resolution in nanoseconds.
+func writeHeader(w io.Writer, resolution int64) error {
+	header := make([]byte, feedHeaderSize)
+	copy(header, feedMagic)
+	binary.LittleEndian.PutUint64(header[len(feedMagic):], uint64(resolution))
+	_, err := w.Write(header)
+	return err
+}
+
+// Reads the header from the start of a binary log, returning the resolution it
+// specifies, or 0 if the log is not in the high-resolution format.
+func readHeader(header []byte) int64 {
+	if len(header) < feedHeaderSize ||
+		!bytes.Equal(header[:len(feedMagic)], []byte(feedMagic)) {
+		return 0
+	}
+	return int64(binary.LittleEndian.Uint64(header[len(feedMagic):]))
+}
@@ -0,0 +1,225 @@
+// Perspective: Graphing library for quality control in event-driven systems
+
+// Copyright (C) 2016 Christian Paro <christian.paro@gmail.com>,
+//                                   <cparo@digitalocean.com>
+
+// This program is free software: you can redistribute it and/or modify it under
+// the terms of the GNU General Public License version 2 as published by the
+// Free Software Foundation.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+
+// You should have received a copy of the GNU General Public License along with
+// this program. If not, see <http://www.gnu.org/licenses/>.
+
+package feeds
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/cparo/perspective"
+	"os"
+	"time"
+	"unicode/utf8"
+	"unsafe"
+)
+
+// Format identifies the format of a feed, as stored or as uploaded.
+type Format int
+
+const (
+	FormatBinLog   Format = iota // Binary log in the original format
+	FormatBinLog64               // Binary log in the high-resolution format
+	FormatCSV                    // CSV event data, to be converted
+)
+
+var formatNames = map[Format]string{
+	FormatBinLog:   "binlog",
+	FormatBinLog64: "binlog64",
+	FormatCSV:      "csv"}
+
+func (f Format) String() string {
+	return formatNames[f]
+}
+
+// Number of leading bytes of a feed examined by DetectFormat.
+const DetectFormatBytes = 512
+
+// DetectFormat identifies the format of a feed from its leading bytes (up to
+// DetectFormatBytes of them). Binary logs in the high-resolution format are
+// identified by their header, and CSV by consisting entirely of text, as the
+// fixed-width fields of binary logs are all but certain to hold zero bytes or
+// other control characters. Anything else is taken to be a binary log in the
+// original format.
+func DetectFormat(head []byte) Format {
+	if bytes.HasPrefix(head, []byte(feedMagic)) {
+		return FormatBinLog64
+	}
+	if len(head) > DetectFormatBytes {
+		head = head[:DetectFormatBytes]
+	}
+	if len(head) == 0 {
+		return FormatBinLog
+	}
+	for len(head) > 0 {
+		r, size := utf8.DecodeRune(head)
+		if r == utf8.RuneError && size == 1 {
+			// A multi-byte character may be cut off at the end of the bytes
+			// examined, without making the feed any less likely to be text.
+			if len(head) < utf8.UTFMax && !utf8.FullRune(head) {
+				break
+			}
+			return FormatBinLog
+		}
+		if r < ' ' && r != '\t' && r != '\n' && r != '\r' || r == 0x7f {
+			return FormatBinLog
+		}
+		head = head[size:]
+	}
+	return FormatCSV
+}
+
+// Summary describes the events in a binary log.
+type Summary struct {
+	Format     string `json:"format"`     // Format of the binary log
+	Size       int64  `json:"size"`       // Size, in bytes
+	Records    int    `json:"records"`    // Number of events
+	Resolution int64  `json:"resolution"` // Resolution of times, in ns
+	MinStart   int64  `json:"min_start"`  // Earliest start time, in ns
+	MaxStart   int64  `json:"max_start"`  // Latest start time, in ns
+	Types      []int  `json:"types"`      // Distinct event types
+	Regions    []int  `json:"regions"`    // Distinct event regions
+}
+
+// InspectBinLog checks that the file at the given path is a well-formed binary
+// log, made up of a valid header (if in the high-resolution format) and whole
+// records with plausible values, and returns a summary of the events in it. If
+// the context is done before all records have been checked, the context's error
+// is returned.
+func InspectBinLog(ctx context.Context, path string) (*Summary, error) {
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	head := make([]byte, feedHeaderSize)
+	n, _ := file.ReadAt(head, 0)
+	file.Close()
+
+	summary := &Summary{Size: info.Size(), Types: []int{}, Regions: []int{}}
+	headerSize := int64(0)
+	eventSize := int64(unsafe.Sizeof(perspective.EventData{}))
+	if DetectFormat(head[:n]) == FormatBinLog64 {
+		summary.Format = FormatBinLog64.String()
+		headerSize = feedHeaderSize
+		eventSize = int64(unsafe.Sizeof(perspective.EventData64{}))
+		if summary.Size < headerSize {
+			return nil, errors.New("truncated header")
+		}
+		summary.Resolution = readHeader(head)
+		if summary.Resolution <= 0 {
+			return nil, errors.New("invalid resolution in header")
+		}
+	} else {
+		summary.Format = FormatBinLog.String()
+		summary.Resolution = int64(time.Second)
+	}
+	if (summary.Size-headerSize)%eventSize != 0 {
+		return nil, fmt.Errorf(
+			"%d bytes of records is not a whole number of %d-byte records",
+			summary.Size-headerSize,
+			eventSize)
+	}
+
+	summary.Records = int((summary.Size - headerSize) / eventSize)
+	if summary.Records == 0 {
+		return summary, nil
+	}
+
+	feed := MapBinLogFile(path, 0)
+	if feed == nil {
+		return nil, errors.New("failed to map binary log")
+	}
+	defer UnmapBinLogFile(feed)
+
+	var types, regions [256]bool
+	var scratch perspective.EventData64
+	for i := 0; i < feed.Len(); i++ {
+		if i%cancelCheckEvents == 0 && ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		e := feed.event(i, &scratch)
+		if e.Run < 0 {
+			return nil, fmt.Errorf("record %d: negative run time", i+1)
+		}
+		if e.Progress > 100 {
+			return nil, fmt.Errorf(
+				"record %d: progress of %d%%", i+1, e.Progress)
+		}
+		if i == 0 || e.Start < summary.MinStart {
+			summary.MinStart = e.Start
+		}
+		if i == 0 || e.Start > summary.MaxStart {
+			summary.MaxStart = e.Start
+		}
+		types[e.Type], regions[e.Region] = true, true
+	}
+	for i := range types {
+		if types[i] {
+			summary.Types = append(summary.Types, i)
+		}
+		if regions[i] {
+			summary.Regions = append(summary.Regions, i)
+		}
+	}
+
+	return summary, nil
+}
+
+// FeedInfo describes a feed: its name, when it was last modified, and either
+// the events in it or (if it is malformed) why they could not be described.
+type FeedInfo struct {
+	Name     string    `json:"name"`     // Name of the feed
+	Modified time.Time `json:"modified"` // Time of last modification
+	*Summary
+	Names *Metadata `json:"names,omitempty"` // Names of types and regions
+	Error string    `json:"error,omitempty"` // Fault found in the feed, if any
+}
+
+// DescribeBinLog returns a description of the binary log at the given path,
+// under the given name, along with the names from its metadata. An error is
+// only returned if the file can't be found or examined, or if the context is
+// done before it has been read, with any fault in its content given in the
+// description.
+func DescribeBinLog(
+	ctx context.Context,
+	path string,
+	name string) (*FeedInfo, error) {
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	info := &FeedInfo{Name: name, Modified: stat.ModTime().UTC()}
+	info.Summary, err = InspectBinLog(ctx, path)
+	if err != nil && err == ctx.Err() {
+		return nil, err
+	}
+	if err == nil {
+		info.Names, err = LoadMetadata(MetadataPath(path))
+	}
+	if err != nil {
+		info.Error = err.Error()
+	}
+	return info, nil
+}
@@ -0,0 +1,137 @@
+// Perspective: Graphing library for quality control in event-driven systems
+
+// Copyright (C) 2016 Christian Paro <christian.paro@gmail.com>,
+//                                   <cparo@digitalocean.com>
+
+// This program is free software: you can redistribute it and/or modify it under
+// the terms of the GNU General Public License version 2 as published by the
+// Free Software Foundation.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+
+// You should have received a copy of the GNU General Public License along with
+// this program. If not, see <http://www.gnu.org/licenses/>.
+
+package feeds
+
+import (
+	"context"
+	"github.com/cparo/perspective"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDetectFormat(t *testing.T) {
+	header := make([]byte, feedHeaderSize)
+	copy(header, feedMagic)
+	cases := []struct {
+		head   string
+		format Format
+	}{
+		{"", FormatBinLog},
+		{string(header), FormatBinLog64},
+		{"\x01\x00\x00\x00\x57\xa8\x9b\x70", FormatBinLog},
+		{testCSV, FormatCSV},
+		{"1,2,3,4,0,3,100,\"disk full\"\r\n", FormatCSV},
+		{"1,2,3,4,1,3,100,délai dépassé\n", FormatCSV},
+		// Text cut off partway through a multi-byte character is still text.
+		{strings.Repeat("a", DetectFormatBytes-1) + "é", FormatCSV},
+		{"1,2,3\x00", FormatBinLog}}
+	for _, c := range cases {
+		if format := DetectFormat([]byte(c.head)); format != c.format {
+			t.Errorf("%q detected as %v, expected %v", c.head, format, c.format)
+		}
+	}
+}
+
+func TestInspectBinLog(t *testing.T) {
+	events := benchEventData()[:1000]
+	path, cleanup := writeBinLog(t, 0, events)
+	defer cleanup()
+
+	summary, err := InspectBinLog(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &Summary{
+		Format:     "binlog",
+		Size:       16 * 1000,
+		Records:    1000,
+		Resolution: int64(time.Second),
+		MinStart:   int64(events[0].Start) * int64(time.Second),
+		MaxStart:   int64(events[999].Start) * int64(time.Second),
+		Types:      []int{0, 1, 2, 3},
+		Regions:    []int{0, 1, 2}}
+	if !reflect.DeepEqual(summary, expected) {
+		t.Errorf("Summary %+v, expected %+v", summary, expected)
+	}
+}
+
+func TestInspectBinLogHighResolution(t *testing.T) {
+	events := highResolutionEvents(100)
+	path, cleanup := writeBinLog(t, int64(time.Millisecond), events)
+	defer cleanup()
+
+	summary, err := InspectBinLog(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Format != "binlog64" || summary.Records != 100 ||
+		summary.Resolution != int64(time.Millisecond) ||
+		summary.MaxStart != events[99].Start {
+		t.Errorf("Summary %+v", summary)
+	}
+}
+
+func TestInspectBinLogEmpty(t *testing.T) {
+	path, cleanup := writeBinLog(t, 0, []perspective.EventData{})
+	defer cleanup()
+
+	summary, err := InspectBinLog(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Records != 0 || summary.Resolution != int64(time.Second) {
+		t.Errorf("Summary %+v", summary)
+	}
+}
+
+func TestInspectBinLogMalformed(t *testing.T) {
+	header := make([]byte, feedHeaderSize)
+	copy(header, feedMagic)
+	valid := make([]byte, feedHeaderSize)
+	copy(valid, feedMagic)
+	valid[len(feedMagic)] = 1
+	badProgress := make([]byte, 16)
+	badProgress[15] = 101
+	negativeRun := make([]byte, 16)
+	negativeRun[11] = 0x80
+	cases := map[string]string{
+		"misaligned":          string(make([]byte, 20)),
+		"misaligned high-res": string(valid) + string(make([]byte, 40)),
+		"truncated header":    feedMagic,
+		"zero resolution":     string(header),
+		"progress over 100":   string(make([]byte, 16)) + string(badProgress),
+		"negative run time":   string(negativeRun),
+		"csv":                 testCSV}
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	for name, content := range cases {
+		path := filepath.Join(dir, "feed.dat")
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		summary, err := InspectBinLog(context.Background(), path)
+		if err == nil {
+			t.Errorf("%s binary log accepted: %+v", name, summary)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+// Perspective: Graphing library for quality control in event-driven systems
+
+// Copyright (C) 2016 Christian Paro <christian.paro@gmail.com>,
+//                                   <cparo@digitalocean.com>
+
+// This program is free software: you can redistribute it and/or modify it under
+// the terms of the GNU General Public License version 2 as published by the
+// Free Software Foundation.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+
+// You should have received a copy of the GNU General Public License along with
+// this program. If not, see <http://www.gnu.org/licenses/>.
+
+package feeds
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Extension of the file holding the metadata for a feed, alongside its binary
+// log (so "nyc3.dat" has its metadata in "nyc3.meta.json").
+const metadataExtension = ".meta.json"
+
+// Names maps the codes of event types or regions to their names.
+type Names map[uint8]string
+
+// Metadata holds the names of the event types and regions in a feed, given in
+// JSON as in {"types": {"7": "snapshot"}, "regions": {"3": "nyc3"}}.
+type Metadata struct {
+	Types   Names `json:"types,omitempty"`   // Names of event types
+	Regions Names `json:"regions,omitempty"` // Names of event regions
+}
+
+// Name returns the name for the given code, or an empty string if it has none.
+func (n Names) Name(code uint8) string {
+	return n[code]
+}
+
+// Code returns the code with the given name, if there is one.
+func (n Names) Code(name string) (uint8, bool) {
+	for code, candidate := range n {
+		if candidate == name {
+			return code, true
+		}
+	}
+	return 0, false
+}
+
+// Parse parses a code given either as a number or by its name.
+func (n Names) Parse(value string) (uint8, error) {
+	return n.parse(value, nil)
+}
+
+// Codes seen in a column of event data as it is read, so that names in it with
+// no code are not assigned one which the column also gives as a number.
+type codeUse struct {
+	numeric  [math.MaxUint8 + 1]bool // Codes given as numbers
+	assigned [math.MaxUint8 + 1]bool // Codes assigned to names
+}
+
+// Parses a code given either as a number or by its name. If the use of codes in
+// the column being read is given, a name with no code is given the lowest code
+// which has no name and has not been given as a number, and a code given as a
+// number after being assigned to a name is rejected. The names must not be nil
+// for a code to be assigned.
+func (n Names) parse(value string, use *codeUse) (uint8, error) {
+	code, err := strconv.ParseUint(value, 10, 8)
+	if err == nil {
+		if use != nil && use.assigned[code] {
+			return 0, fmt.Errorf(
+				"code %d already assigned to \"%s\"", code, n[uint8(code)])
+		}
+		if use != nil {
+			use.numeric[code] = true
+		}
+		return uint8(code), nil
+	}
+	if err.(*strconv.NumError).Err == strconv.ErrRange {
+		return 0, err
+	}
+
+	// Numbers which are not plain codes, like "+5" or "-1", are not taken as
+	// names either, as they would be rejected as names on loading.
+	if _, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return 0, fmt.Errorf("invalid code \"%s\"", value)
+	}
+	if code, exists := n.Code(value); exists {
+		return code, nil
+	}
+	if use == nil {
+		return 0, fmt.Errorf("unknown name \"%s\"", value)
+	}
+	if strings.TrimSpace(value) == "" {
+		return 0, fmt.Errorf("blank name")
+	}
+	for code := 0; code <= math.MaxUint8; code++ {
+		if _, named := n[uint8(code)]; !named && !use.numeric[code] {
+			n[uint8(code)] = value
+			use.assigned[code] = true
+			return uint8(code), nil
+		}
+	}
+	return 0, fmt.Errorf("no code left for name \"%s\"", value)
+}
+
+// Checks that every name is non-empty, distinct from the others, and not a
+// number (which would be read as a code instead).
+func (n Names) validate() error {
+	seen := make(map[string]bool)
+	for code, name := range n {
+		if strings.TrimSpace(name) == "" {
+			return fmt.Errorf("blank name for code %d", code)
+		}
+		if _, err := strconv.ParseInt(name, 10, 64); err == nil {
+			return fmt.Errorf("numeric name \"%s\" for code %d", name, code)
+		}
+		if seen[name] {
+			return fmt.Errorf("duplicate name \"%s\"", name)
+		}
+		seen[name] = true
+	}
+	return nil
+}
+
+// MetadataPath returns the path to the metadata for the binary log at the given
+// path.
+func MetadataPath(path string) string {
+	return strings.TrimSuffix(path, feedExtension) + metadataExtension
+}
+
+// ReadMetadata reads and validates metadata given as JSON.
+func ReadMetadata(r io.Reader) (*Metadata, error) {
+	m := &Metadata{}
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(m); err != nil {
+		return nil, fmt.Errorf("malformed metadata: %v", err)
+	}
+	if err := m.Types.validate(); err != nil {
+		return nil, fmt.Errorf("malformed metadata for event types: %v", err)
+	}
+	if err := m.Regions.validate(); err != nil {
+		return nil, fmt.Errorf("malformed metadata for regions: %v", err)
+	}
+	return m, nil
+}
+
+// LoadMetadata reads the metadata in the file at the given path, returning
+// empty metadata if there is no such file.
+func LoadMetadata(path string) (*Metadata, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return &Metadata{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ReadMetadata(file)
+}
+
+// Write writes the metadata to the file at the given path, replacing it
+// whole so it is never seen half-written.
+func (m *Metadata) Write(path string) error {
+	content, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	temp, err := ioutil.TempFile(filepath.Dir(path), ".metadata")
+	if err != nil {
+		return err
+	}
+	_, err = temp.Write(append(content, '\n'))
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(temp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(temp.Name())
+	}
+	return err
+}
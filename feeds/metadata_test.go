@@ -0,0 +1,281 @@
+// Perspective: Graphing library for quality control in event-driven systems
+
+// Copyright (C) 2016 Christian Paro <christian.paro@gmail.com>,
+//                                   <cparo@digitalocean.com>
+
+// This program is free software: you can redistribute it and/or modify it under
+// the terms of the GNU General Public License version 2 as published by the
+// Free Software Foundation.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+
+// You should have received a copy of the GNU General Public License along with
+// this program. If not, see <http://www.gnu.org/licenses/>.
+
+package feeds
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/cparo/perspective"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadMetadata(t *testing.T) {
+	m, err := ReadMetadata(strings.NewReader(
+		`{"types": {"7": "snapshot"}, "regions": {"3": "nyc3"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &Metadata{Names{7: "snapshot"}, Names{3: "nyc3"}}
+	if !reflect.DeepEqual(m, expected) {
+		t.Errorf("Read metadata %+v", m)
+	}
+
+	for _, content := range []string{
+		`{"types": {"256": "too-large"}}`,
+		`{"types": {"1": "a", "2": "a"}}`,
+		`{"regions": {"1": " "}}`,
+		`{"regions": {"1": "2"}}`,
+		`{"colors": {}}`,
+		`[]`} {
+		if _, err := ReadMetadata(strings.NewReader(content)); err == nil {
+			t.Errorf("Malformed metadata accepted: %s", content)
+		}
+	}
+}
+
+func TestNamesParse(t *testing.T) {
+	names := Names{3: "nyc3"}
+	cases := []struct {
+		value string
+		code  uint8
+		valid bool
+	}{
+		{"3", 3, true},
+		{"nyc3", 3, true},
+		{"0", 0, true},
+		{"ams2", 0, false},
+		{"256", 0, false},
+		{"", 0, false}}
+	for _, c := range cases {
+		code, err := names.Parse(c.value)
+		if c.valid && (err != nil || code != c.code) || !c.valid && err == nil {
+			t.Errorf("%q parsed as %d: %v", c.value, code, err)
+		}
+	}
+}
+
+func TestMetadataWriteAndLoad(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	path := MetadataPath(filepath.Join(dir, "nyc3.dat"))
+	if path != filepath.Join(dir, "nyc3.meta.json") {
+		t.Errorf("Metadata path: %s", path)
+	}
+	m, err := LoadMetadata(path)
+	if err != nil || m.Types != nil || m.Regions != nil {
+		t.Errorf("Missing metadata loaded as %+v: %v", m, err)
+	}
+
+	m = &Metadata{Names{7: "snapshot"}, nil}
+	if err := m.Write(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadMetadata(path)
+	if err != nil || !reflect.DeepEqual(loaded, m) {
+		t.Errorf("Metadata loaded as %+v: %v", loaded, err)
+	}
+}
+
+// Stalled events are listed with the names of their types and regions.
+func TestListStalledEventsNamed(t *testing.T) {
+	h := int64(time.Hour)
+	feed := NewFeed64([]perspective.EventData64{
+		{ID: 1, Start: h, Run: h, Status: -1, Type: 7, Region: 3}},
+		1)
+	feed.SetNames(&Metadata{Names{7: "snapshot"}, nil})
+	var out bytes.Buffer
+	ctx := context.Background()
+	err := ListStalledEvents(ctx, feed, 0, 8*h, -1, -1, 10, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stalled []map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &stalled); err != nil {
+		t.Fatal(err)
+	}
+	if len(stalled) != 1 || stalled[0]["type_name"] != "snapshot" ||
+		stalled[0]["region"] != 3.0 || stalled[0]["region_name"] != nil {
+		t.Errorf("Listed stalled events as %v", stalled)
+	}
+}
+
+func TestConvertCSVNamed(t *testing.T) {
+	var out bytes.Buffer
+	n, err := ConvertCSV(
+		strings.NewReader("1,snapshot,10,5,0,nyc3,100,\n2,2,20,5,0,3,100,\n"),
+		&out,
+		nil,
+		&Filter{0, 1 << 62, 7, 3, 7},
+		nil,
+		&Metadata{Names{7: "snapshot"}, Names{3: "nyc3"}},
+		false,
+		int64(time.Second),
+		false)
+	if err != nil || n != 1 {
+		t.Errorf("Converted %d events with names: %v", n, err)
+	}
+
+	_, err = ConvertCSV(
+		strings.NewReader("1,backup,10,5,0,3,100,\n"),
+		&out,
+		nil,
+		nil,
+		nil,
+		&Metadata{Names{7: "snapshot"}, nil},
+		false,
+		int64(time.Second),
+		false)
+	if err == nil || !strings.Contains(err.Error(), "malformed event type") {
+		t.Errorf("Unknown event type name converted: %v", err)
+	}
+}
+
+// Names are given the lowest free codes, other than those given as numbers, and
+// keep them once given.
+func TestNamesAssign(t *testing.T) {
+	names := Names{0: "backup"}
+	use := &codeUse{}
+	cases := []struct {
+		value string
+		code  uint8
+	}{
+		{"snapshot", 1},
+		{"backup", 0},
+		{"7", 7},
+		{"2", 2},
+		{"resize", 3},
+		{"snapshot", 1}}
+	for _, c := range cases {
+		code, err := names.parse(c.value, use)
+		if err != nil || code != c.code {
+			t.Errorf("%q assigned %d: %v", c.value, code, err)
+		}
+	}
+	if _, err := names.parse(" ", use); err == nil {
+		t.Error("Blank name assigned a code.")
+	}
+	for _, value := range []string{"+5", "-1", "3"} {
+		if code, err := names.parse(value, use); err == nil {
+			t.Errorf("%q parsed as code %d.", value, code)
+		}
+	}
+
+	full := make(Names)
+	for code := 0; code < 256; code++ {
+		full[uint8(code)] = fmt.Sprintf("n%d", code)
+	}
+	if _, err := full.parse("extra", &codeUse{}); err == nil {
+		t.Error("Name assigned a code with none left.")
+	}
+}
+
+// Names in a column which also gives codes as numbers are kept clear of those
+// codes, and numbers which are not codes are rejected rather than taken as
+// names which would be rejected on loading.
+func TestConvertCSVMixedCodes(t *testing.T) {
+	convert := func(regions ...string) (*Metadata, error) {
+		var csv bytes.Buffer
+		for i, region := range regions {
+			fmt.Fprintf(&csv, "%d,0,10,5,0,%s,100,\n", i, region)
+		}
+		names := &Metadata{}
+		_, err := ConvertCSV(
+			&csv,
+			ioutil.Discard,
+			nil,
+			nil,
+			nil,
+			names,
+			true,
+			int64(time.Second),
+			false)
+		return names, err
+	}
+
+	names, err := convert("0", "nyc3", "2", "sfo2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names.Regions) != 2 ||
+		names.Regions[1] != "nyc3" || names.Regions[3] != "sfo2" {
+		t.Errorf("Assigned region codes %v", names.Regions)
+	}
+	for _, regions := range [][]string{{"nyc3", "0"}, {"nyc3", "+5"}} {
+		_, err := convert(regions...)
+		if err == nil || !strings.Contains(err.Error(), "record 2") {
+			t.Errorf("Converted regions %v: %v", regions, err)
+		}
+	}
+}
+
+// A metadata file serves as a dictionary of codes across conversions, with new
+// names added to it.
+func TestConvertCSVToBinaryDictionary(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	dictionary := filepath.Join(dir, "codes.json")
+
+	convert := func(name string, csv string) *Metadata {
+		iPath := filepath.Join(dir, name+".csv")
+		oPath := filepath.Join(dir, name+".dat")
+		if err := ioutil.WriteFile(iPath, []byte(csv), 0644); err != nil {
+			t.Fatal(err)
+		}
+		ConvertCSVToBinary(
+			iPath, oPath, 0, 1<<62, -1, -1, 7, "", dictionary, "", 1e9, false)
+		sidecar, err := LoadMetadata(MetadataPath(oPath))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sidecar
+	}
+
+	convert("a", "1,backup,10,5,0,nyc3,100,\n"+
+		"2,snapshot,20,5,0,ams2,100,\n")
+	sidecar := convert("b", "3,resize,30,5,0,sfo1,100,\n"+
+		"4,backup,40,5,0,ams2,100,\n")
+	expected := &Metadata{
+		Names{0: "backup", 1: "snapshot", 2: "resize"},
+		Names{0: "nyc3", 1: "ams2", 2: "sfo1"}}
+	if m, err := LoadMetadata(dictionary); err != nil ||
+		!reflect.DeepEqual(m, expected) {
+		t.Errorf("Dictionary after conversions: %+v, %v", m, err)
+	}
+	if !reflect.DeepEqual(sidecar, expected) {
+		t.Errorf("Metadata kept with binary log: %+v", sidecar)
+	}
+
+	feed := MapBinLogFile(filepath.Join(dir, "b.dat"), 0)
+	if feed == nil {
+		t.Fatal("Failed to map converted binary log.")
+	}
+	defer UnmapBinLogFile(feed)
+	var scratch perspective.EventData64
+	if e := feed.event(1, &scratch); e.Type != 0 || e.Region != 1 {
+		t.Errorf("Event converted as %+v", *e)
+	}
+}
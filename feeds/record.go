@@ -0,0 +1,186 @@
+// Perspective: Graphing library for quality control in event-driven systems
+
+// Copyright (C) 2016 Christian Paro <christian.paro@gmail.com>,
+//                                   <cparo@digitalocean.com>
+
+// This program is free software: you can redistribute it and/or modify it under
+// the terms of the GNU General Public License version 2 as published by the
+// Free Software Foundation.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+
+// You should have received a copy of the GNU General Public License along with
+// this program. If not, see <http://www.gnu.org/licenses/>.
+
+package feeds
+
+import (
+	"context"
+	"fmt"
+	"github.com/cparo/perspective"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// Smallest share of a feed worth handing off to its own recording goroutine.
+// Below this, the cost of allocating and merging the extra visualization state
+// outweighs the time saved by recording in parallel.
+const minShardEvents = 1 << 16
+
+// Number of events recorded between checks for cancellation of a recording.
+// Checking on every event would cost more than the scan of a whole feed saves
+// by being cut short.
+const cancelCheckEvents = 1 << 14
+
+// Records each event matching the filter for each layer into that layer's
+// visualization generator, splitting the work across as many goroutines as can
+// be run in parallel if the feed is large enough to benefit from it. Recording
+// stops early, returning the context's error, if the context is done before all
+// events have been recorded.
+func record(ctx context.Context, feed *Feed, layers []Layer) error {
+	return recordSharded(ctx, feed, layers, runtime.GOMAXPROCS(0))
+}
+
+// Records events as record does, but with an explicit upper limit on the number
+// of shards the event data is split into.
+func recordSharded(
+	ctx context.Context,
+	feed *Feed,
+	layers []Layer,
+	shards int) error {
+
+	// Let any visualization generators which need to know the resolution of
+	// the run times they are given know what it is, ahead of any sharding so
+	// the shards inherit it.
+	for l, _ := range layers {
+		v, ok := layers[l].Visualizer.(perspective.QuantizedVisualizer)
+		if ok {
+			v.SetResolution(float64(feed.resolution) / float64(time.Second))
+		}
+	}
+
+	// Likewise, let any which label groups of events by type or region know
+	// the names of the types and regions in the feed.
+	names := feed.Names()
+	for l, _ := range layers {
+		v, ok := layers[l].Visualizer.(perspective.LabeledVisualizer)
+		if ok {
+			v.SetNames(names.Types, names.Regions)
+		}
+	}
+
+	n := feed.Len()
+	if shards > n/minShardEvents {
+		shards = n / minShardEvents
+	}
+
+	// Parallel recording only works if every layer can be split into shards
+	// and merged back together, otherwise we fall back to a single pass.
+	sharded := make([]perspective.ShardedVisualizer, len(layers))
+	for l, _ := range layers {
+		v, ok := layers[l].Visualizer.(perspective.ShardedVisualizer)
+		if !ok {
+			shards = 1
+			break
+		}
+		sharded[l] = v
+	}
+
+	if shards <= 1 {
+		return recordRange(ctx, feed, 0, n, layers)
+	}
+
+	// The first shard of the events is recorded into the original layers, and
+	// each other shard into its own copies of them, to be merged back once all
+	// shards have been recorded.
+	partials := make([][]Layer, shards)
+	partials[0] = layers
+	for s := 1; s < shards; s++ {
+		partials[s] = make([]Layer, len(layers))
+		for l, _ := range layers {
+			partials[s][l] = layers[l]
+			partials[s][l].Visualizer = sharded[l].Shard()
+		}
+	}
+
+	// A panic in a shard's goroutine would take down the whole process, so it
+	// is recovered and returned as an error instead, much as net/http recovers
+	// one raised while recording in the goroutine serving the request.
+	var wg sync.WaitGroup
+	errs := make([]error, shards)
+	for s := 0; s < shards; s++ {
+		wg.Add(1)
+		go func(s int) {
+			defer wg.Done()
+			defer func() {
+				if r := recover(); r != nil {
+					errs[s] = fmt.Errorf(
+						"panic recording events: %v\n%s", r, debug.Stack())
+				}
+			}()
+			errs[s] = recordRange(
+				ctx, feed, s*n/shards, (s+1)*n/shards, partials[s])
+		}(s)
+	}
+	wg.Wait()
+
+	// There is no point in merging shards of an abandoned recording.
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	for s := 1; s < shards; s++ {
+		for l, _ := range layers {
+			sharded[l].Merge(
+				partials[s][l].Visualizer.(perspective.ShardedVisualizer))
+		}
+	}
+	return nil
+}
+
+// Records events in the range [i0, iΩ) into the given layers, unless the
+// context is done first.
+func recordRange(
+	ctx context.Context,
+	feed *Feed,
+	i0 int,
+	iΩ int,
+	layers []Layer) error {
+
+	// Visualizations which show events over the span of time they were in
+	// flight are also given those in flight at the start of their time range.
+	spanning := make([]bool, len(layers))
+	for l, _ := range layers {
+		_, spanning[l] = layers[l].Visualizer.(perspective.SpanningVisualizer)
+	}
+
+	// Passing event data by reference instead of passing it by value cuts about
+	// 12-15% off of run time in repeated before/after tests with the scatter
+	// visualization through the HTTP API.
+	var scratch perspective.EventData64
+	for i := i0; i < iΩ; i++ {
+		if (i-i0)%cancelCheckEvents == 0 && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		e := feed.event(i, &scratch)
+		for l, _ := range layers {
+			var matched bool
+			if spanning[l] {
+				matched = layers[l].Filter.matchInFlight(e)
+			} else {
+				matched = layers[l].Filter.match(e)
+			}
+			if matched {
+				layers[l].Visualizer.Record(e)
+			}
+		}
+	}
+	return nil
+}
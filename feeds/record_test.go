@@ -0,0 +1,237 @@
+// Perspective: Graphing library for quality control in event-driven systems
+
+// Copyright (C) 2016 Christian Paro <christian.paro@gmail.com>,
+//                                   <cparo@digitalocean.com>
+
+// This program is free software: you can redistribute it and/or modify it under
+// the terms of the GNU General Public License version 2 as published by the
+// Free Software Foundation.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+
+// You should have received a copy of the GNU General Public License along with
+// this program. If not, see <http://www.gnu.org/licenses/>.
+
+package feeds
+
+import (
+	"bytes"
+	"context"
+	"github.com/cparo/perspective"
+	"image"
+	"math/rand"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	benchEvents = 1 << 21
+	benchStart  = 1400000000
+	benchRange  = 86400
+)
+
+// Bounds of the benchmark event time range, in nanoseconds.
+const (
+	benchA = benchStart * int64(time.Second)
+	benchΩ = (benchStart + benchRange) * int64(time.Second)
+)
+
+func benchEventData() []perspective.EventData {
+	r := rand.New(rand.NewSource(1))
+	events := make([]perspective.EventData, benchEvents)
+	for i := range events {
+		events[i] = perspective.EventData{
+			ID:       int32(i),
+			Start:    int32(benchStart + i*benchRange/benchEvents),
+			Run:      int32(r.ExpFloat64() * 120),
+			Type:     uint8(r.Intn(4)),
+			Status:   int8(r.Intn(4) - 1),
+			Region:   uint8(r.Intn(3)),
+			Progress: uint8(r.Intn(101))}
+	}
+	return events
+}
+
+func benchmarkRecordScatter(b *testing.B, shards int) {
+	feed := NewFeed(benchEventData())
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		recordSharded(
+			context.Background(),
+			feed,
+			[]Layer{{
+				Filter: Filter{benchA - 1, benchΩ, -1, -1, 7},
+				Visualizer: perspective.NewScatter(
+					512, 256, 32, benchA, benchΩ,
+					perspective.NewLog2Axis(16), 1, 0,
+					perspective.JitterRandom)}},
+			shards)
+	}
+}
+
+func BenchmarkRecordScatterSerial(b *testing.B) {
+	benchmarkRecordScatter(b, 1)
+}
+
+func BenchmarkRecordScatterParallel(b *testing.B) {
+	benchmarkRecordScatter(b, runtime.GOMAXPROCS(0))
+}
+
+// Recording in shards should leave the visualization in the same state as
+// recording serially, aside from the random jitter applied by the generator.
+func TestRecordShardedMatchesSerial(t *testing.T) {
+	feed := NewFeed(benchEventData())
+	serial := perspective.NewRunTimeLine(
+		256, 128, 32, benchA, benchΩ, perspective.NewLog2Axis(16), 0)
+	parallel := perspective.NewRunTimeLine(
+		256, 128, 32, benchA, benchΩ, perspective.NewLog2Axis(16), 0)
+	filter := Filter{benchA - 1, benchΩ, -1, -1, 7}
+	ctx := context.Background()
+	recordSharded(ctx, feed, []Layer{{Filter: filter, Visualizer: serial}}, 1)
+	recordSharded(
+		ctx, feed, []Layer{{Filter: filter, Visualizer: parallel}}, 8)
+	a := serial.Render().(*image.RGBA)
+	b := parallel.Render().(*image.RGBA)
+	if !bytes.Equal(a.Pix, b.Pix) {
+		t.Error("Sharded recording rendered differently from serial recording.")
+	}
+}
+
+// Recording with a context which is already done should give up with the
+// context's error, whether or not the events are split into shards.
+func TestRecordCancelled(t *testing.T) {
+	feed := NewFeed(benchEventData())
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	filter := Filter{benchA - 1, benchΩ, -1, -1, 7}
+	for _, shards := range []int{1, 8} {
+		v := perspective.NewRunTimeLine(
+			256, 128, 32, benchA, benchΩ, perspective.NewLog2Axis(16), 0)
+		err := recordSharded(
+			ctx, feed, []Layer{{Filter: filter, Visualizer: v}}, shards)
+		if err != context.Canceled {
+			t.Errorf("Recording in %d shards returned %v.", shards, err)
+		}
+	}
+}
+
+// Visualization generator which panics on recording any event.
+type panicVisualizer struct{}
+
+func (v *panicVisualizer) Record(e *perspective.EventData64) {
+	panic("recorded an event")
+}
+
+func (v *panicVisualizer) Render() image.Image {
+	return nil
+}
+
+func (v *panicVisualizer) Shard() perspective.ShardedVisualizer {
+	return &panicVisualizer{}
+}
+
+func (v *panicVisualizer) Merge(perspective.ShardedVisualizer) {
+}
+
+// A panic while recording a shard should be returned as an error rather than
+// crashing the process from a goroutine with nothing to recover it.
+func TestRecordShardPanic(t *testing.T) {
+	feed := NewFeed(benchEventData())
+	filter := Filter{benchA - 1, benchΩ, -1, -1, 7}
+	err := recordSharded(
+		context.Background(),
+		feed,
+		[]Layer{{Filter: filter, Visualizer: &panicVisualizer{}}},
+		8)
+	if err == nil || !strings.Contains(err.Error(), "recorded an event") {
+		t.Errorf("Got %v, expected the recovered panic.", err)
+	}
+}
+
+// Events which started before the time range of a concurrency visualization
+// but were still in flight at its start should be counted from its left edge.
+func TestRecordInFlight(t *testing.T) {
+	s := int64(time.Second)
+	feed := NewFeed([]perspective.EventData{
+		{ID: 1, Start: 50, Run: 100},   // In flight from before the range
+		{ID: 2, Start: 120, Run: 10},   // Within the range
+		{ID: 3, Start: 20, Run: 30},    // Done before the range
+		{ID: 4, Start: 150, Run: 100}}) // In flight past the range
+	v := perspective.NewConcurrency(
+		10, 10, 32, 100*s, 200*s, perspective.GroupStatus, 0)
+	filter := Filter{100 * s, 200 * s, -1, -1, 7}
+	err := recordSharded(
+		context.Background(), feed, []Layer{{Filter: filter, Visualizer: v}}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// With two events in flight at most, one in flight fills half the height.
+	vis := v.Render().(*image.RGBA)
+	bg := vis.RGBAAt(0, 0)
+	for x, expected := range []int{5, 5, 10, 5, 5, 5, 5, 5, 5, 5} {
+		height := 0
+		for y := 0; y < 10; y++ {
+			if vis.RGBAAt(x, y) != bg {
+				height++
+			}
+		}
+		if height != expected {
+			t.Errorf("Column %d stacked %d high, expected %d",
+				x, height, expected)
+		}
+	}
+}
+
+// Events which started before the time range of a Gantt chart but were still in
+// flight at its start should be drawn from its left edge.
+func TestRecordInFlightGantt(t *testing.T) {
+	s := int64(time.Second)
+	feed := NewFeed([]perspective.EventData{
+		{ID: 1, Start: 50, Run: 100}, // In flight from before the range
+		{ID: 2, Start: 20, Run: 30}}) // Done before the range
+	v := perspective.NewGantt(
+		10, 10, 32, 100*s, 200*s, perspective.GroupStatus, 0, 0)
+	filter := Filter{100 * s, 200 * s, -1, -1, 7}
+	err := recordSharded(
+		context.Background(), feed, []Layer{{Filter: filter, Visualizer: v}}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The one event drawn fills the only row up to the middle of the range.
+	vis := v.Render().(*image.RGBA)
+	bg := vis.RGBAAt(9, 5)
+	for x := 0; x < 10; x++ {
+		if drawn := vis.RGBAAt(x, 5) != bg; drawn != (x < 5) {
+			t.Errorf("Column %d drawn: %v", x, drawn)
+		}
+	}
+}
+
+// Visualizations which label groups of events should be given the names in the
+// metadata of the feed.
+func TestRecordNames(t *testing.T) {
+	feed := NewFeed([]perspective.EventData{
+		{ID: 1, Start: 10, Run: 5, Type: 7},
+		{ID: 2, Start: 20, Run: 5, Type: 8}})
+	feed.SetNames(&Metadata{Names{7: "snapshot"}, nil})
+	v := perspective.NewCDF(
+		10, 10, 32, perspective.NewLog2Axis(1), perspective.GroupType, false)
+	filter := Filter{0, 100 * int64(time.Second), -1, -1, 7}
+	err := record(
+		context.Background(), feed, []Layer{{Filter: filter, Visualizer: v}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	curves := v.Curves()
+	if len(curves) != 2 || curves[0].Name != "snapshot" ||
+		curves[1].Name != "" {
+		t.Errorf("Curves named %+v", curves)
+	}
+}
@@ -0,0 +1,324 @@
+// Perspective: Graphing library for quality control in event-driven systems
+
+// Copyright (C) 2016 Christian Paro <christian.paro@gmail.com>,
+//                                   <cparo@digitalocean.com>
+
+// This program is free software: you can redistribute it and/or modify it under
+// the terms of the GNU General Public License version 2 as published by the
+// Free Software Foundation.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+
+// You should have received a copy of the GNU General Public License along with
+// this program. If not, see <http://www.gnu.org/licenses/>.
+
+package feeds
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Extension of the binary log holding a feed, within a registry's directory.
+const feedExtension = ".dat"
+
+// Feed names are identifiers of up to 128 letters, digits, dots, dashes and
+// underscores, starting with a letter or digit. With no separators and no
+// leading dot, no name can resolve to a path outside of a registry's directory,
+// or to a hidden file within it.
+var feedName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,127}$`)
+
+// ErrInvalidFeedName is returned for a feed name which is not a valid
+// identifier.
+var ErrInvalidFeedName = errors.New("invalid feed name")
+
+// ErrFeedNotFound is returned for a feed which is not in a registry.
+var ErrFeedNotFound = errors.New("feed not found")
+
+// ErrFeedExists is returned for an attempt to rename a feed to the name of one
+// already in a registry.
+var ErrFeedExists = errors.New("feed already exists")
+
+// ValidateFeedName returns ErrInvalidFeedName if the given name is not a valid
+// feed name, and nil otherwise.
+func ValidateFeedName(name string) error {
+	if !feedName.MatchString(name) {
+		return ErrInvalidFeedName
+	}
+	return nil
+}
+
+// Registry holds the feeds in a data directory, by name, along with a staging
+// directory in which feeds are written before being moved into place. The
+// staging directory must be on the same file system as the data directory.
+type Registry struct {
+	dataPath  string               // Directory holding feeds
+	stagePath string               // Directory for feeds being written
+	mutex     sync.Mutex           // Guards the map of feed locks
+	locks     map[string]*feedLock // Locks held or awaited, by feed name
+}
+
+// A lock on a feed, with a count of those holding or awaiting it, so it can be
+// dropped from its registry once no longer in use.
+type feedLock struct {
+	sync.Mutex
+	refs int
+}
+
+// NewRegistry returns a registry of the feeds in the given data directory,
+// staging new feeds in the given staging directory.
+func NewRegistry(dataPath string, stagePath string) *Registry {
+	return &Registry{
+		filepath.Clean(dataPath),
+		filepath.Clean(stagePath),
+		sync.Mutex{},
+		make(map[string]*feedLock)}
+}
+
+// Lock locks the named feed against anyone else holding a lock on it, waiting
+// for any lock already held on it to be released, and returns the function
+// which releases it. Updates to a feed which are based on its current state,
+// like adding names to its metadata, should hold the lock from reading that
+// state until the update is written, so concurrent updates are applied in turn
+// rather than one undoing another. The name need not be valid, or name a feed.
+func (r *Registry) Lock(name string) func() {
+	r.mutex.Lock()
+	l := r.locks[name]
+	if l == nil {
+		l = &feedLock{}
+		r.locks[name] = l
+	}
+	l.refs++
+	r.mutex.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		r.mutex.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(r.locks, name)
+		}
+		r.mutex.Unlock()
+	}
+}
+
+// Path returns the path to the binary log for the named feed, which is always
+// directly within the data directory, or an error if the name is invalid.
+func (r *Registry) Path(name string) (string, error) {
+	if err := ValidateFeedName(name); err != nil {
+		return "", err
+	}
+	path := filepath.Join(r.dataPath, name+feedExtension)
+	if filepath.Dir(path) != r.dataPath {
+		return "", ErrInvalidFeedName
+	}
+	return path, nil
+}
+
+// Map maps the binary log for the named feed into memory, as MapBinLogFile
+// does, along with the names from its metadata, returning ErrFeedNotFound if
+// there is no such feed.
+func (r *Registry) Map(name string, lookback int64) (*Feed, error) {
+	path, err := r.Path(name)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(path); err != nil || !info.Mode().IsRegular() {
+		return nil, ErrFeedNotFound
+	}
+	names, err := LoadMetadata(MetadataPath(path))
+	if err != nil {
+		return nil, err
+	}
+	feed := MapBinLogFile(path, lookback)
+	if feed == nil {
+		return nil, fmt.Errorf("failed to map feed \"%s\"", name)
+	}
+	feed.SetNames(names)
+	return feed, nil
+}
+
+// Metadata returns the metadata for the named feed, which is empty if none has
+// been set.
+func (r *Registry) Metadata(name string) (*Metadata, error) {
+	path, err := r.Path(name)
+	if err != nil {
+		return nil, err
+	}
+	return LoadMetadata(MetadataPath(path))
+}
+
+// SetMetadata sets the metadata for the named feed.
+func (r *Registry) SetMetadata(name string, m *Metadata) error {
+	path, err := r.Path(name)
+	if err != nil {
+		return err
+	}
+	return m.Write(MetadataPath(path))
+}
+
+// Names returns the names of the feeds in the registry, in sorted order.
+func (r *Registry) Names() ([]string, error) {
+	entries, err := ioutil.ReadDir(r.dataPath)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), feedExtension)
+		if entry.Mode().IsRegular() &&
+			strings.HasSuffix(entry.Name(), feedExtension) &&
+			feedName.MatchString(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Describe returns a description of the named feed, as DescribeBinLog does,
+// returning ErrFeedNotFound if there is no such feed.
+func (r *Registry) Describe(
+	ctx context.Context,
+	name string) (*FeedInfo, error) {
+
+	path, err := r.Path(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := DescribeBinLog(ctx, path, name)
+	if os.IsNotExist(err) {
+		return nil, ErrFeedNotFound
+	}
+	return info, err
+}
+
+// List returns descriptions of all feeds in the registry, sorted by name. If
+// the context is done before all feeds have been described, the context's error
+// is returned.
+func (r *Registry) List(ctx context.Context) ([]*FeedInfo, error) {
+	names, err := r.Names()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*FeedInfo, 0, len(names))
+	for _, name := range names {
+		info, err := r.Describe(ctx, name)
+		if err == ErrFeedNotFound {
+			continue // Removed since being listed.
+		}
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, info)
+	}
+	return list, nil
+}
+
+// Delete removes the named feed, and its metadata, from the registry.
+func (r *Registry) Delete(name string) error {
+	path, err := r.Path(name)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if os.IsNotExist(err) {
+		return ErrFeedNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return removeMetadata(path)
+}
+
+// Rename gives the named feed (and its metadata) a new name, returning
+// ErrFeedExists if there is already a feed with the new name rather than
+// replacing it.
+func (r *Registry) Rename(name string, newName string) error {
+	path, err := r.Path(name)
+	if err != nil {
+		return err
+	}
+	newPath, err := r.Path(newName)
+	if err != nil {
+		return err
+	}
+	// Linking the feed under its new name, rather than renaming it, fails
+	// without replacing any feed which already has the new name.
+	err = os.Link(path, newPath)
+	if os.IsNotExist(err) {
+		return ErrFeedNotFound
+	}
+	if os.IsExist(err) {
+		return ErrFeedExists
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	// Metadata left behind by any earlier feed with the new name is replaced
+	// by that of the renamed feed, or removed if it has none.
+	err = os.Rename(MetadataPath(path), MetadataPath(newPath))
+	if os.IsNotExist(err) {
+		return removeMetadata(newPath)
+	}
+	return err
+}
+
+// Removes the metadata for the binary log at the given path, if it has any.
+func removeMetadata(path string) error {
+	err := os.Remove(MetadataPath(path))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Stage creates a file in the staging directory for writing a new version of
+// the named feed, to be moved into place with Commit once it is complete (or
+// removed with Discard if it is not). Staged files have unique names, so any
+// number of versions of a feed may be staged at once.
+func (r *Registry) Stage(name string) (*os.File, error) {
+	if err := ValidateFeedName(name); err != nil {
+		return nil, err
+	}
+	return ioutil.TempFile(r.stagePath, name+".")
+}
+
+// Commit closes a file created with Stage and moves it into place as the named
+// feed, replacing any previous version of the feed.
+func (r *Registry) Commit(staged *os.File, name string) error {
+	path, err := r.Path(name)
+	if err != nil {
+		r.Discard(staged)
+		return err
+	}
+	if err := staged.Close(); err != nil {
+		os.Remove(staged.Name())
+		return err
+	}
+	if err := os.Rename(staged.Name(), path); err != nil {
+		os.Remove(staged.Name())
+		return err
+	}
+	return nil
+}
+
+// Discard closes and removes a file created with Stage.
+func (r *Registry) Discard(staged *os.File) {
+	staged.Close()
+	os.Remove(staged.Name())
+}
@@ -0,0 +1,363 @@
+// Perspective: Graphing library for quality control in event-driven systems
+
+// Copyright (C) 2016 Christian Paro <christian.paro@gmail.com>,
+//                                   <cparo@digitalocean.com>
+
+// This program is free software: you can redistribute it and/or modify it under
+// the terms of the GNU General Public License version 2 as published by the
+// Free Software Foundation.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+
+// You should have received a copy of the GNU General Public License along with
+// this program. If not, see <http://www.gnu.org/licenses/>.
+
+package feeds
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Names which could resolve to paths outside of a registry's data directory,
+// or to hidden or otherwise unexpected files within it.
+var traversalNames = []string{
+	"",
+	".",
+	"..",
+	"../feed",
+	"../../etc/passwd",
+	"/etc/passwd",
+	"feeds/../../feed",
+	"sub/feed",
+	`..\feed`,
+	".hidden",
+	"feed\x00.png",
+	"feed\n",
+	"~root",
+	strings.Repeat("a", 129)}
+
+// Creates a registry in a temporary directory, returning it along with its data
+// directory and a function to clean it up.
+func testRegistry(t *testing.T) (*Registry, string, func()) {
+	dir, err := ioutil.TempDir("", "perspective")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataPath := filepath.Join(dir, "feeds")
+	stagePath := filepath.Join(dir, "stage")
+	for _, path := range []string{dataPath, stagePath} {
+		if err := os.Mkdir(path, 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return NewRegistry(dataPath, stagePath),
+		dataPath,
+		func() { os.RemoveAll(dir) }
+}
+
+func TestValidateFeedName(t *testing.T) {
+	for _, name := range []string{"a", "nyc3", "nyc3.jobs_v2", "A-1", "1.dat"} {
+		if err := ValidateFeedName(name); err != nil {
+			t.Errorf("Valid feed name \"%s\" rejected: %v", name, err)
+		}
+	}
+	for _, name := range traversalNames {
+		if ValidateFeedName(name) != ErrInvalidFeedName {
+			t.Errorf("Invalid feed name %q accepted.", name)
+		}
+	}
+}
+
+func TestRegistryPath(t *testing.T) {
+	r, dataPath, cleanup := testRegistry(t)
+	defer cleanup()
+
+	path, err := r.Path("nyc3")
+	if err != nil || path != filepath.Join(dataPath, "nyc3.dat") {
+		t.Errorf("Path for feed: \"%s\", %v", path, err)
+	}
+	for _, name := range traversalNames {
+		if path, err := r.Path(name); err != ErrInvalidFeedName {
+			t.Errorf("Path for %q resolved to \"%s\"", name, path)
+		}
+	}
+}
+
+// Feeds can only be staged and committed under valid names, so uploads cannot
+// be written outside of the data directory.
+func TestRegistryStageAndCommit(t *testing.T) {
+	r, dataPath, cleanup := testRegistry(t)
+	defer cleanup()
+
+	for _, name := range traversalNames {
+		if staged, err := r.Stage(name); err != ErrInvalidFeedName {
+			t.Errorf("Feed staged under %q: %v", name, err)
+			if staged != nil {
+				r.Discard(staged)
+			}
+		}
+	}
+
+	staged, err := r.Stage("nyc3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Commit(staged, "../nyc3"); err != ErrInvalidFeedName {
+		t.Errorf("Feed committed under traversal name: %v", err)
+	}
+	if _, err := os.Stat(staged.Name()); !os.IsNotExist(err) {
+		t.Error("Staged file left behind after rejected commit.")
+	}
+
+	staged, err = r.Stage("nyc3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := staged.Write(make([]byte, 16)); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Commit(staged, "nyc3"); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(filepath.Join(dataPath, "nyc3.dat"))
+	if err != nil || info.Size() != 16 {
+		t.Errorf("Committed feed not in place: %v", err)
+	}
+}
+
+func TestRegistryMap(t *testing.T) {
+	r, dataPath, cleanup := testRegistry(t)
+	defer cleanup()
+
+	path := filepath.Join(dataPath, "nyc3.dat")
+	if err := ioutil.WriteFile(path, make([]byte, 32), 0600); err != nil {
+		t.Fatal(err)
+	}
+	feed, err := r.Map("nyc3", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if feed.Len() != 2 {
+		t.Errorf("Mapped %d events, expected 2", feed.Len())
+	}
+	UnmapBinLogFile(feed)
+
+	if _, err := r.Map("missing", 0); err != ErrFeedNotFound {
+		t.Errorf("Missing feed mapped: %v", err)
+	}
+	for _, name := range traversalNames {
+		if _, err := r.Map(name, 0); err != ErrInvalidFeedName {
+			t.Errorf("Feed mapped for %q: %v", name, err)
+		}
+	}
+}
+
+// Only regular files with valid feed names are listed as feeds.
+func TestRegistryNames(t *testing.T) {
+	r, dataPath, cleanup := testRegistry(t)
+	defer cleanup()
+
+	for _, name := range []string{"b.dat", "a.dat", ".hidden.dat", "c.csv"} {
+		path := filepath.Join(dataPath, name)
+		if err := ioutil.WriteFile(path, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dataPath, "d.dat"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	names, err := r.Names()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(names, []string{"a", "b"}) {
+		t.Errorf("Listed feeds %v", names)
+	}
+}
+
+func TestRegistryDescribe(t *testing.T) {
+	r, dataPath, cleanup := testRegistry(t)
+	defer cleanup()
+
+	path := filepath.Join(dataPath, "nyc3.dat")
+	if err := ioutil.WriteFile(path, make([]byte, 32), 0600); err != nil {
+		t.Fatal(err)
+	}
+	malformed := filepath.Join(dataPath, "torn.dat")
+	if err := ioutil.WriteFile(malformed, make([]byte, 20), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	info, err := r.Describe(ctx, "nyc3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Name != "nyc3" || info.Records != 2 || info.Size != 32 ||
+		info.Error != "" || info.Modified.IsZero() {
+		t.Errorf("Described feed as %+v", info)
+	}
+
+	info, err = r.Describe(ctx, "torn")
+	if err != nil || info.Error == "" || info.Summary != nil {
+		t.Errorf("Malformed feed described as %+v: %v", info, err)
+	}
+
+	list, err := r.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].Name != "nyc3" || list[1].Name != "torn" {
+		t.Errorf("Listed feeds %+v", list)
+	}
+
+	if _, err := r.Describe(ctx, "missing"); err != ErrFeedNotFound {
+		t.Errorf("Missing feed described: %v", err)
+	}
+	for _, name := range traversalNames {
+		if _, err := r.Describe(ctx, name); err != ErrInvalidFeedName {
+			t.Errorf("Feed described for %q: %v", name, err)
+		}
+	}
+}
+
+func TestRegistryDeleteAndRename(t *testing.T) {
+	r, dataPath, cleanup := testRegistry(t)
+	defer cleanup()
+
+	for _, name := range []string{"a.dat", "b.dat"} {
+		path := filepath.Join(dataPath, name)
+		if err := ioutil.WriteFile(path, []byte(name), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Renaming never replaces an existing feed.
+	if err := r.Rename("a", "b"); err != ErrFeedExists {
+		t.Errorf("Feed renamed over existing feed: %v", err)
+	}
+	content, _ := ioutil.ReadFile(filepath.Join(dataPath, "b.dat"))
+	if string(content) != "b.dat" {
+		t.Error("Existing feed replaced by rename.")
+	}
+
+	if err := r.Rename("a", "c"); err != nil {
+		t.Fatal(err)
+	}
+	if names, _ := r.Names(); !reflect.DeepEqual(names, []string{"b", "c"}) {
+		t.Errorf("Feeds after rename: %v", names)
+	}
+	if err := r.Rename("a", "d"); err != ErrFeedNotFound {
+		t.Errorf("Missing feed renamed: %v", err)
+	}
+
+	if err := r.Delete("b"); err != nil {
+		t.Fatal(err)
+	}
+	if names, _ := r.Names(); !reflect.DeepEqual(names, []string{"c"}) {
+		t.Errorf("Feeds after delete: %v", names)
+	}
+	if err := r.Delete("b"); err != ErrFeedNotFound {
+		t.Errorf("Missing feed deleted: %v", err)
+	}
+
+	for _, name := range traversalNames {
+		if err := r.Delete(name); err != ErrInvalidFeedName {
+			t.Errorf("Feed deleted for %q: %v", name, err)
+		}
+		if err := r.Rename("c", name); err != ErrInvalidFeedName {
+			t.Errorf("Feed renamed to %q: %v", name, err)
+		}
+	}
+}
+
+// Metadata is kept alongside each feed, and follows it when it is renamed or
+// deleted.
+func TestRegistryMetadata(t *testing.T) {
+	r, dataPath, cleanup := testRegistry(t)
+	defer cleanup()
+
+	path := filepath.Join(dataPath, "a.dat")
+	if err := ioutil.WriteFile(path, make([]byte, 16), 0600); err != nil {
+		t.Fatal(err)
+	}
+	names := &Metadata{Names{7: "snapshot"}, Names{3: "nyc3"}}
+	if err := r.SetMetadata("a", names); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetMetadata("../a", names); err != ErrInvalidFeedName {
+		t.Errorf("Metadata set for traversal name: %v", err)
+	}
+
+	feed, err := r.Map("a", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(feed.Names(), names) {
+		t.Errorf("Feed mapped with names %+v", feed.Names())
+	}
+	UnmapBinLogFile(feed)
+
+	if err := r.Rename("a", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if m, err := r.Metadata("b"); err != nil || !reflect.DeepEqual(m, names) {
+		t.Errorf("Metadata after rename: %+v, %v", m, err)
+	}
+	if m, err := r.Metadata("a"); err != nil || m.Types != nil {
+		t.Errorf("Metadata left behind by rename: %+v, %v", m, err)
+	}
+
+	if err := r.Delete("b"); err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := ioutil.ReadDir(dataPath)
+	if len(entries) != 0 {
+		t.Errorf("%d files left behind by delete", len(entries))
+	}
+}
+
+// Locks on a feed should be held by one holder at a time, and dropped from the
+// registry once released by all.
+func TestRegistryLock(t *testing.T) {
+	r := NewRegistry("data", "stage")
+	counter, most := 0, 0
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock := r.Lock("nyc3")
+			defer unlock()
+			counter++
+			if counter > most {
+				most = counter
+			}
+			time.Sleep(time.Millisecond)
+			counter--
+		}()
+	}
+	wg.Wait()
+	if most != 1 {
+		t.Errorf("Lock held by %d at once", most)
+	}
+
+	// Locks on different feeds are independent of each other.
+	unlock := r.Lock("nyc3")
+	r.Lock("ams2")()
+	unlock()
+	if len(r.locks) != 0 {
+		t.Errorf("Locks kept after release: %v", r.locks)
+	}
+}
@@ -0,0 +1,265 @@
+// Perspective: Graphing library for quality control in event-driven systems
+
+// Copyright (C) 2016 Christian Paro <christian.paro@gmail.com>,
+//                                   <cparo@digitalocean.com>
+
+// This program is free software: you can redistribute it and/or modify it under
+// the terms of the GNU General Public License version 2 as published by the
+// Free Software Foundation.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+
+// You should have received a copy of the GNU General Public License along with
+// this program. If not, see <http://www.gnu.org/licenses/>.
+
+package feeds
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// Fields of an event read from CSV, in the order of the columns holding them
+// by default.
+const (
+	fieldID = iota
+	fieldType
+	fieldStart
+	fieldRun
+	fieldStatus
+	fieldRegion
+	fieldProgress
+	fieldReason
+)
+
+// Names of the fields of an event read from CSV, by field.
+var csvFields = []string{
+	"id", "type", "start", "run", "status", "region", "progress", "reason"}
+
+// Values of the fields which may be left out of CSV without a default given by
+// its schema.
+var csvFieldDefaults = map[string]string{
+	"type":     "0",
+	"region":   "0",
+	"progress": "0",
+	"reason":   ""}
+
+// Column identifies a column of CSV, by its name in the header or (if it has
+// no name) by its index, counting from 0.
+type Column struct {
+	Name  string
+	Index int
+}
+
+// CSVSchema describes the layout of event data in CSV: the delimiter between
+// fields, whether the first record is a header naming the columns, and the
+// column holding each field of an event ("id", "type", "start", "run",
+// "status", "region", "progress" and "reason"). Fields with no column, or left
+// blank, take their default values. Event type, region, progress and error
+// reason may be left out entirely, with defaults of 0 (or a blank reason).
+type CSVSchema struct {
+	Delimiter rune              // Delimiter between fields
+	Header    bool              // Whether the first record names the columns
+	Fields    int               // Number of fields in each record, if fixed
+	Columns   map[string]Column // Column holding each field, by field name
+	Defaults  map[string]string // Values for fields with no column, or blank
+}
+
+// DefaultCSVSchema returns the schema of CSV with no header and exactly eight
+// comma-separated fields: the event ID, type, start time, run time, status,
+// region, progress and error reason, in that order.
+func DefaultCSVSchema() *CSVSchema {
+	return &CSVSchema{',', false, len(csvFields), positionalColumns(), nil}
+}
+
+// Returns columns for each of the fields, in their default order.
+func positionalColumns() map[string]Column {
+	columns := make(map[string]Column)
+	for i, field := range csvFields {
+		columns[field] = Column{"", i}
+	}
+	return columns
+}
+
+// ReadCSVSchema reads and validates a schema given as JSON, as in:
+//
+//	{
+//	  "delimiter": "\t",
+//	  "header": true,
+//	  "columns": {"id": "job_id", "start": "started_at", "run": 4},
+//	  "defaults": {"progress": "100"}
+//	}
+//
+// Columns are given by name (for CSV with a header) or by index, defaulting to
+// those of the default schema. Each record must have the number of fields
+// given by "fields", if any, or else as many as the header if there is one.
+// Otherwise, records need only have as many fields as the columns need, unless
+// the default schema is taken whole (with exactly eight fields).
+func ReadCSVSchema(r io.Reader) (*CSVSchema, error) {
+	var raw struct {
+		Delimiter string                 `json:"delimiter"`
+		Header    bool                   `json:"header"`
+		Fields    int                    `json:"fields"`
+		Columns   map[string]interface{} `json:"columns"`
+		Defaults  map[string]string      `json:"defaults"`
+	}
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	decoder.UseNumber()
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("malformed CSV schema: %v", err)
+	}
+
+	s := DefaultCSVSchema()
+	if raw.Delimiter != "" {
+		if utf8.RuneCountInString(raw.Delimiter) != 1 {
+			return nil, fmt.Errorf(
+				"malformed CSV schema: delimiter \"%s\" is not a single "+
+					"character",
+				raw.Delimiter)
+		}
+		s.Delimiter, _ = utf8.DecodeRuneInString(raw.Delimiter)
+	}
+	s.Header = raw.Header
+	s.Defaults = raw.Defaults
+	if raw.Columns != nil || raw.Header || raw.Fields != 0 {
+		s.Fields = raw.Fields
+	}
+	if raw.Columns != nil {
+		s.Columns = make(map[string]Column)
+		for field, column := range raw.Columns {
+			switch c := column.(type) {
+			case string:
+				s.Columns[field] = Column{Name: c}
+			case json.Number:
+				i, err := c.Int64()
+				if err != nil {
+					return nil, fmt.Errorf(
+						"malformed CSV schema: column index %s for %s",
+						c,
+						field)
+				}
+				s.Columns[field] = Column{Index: int(i)}
+			default:
+				return nil, fmt.Errorf(
+					"malformed CSV schema: column for %s is neither a name "+
+						"nor an index",
+					field)
+			}
+		}
+	}
+	if err := s.validate(); err != nil {
+		return nil, fmt.Errorf("malformed CSV schema: %v", err)
+	}
+	return s, nil
+}
+
+// LoadCSVSchema reads the schema in the file at the given path, returning the
+// default schema if the path is empty.
+func LoadCSVSchema(path string) (*CSVSchema, error) {
+	if path == "" {
+		return DefaultCSVSchema(), nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ReadCSVSchema(file)
+}
+
+// Checks that the schema can be used to read events, with a usable delimiter
+// and a column or default value for every field which needs one.
+func (s *CSVSchema) validate() error {
+	switch s.Delimiter {
+	case '"', '\r', '\n', 0, utf8.RuneError:
+		return fmt.Errorf("unusable delimiter %q", s.Delimiter)
+	}
+	if s.Fields < 0 {
+		return fmt.Errorf("negative number of fields: %d", s.Fields)
+	}
+	known := make(map[string]bool)
+	for _, field := range csvFields {
+		known[field] = true
+	}
+	for field, column := range s.Columns {
+		if !known[field] {
+			return fmt.Errorf("column for unknown field \"%s\"", field)
+		}
+		if column.Name != "" && !s.Header {
+			return fmt.Errorf("column named for %s with no header", field)
+		}
+		if column.Name == "" && column.Index < 0 {
+			return fmt.Errorf("negative column index for %s", field)
+		}
+		if column.Name == "" && s.Fields > 0 && column.Index >= s.Fields {
+			return fmt.Errorf(
+				"column %d for %s beyond %d fields",
+				column.Index,
+				field,
+				s.Fields)
+		}
+	}
+	for field := range s.Defaults {
+		if !known[field] {
+			return fmt.Errorf("default for unknown field \"%s\"", field)
+		}
+	}
+	for _, field := range csvFields {
+		_, hasColumn := s.Columns[field]
+		if _, hasDefault := s.defaultValue(field); !hasColumn && !hasDefault {
+			return fmt.Errorf("no column or default for %s", field)
+		}
+	}
+	return nil
+}
+
+// Returns the default value for the named field, if it has one.
+func (s *CSVSchema) defaultValue(field string) (string, bool) {
+	if value, exists := s.Defaults[field]; exists {
+		return value, true
+	}
+	value, exists := csvFieldDefaults[field]
+	return value, exists
+}
+
+// Returns the index of the column holding each field (or -1 for fields with
+// no column, which take their default values), given the names of the columns
+// from the header if the schema has one, along with the number of fields each
+// record needs to hold every column.
+func (s *CSVSchema) resolve(header []string) ([]int, int, error) {
+	names := make(map[string]int)
+	for i, name := range header {
+		if i == 0 {
+			name = strings.TrimPrefix(name, "\ufeff") // Byte order mark
+		}
+		names[strings.TrimSpace(name)] = i
+	}
+	columns := make([]int, len(csvFields))
+	needed := 0
+	for i, field := range csvFields {
+		column, exists := s.Columns[field]
+		columns[i] = column.Index
+		if column.Name != "" {
+			columns[i], exists = names[column.Name]
+			_, hasDefault := s.defaultValue(field)
+			if !exists && !hasDefault {
+				return nil, 0, fmt.Errorf(
+					"column \"%s\" for %s not in header", column.Name, field)
+			}
+		}
+		if !exists {
+			columns[i] = -1
+		} else if columns[i] >= needed {
+			needed = columns[i] + 1
+		}
+	}
+	return columns, needed, nil
+}
@@ -0,0 +1,235 @@
+// Perspective: Graphing library for quality control in event-driven systems
+
+// Copyright (C) 2016 Christian Paro <christian.paro@gmail.com>,
+//                                   <cparo@digitalocean.com>
+
+// This program is free software: you can redistribute it and/or modify it under
+// the terms of the GNU General Public License version 2 as published by the
+// Free Software Foundation.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+
+// You should have received a copy of the GNU General Public License along with
+// this program. If not, see <http://www.gnu.org/licenses/>.
+
+package feeds
+
+import (
+	"bytes"
+	"github.com/cparo/perspective"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadCSVSchema(t *testing.T) {
+	s, err := ReadCSVSchema(strings.NewReader(`{
+		"delimiter": "\t",
+		"header": true,
+		"columns": {"id": "job_id", "start": "started_at", "run": 3,
+			"status": "exit"},
+		"defaults": {"progress": "100"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &CSVSchema{
+		'\t',
+		true,
+		0,
+		map[string]Column{
+			"id":     {Name: "job_id"},
+			"start":  {Name: "started_at"},
+			"run":    {Index: 3},
+			"status": {Name: "exit"}},
+		map[string]string{"progress": "100"}}
+	if !reflect.DeepEqual(s, expected) {
+		t.Errorf("Read schema %+v", s)
+	}
+
+	// Settings left out are taken from the default schema.
+	s, err = ReadCSVSchema(strings.NewReader(`{"delimiter": ";"}`))
+	expected = DefaultCSVSchema()
+	expected.Delimiter = ';'
+	if err != nil || !reflect.DeepEqual(s, expected) {
+		t.Errorf("Read schema %+v: %v", s, err)
+	}
+
+	for _, content := range []string{
+		`{"delimiter": "::"}`,
+		`{"delimiter": "\""}`,
+		`{"delimiter": "\n"}`,
+		`{"columns": {"id": "job_id", "start": 1, "run": 2, "status": 3}}`,
+		`{"columns": {"id": -1, "start": 1, "run": 2, "status": 3}}`,
+		`{"columns": {"id": 1.5, "start": 1, "run": 2, "status": 3}}`,
+		`{"columns": {"id": true, "start": 1, "run": 2, "status": 3}}`,
+		`{"columns": {"id": 0, "start": 1, "run": 2}}`,
+		`{"columns": {"id": 0, "start": 1, "run": 2, "status": 3, "x": 4}}`,
+		`{"fields": 3, "columns": {"id": 0, "start": 1, "run": 2,
+			"status": 3}}`,
+		`{"defaults": {"colour": "red"}}`,
+		`{"separator": ";"}`} {
+		if _, err := ReadCSVSchema(strings.NewReader(content)); err == nil {
+			t.Errorf("Malformed schema accepted: %s", content)
+		}
+	}
+}
+
+// Converts the given CSV with the schema given as JSON, with times in seconds,
+// returning the events converted or the error encountered.
+func convertWithSchema(
+	schema string,
+	csv string) ([]perspective.EventData64, error) {
+
+	s, err := ReadCSVSchema(strings.NewReader(schema))
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	_, err = ConvertCSV(
+		strings.NewReader(csv),
+		&out,
+		s,
+		nil,
+		nil,
+		nil,
+		false,
+		int64(time.Second),
+		true)
+	if err != nil {
+		return nil, err
+	}
+	path, cleanup := writeTempFile(out.Bytes())
+	defer cleanup()
+	feed := MapBinLogFile(path, 0)
+	if feed == nil {
+		return nil, nil
+	}
+	defer UnmapBinLogFile(feed)
+	var events []perspective.EventData64
+	var scratch perspective.EventData64
+	for i := 0; i < feed.Len(); i++ {
+		events = append(events, *feed.event(i, &scratch))
+	}
+	return events, nil
+}
+
+// Writes the given content to a temporary file, returning its path and a
+// function to remove it.
+func writeTempFile(content []byte) (string, func()) {
+	file, err := ioutil.TempFile("", "perspective")
+	if err != nil {
+		panic(err)
+	}
+	defer file.Close()
+	file.Write(content)
+	return file.Name(), func() { os.Remove(file.Name()) }
+}
+
+func TestConvertCSVSchema(t *testing.T) {
+	s := int64(time.Second)
+	cases := []struct {
+		schema string
+		csv    string
+		events []perspective.EventData64
+	}{
+		// Columns by header name, in any order, with a blank progress and a
+		// missing region taking their defaults.
+		{
+			`{"delimiter": "\t", "header": true,
+				"columns": {"id": "id", "type": "class", "start": "started",
+					"run": "secs", "status": "exit", "region": "dc",
+					"progress": "pct", "reason": "error"},
+				"defaults": {"progress": "100"}}`,
+			"\ufeffexit\tid\tstarted\tsecs\tclass\tpct\terror\n" +
+				"0\t1\t2016-08-08T12:34:56Z\t5\t2\t\t\n" +
+				"1\t2\t1470659697\t6\t2\t50\ttimeout\n",
+			[]perspective.EventData64{
+				{ID: 1, Start: 1470659696 * s, Run: 5 * s, Type: 2,
+					Progress: 100},
+				{ID: 2, Start: 1470659697 * s, Run: 6 * s, Type: 2,
+					Status: 1, Progress: 50}}},
+		// Columns by index, with extra columns ignored and others left out.
+		{
+			`{"delimiter": ";",
+				"columns": {"id": 4, "start": 0, "run": 1, "status": 2}}`,
+			"1970-01-01T00:00:10.9+00:00;5;-1;x;7\n20;6;0;y;8;z\n",
+			[]perspective.EventData64{
+				{ID: 7, Start: 10 * s, Run: 5 * s, Status: -1},
+				{ID: 8, Start: 20 * s, Run: 6 * s}}},
+		// Positional columns after a header.
+		{
+			`{"header": true}`,
+			"id,type,start,run,status,region,progress,reason\n" +
+				"1,2,10,5,0,3,100,\n",
+			[]perspective.EventData64{
+				{ID: 1, Start: 10 * s, Run: 5 * s, Type: 2, Region: 3,
+					Progress: 100}}}}
+	for _, c := range cases {
+		events, err := convertWithSchema(c.schema, c.csv)
+		if err != nil || !reflect.DeepEqual(events, c.events) {
+			t.Errorf("%s: converted %+v: %v", c.schema, events, err)
+		}
+	}
+}
+
+func TestConvertCSVSchemaMalformed(t *testing.T) {
+	named := `{"header": true,
+		"columns": {"id": "id", "start": "start", "run": "run",
+			"status": "status"}}`
+	cases := []struct {
+		schema string
+		csv    string
+		reason string
+	}{
+		{named, "id,start,run\n1,2,3\n", `record 1: column "status"`},
+		{named, "id,start,run,status\n1,2,3,0,4\n", "record 2: 5 fields"},
+		{named, "id,start,run,status\n1,2,3,x\n", "malformed event status"},
+		{named, "id,start,run,status\n1,2016-08-08,3,0\n",
+			"malformed event start time"},
+		{named, "id,start,run,status\n1,2016-08-08T12:34:56,3,0\n",
+			"malformed event start time"},
+		{`{"header": true, "columns": {"id": 0, "start": 1, "run": 2,
+			"status": 5}}`,
+			"id,start,run,status\n1,2,3,0\n", "record 1: 4 columns"},
+		{`{"columns": {"id": 0, "start": 1, "run": 2, "status": 5}}`,
+			"1,2,3,0\n", "record 1: 4 fields, expected at least 6"},
+		{`{}`, "1,2,3,4,0,3,100\n", "record 1: 7 fields, expected 8"}}
+	for _, c := range cases {
+		_, err := convertWithSchema(c.schema, c.csv)
+		if err == nil || !strings.Contains(err.Error(), c.reason) {
+			t.Errorf("%q: error %v, expected %q", c.csv, err, c.reason)
+		}
+	}
+}
+
+func TestParseTimestamp(t *testing.T) {
+	s := int64(time.Second)
+	cases := []struct {
+		value string
+		bits  int
+		unit  int64
+		t     int64
+		valid bool
+	}{
+		{"1470659696", 32, s, 1470659696 * s, true},
+		{"2016-08-08T12:34:56Z", 32, s, 1470659696 * s, true},
+		{"2016-08-08T14:34:56+02:00", 32, s, 1470659696 * s, true},
+		{"2016-08-08T12:34:56.789Z", 32, s, 1470659696 * s, true},
+		{"2016-08-08T12:34:56.789Z", 64, 1e6, 1470659696789 * 1e6, true},
+		{"2100-01-01T00:00:00Z", 32, s, 0, false},
+		{"2100-01-01T00:00:00Z", 64, s, 4102444800 * s, true},
+		{"3000-01-01T00:00:00Z", 64, 1, 0, false},
+		{"2016-08-08 12:34:56", 64, s, 0, false}}
+	for _, c := range cases {
+		ts, err := parseTimestamp(c.value, c.bits, c.unit)
+		if c.valid && (err != nil || ts != c.t) || !c.valid && err == nil {
+			t.Errorf("%q (%d bits) parsed as %d: %v", c.value, c.bits, ts, err)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+// Perspective: Graphing library for quality control in event-driven systems
+
+// Copyright (C) 2016 Christian Paro <christian.paro@gmail.com>,
+//                                   <cparo@digitalocean.com>
+
+// This program is free software: you can redistribute it and/or modify it under
+// the terms of the GNU General Public License version 2 as published by the
+// Free Software Foundation.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+
+// You should have received a copy of the GNU General Public License along with
+// this program. If not, see <http://www.gnu.org/licenses/>.
+
+package feeds
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/cparo/perspective"
+	"io"
+	"time"
+)
+
+// StalledEvent describes an in-progress event which is progressing at less
+// than the expected rate, with its type and region named as in the metadata of
+// its feed (if they are named there).
+type StalledEvent struct {
+	ID       int64   `json:"id"`       // Event identifier
+	Start    int64   `json:"start"`    // Start time, in ns since the epoch
+	Elapsed  float64 `json:"elapsed"`  // Run time so far, in seconds
+	Progress uint8   `json:"progress"` // Progress percentage
+	Rate     float64 `json:"rate"`     // Progress rate, in percent per hour
+
+	// Type and region of the event, by code and by name.
+	Type       uint8  `json:"type"`
+	TypeName   string `json:"type_name,omitempty"`
+	Region     uint8  `json:"region"`
+	RegionName string `json:"region_name,omitempty"`
+}
+
+// ListStalledEvents reads a binary-log formatted event-data dump and writes out
+// a JSON array describing the in-progress events which match the specified
+// filtering criteria and are progressing at less than the given rate (in
+// percentage points per hour of their run time so far). If the context is done
+// before all events have been read, the context's error is returned and nothing
+// is written.
+func ListStalledEvents(
+	ctx context.Context,
+	feed *Feed,
+	tA int64,
+	tΩ int64,
+	typeFilter int,
+	regionFilter int,
+	minRate float64,
+	out io.Writer) error {
+
+	stalled := []StalledEvent{}
+	names := feed.Names()
+	var scratch perspective.EventData64
+	for i := 0; i < feed.Len(); i++ {
+		if i%cancelCheckEvents == 0 && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		e := feed.event(i, &scratch)
+		if !eventFilter(e, tA, tΩ, typeFilter, regionFilter, 1) {
+			continue
+		}
+		if rate := perspective.ProgressRate(e); rate < minRate {
+			stalled = append(stalled, StalledEvent{
+				e.ID,
+				e.Start,
+				float64(e.Run) / float64(time.Second),
+				e.Progress,
+				rate,
+				e.Type,
+				names.Types.Name(e.Type),
+				e.Region,
+				names.Regions.Name(e.Region)})
+		}
+	}
+	return json.NewEncoder(out).Encode(stalled)
+}
@@ -0,0 +1,54 @@
+// Perspective: Graphing library for quality control in event-driven systems
+
+// Copyright (C) 2016 Christian Paro <christian.paro@gmail.com>,
+//                                   <cparo@digitalocean.com>
+
+// This program is free software: you can redistribute it and/or modify it under
+// the terms of the GNU General Public License version 2 as published by the
+// Free Software Foundation.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+
+// You should have received a copy of the GNU General Public License along with
+// this program. If not, see <http://www.gnu.org/licenses/>.
+
+package feeds
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/cparo/perspective"
+	"testing"
+	"time"
+)
+
+func TestListStalledEvents(t *testing.T) {
+	h := int64(time.Hour)
+	feed := NewFeed64([]perspective.EventData64{
+		{ID: 1, Start: h, Run: 2 * h, Status: -1, Progress: 10},     // Stalled
+		{ID: 2, Start: h, Run: 2 * h, Status: -1, Progress: 90},     // Fine
+		{ID: 3, Start: h, Run: 2 * h, Status: 0, Progress: 10},      // Done
+		{ID: 4, Start: h, Run: 0, Status: -1, Progress: 0},          // New
+		{ID: 5, Start: 9 * h, Run: 2 * h, Status: -1, Progress: 0}}, // Late
+		1)
+	var out bytes.Buffer
+	ctx := context.Background()
+	err := ListStalledEvents(ctx, feed, 0, 8*h, -1, -1, 10, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stalled []StalledEvent
+	if err := json.Unmarshal(out.Bytes(), &stalled); err != nil {
+		t.Fatal(err)
+	}
+	if len(stalled) != 1 || stalled[0].ID != 1 {
+		t.Fatalf("Listed %+v as stalled, expected only event 1", stalled)
+	}
+	if stalled[0].Rate != 5 || stalled[0].Elapsed != 7200 {
+		t.Errorf("Stalled event listed as %+v", stalled[0])
+	}
+}
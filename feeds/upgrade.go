@@ -0,0 +1,99 @@
+// Perspective: Graphing library for quality control in event-driven systems
+
+// Copyright (C) 2016 Christian Paro <christian.paro@gmail.com>,
+//                                   <cparo@digitalocean.com>
+
+// This program is free software: you can redistribute it and/or modify it under
+// the terms of the GNU General Public License version 2 as published by the
+// Free Software Foundation.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+
+// You should have received a copy of the GNU General Public License along with
+// this program. If not, see <http://www.gnu.org/licenses/>.
+
+package feeds
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"github.com/cparo/perspective"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Number of events converted at a time when upgrading a binary log.
+const upgradeChunkSize = 1 << 12
+
+// UpgradeBinLog rewrites a binary log in the original format, with 32-bit times
+// which overflow in 2038, into the high-resolution format, with 64-bit times.
+// The input and output paths may be the same, to upgrade a binary log in place,
+// as the upgraded log is written to a temporary file alongside the output path
+// and only moved into place once it is complete.
+func UpgradeBinLog(iPath string, oPath string) error {
+
+	feed := MapBinLogFile(iPath, 0)
+	if feed == nil {
+		return fmt.Errorf("failed to map binary log \"%s\"", iPath)
+	}
+	defer UnmapBinLogFile(feed)
+
+	if feed.HighResolution() {
+		return fmt.Errorf(
+			"binary log \"%s\" is already in the high-resolution format",
+			iPath)
+	}
+
+	iStat, err := os.Stat(iPath)
+	if err != nil {
+		return err
+	}
+
+	oFile, err := ioutil.TempFile(
+		filepath.Dir(oPath),
+		"."+filepath.Base(oPath)+".")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(oFile.Name())
+	defer oFile.Close()
+
+	binWriter := bufio.NewWriter(oFile)
+	err = writeHeader(binWriter, feed.resolution)
+	if err != nil {
+		return err
+	}
+	chunk := make([]perspective.EventData64, 0, upgradeChunkSize)
+	for i := 0; i < feed.Len(); i += upgradeChunkSize {
+		chunk = chunk[:0]
+		for j := i; j < i+upgradeChunkSize && j < feed.Len(); j++ {
+			chunk = chunk[:len(chunk)+1]
+			feed.events[j].Widen(&chunk[len(chunk)-1])
+		}
+		err = binary.Write(binWriter, binary.LittleEndian, chunk)
+		if err != nil {
+			return err
+		}
+	}
+	err = binWriter.Flush()
+	if err != nil {
+		return err
+	}
+
+	// Keep the permissions of the original binary log, rather than those of a
+	// temporary file.
+	err = oFile.Chmod(iStat.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	err = oFile.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(oFile.Name(), oPath)
+}
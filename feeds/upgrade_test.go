@@ -0,0 +1,67 @@
+// Perspective: Graphing library for quality control in event-driven systems
+
+// Copyright (C) 2016 Christian Paro <christian.paro@gmail.com>,
+//                                   <cparo@digitalocean.com>
+
+// This program is free software: you can redistribute it and/or modify it under
+// the terms of the GNU General Public License version 2 as published by the
+// Free Software Foundation.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+
+// You should have received a copy of the GNU General Public License along with
+// this program. If not, see <http://www.gnu.org/licenses/>.
+
+package feeds
+
+import (
+	"github.com/cparo/perspective"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestUpgradeBinLog(t *testing.T) {
+	events := benchEventData()[:10000]
+	path, cleanup := writeBinLog(t, 0, events)
+	defer cleanup()
+
+	// Upgrade in place, as is done by the feed-upgrade command.
+	if err := UpgradeBinLog(path, path); err != nil {
+		t.Fatal(err)
+	}
+	upgraded := MapBinLogFile(path, 0)
+	if upgraded == nil {
+		t.Fatal("Failed to map upgraded binary log.")
+	}
+	defer UnmapBinLogFile(upgraded)
+	if !upgraded.HighResolution() {
+		t.Fatal("Upgraded binary log is not in the high-resolution format.")
+	}
+	if upgraded.Resolution() != int64(time.Second) {
+		t.Errorf("Upgraded resolution %d, expected 1s", upgraded.Resolution())
+	}
+	if upgraded.Len() != len(events) {
+		t.Fatalf("Upgraded %d events, expected %d", upgraded.Len(), len(events))
+	}
+	var expected perspective.EventData64
+	for i := range events {
+		events[i].Widen(&expected)
+		if upgraded.events64[i] != expected {
+			t.Fatalf("Event %d upgraded as %+v, expected %+v",
+				i, upgraded.events64[i], expected)
+		}
+	}
+
+	// Upgrading again should fail without touching the binary log.
+	stat, _ := os.Stat(path)
+	if err := UpgradeBinLog(path, path); err == nil {
+		t.Error("Upgrade of a high-resolution binary log did not fail.")
+	}
+	if restat, _ := os.Stat(path); !os.SameFile(stat, restat) {
+		t.Error("Failed upgrade replaced the binary log.")
+	}
+}
@@ -0,0 +1,288 @@
+// Perspective: Graphing library for quality control in event-driven systems
+
+// Copyright (C) 2016 Christian Paro <christian.paro@gmail.com>,
+//                                   <cparo@digitalocean.com>
+
+// This program is free software: you can redistribute it and/or modify it under
+// the terms of the GNU General Public License version 2 as published by the
+// Free Software Foundation.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+
+// You should have received a copy of the GNU General Public License along with
+// this program. If not, see <http://www.gnu.org/licenses/>.
+
+package perspective
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"sort"
+)
+
+// Limit on the number of events drawn in a Gantt chart, which bounds the memory
+// held for them while recording.
+const maxGanttEvents = 100000
+
+// An event as drawn on a Gantt chart.
+type ganttBar struct {
+	start    int64 // Start time of the event
+	end      int64 // End time of the event, or its latest time if in-progress
+	group    int   // Group of the event, for assignment to rows
+	status   int8  // Status of the event
+	progress uint8 // Progress percentage of the event
+}
+
+type gantt struct {
+	w        int        // Width of the visualization
+	h        int        // Height of the visualization
+	bg       int        // Background gray level
+	tA       int64      // Lower limit of time range to be visualized
+	tτ       float64    // Length of time range to be visualized
+	grouping Grouping   // Grouping of events into rows
+	limit    int        // Maximum number of events to draw, if positive
+	bars     []ganttBar // Events to be drawn
+	dropped  int        // Number of events left out over the limit
+	tDropped int64      // Earliest start time of the events left out
+	xGrid    int        // Number of vertical grid divisions
+	names    groupNames // Names of event types and regions, for labels
+}
+
+func init() {
+	RegisterVisualizer(&VisualizerSpec{
+		"vis-gantt",
+		"Gantt chart of individual events, in rows by group.",
+		timeRangeParams(
+			GroupByParam,
+			Param{
+				"max-events", "", IntParam, "1000", nil,
+				between(1, maxGanttEvents),
+				"Maximum number of events to draw in a Gantt chart."},
+			XGridParam),
+		allChecks(CheckTimeRange, checkArea(maxArea)),
+		func(p Params) Visualizer {
+			return NewGantt(
+				p.Int("width"), p.Int("height"), p.Int("bg"),
+				p.Time("min-time"), p.Time("max-time"), p.grouping(),
+				p.Int("max-events"), p.Int("x-grid"))
+		}})
+}
+
+// NewGantt returns a Gantt-chart-visualization generator, which draws each
+// event as a horizontal bar spanning its run time, colored by status, in rows
+// grouped by the given grouping. Events within a group are packed into as few
+// rows as they can be without overlapping. In-progress events are drawn dimly
+// for their run time so far, with the share of it given by their progress
+// percentage drawn brightly. Events still in flight at the start of the time
+// range are drawn from its left edge. If a positive limit is given, only that
+// many of the earliest-starting events are drawn, and the point in time beyond
+// which events have been left out is marked.
+func NewGantt(
+	width int,
+	height int,
+	bg int,
+	minTime int64,
+	maxTime int64,
+	grouping Grouping,
+	limit int,
+	xGrid int) Visualizer {
+
+	return &gantt{
+		width,
+		height,
+		bg,
+		minTime,
+		float64(maxTime - minTime),
+		grouping,
+		limit,
+		nil,
+		0,
+		math.MaxInt64,
+		xGrid,
+		groupNames{}}
+}
+
+// Record accepts an EventData64 pointer and adds it to the visualization.
+func (v *gantt) Record(e *EventData64) {
+	end := e.Start + e.Run
+	if e.Run < 0 {
+		end = e.Start
+	}
+	if end < v.tA || float64(e.Start-v.tA) > v.tτ {
+		return
+	}
+	v.bars = append(
+		v.bars,
+		ganttBar{e.Start, end, v.grouping.group(e), e.Status, e.Progress})
+
+	// Trim the recorded events back down to the limit whenever they reach
+	// twice the limit, so memory use stays bounded without having to sort
+	// the events each time one is recorded.
+	if v.limit > 0 && len(v.bars) >= 2*v.limit {
+		v.trim()
+	}
+}
+
+// Sorts the recorded events by start time, and leaves out any beyond the limit.
+func (v *gantt) trim() {
+	sort.Slice(v.bars, func(i, j int) bool {
+		return v.bars[i].start < v.bars[j].start
+	})
+	if v.limit > 0 && len(v.bars) > v.limit {
+		v.dropped += len(v.bars) - v.limit
+		if v.bars[v.limit].start < v.tDropped {
+			v.tDropped = v.bars[v.limit].start
+		}
+		v.bars = v.bars[:v.limit]
+	}
+}
+
+// Shard returns an empty Gantt-chart-visualization generator with the same
+// configuration, for recording a share of the events in parallel.
+func (v *gantt) Shard() ShardedVisualizer {
+	shard := *v
+	shard.bars = nil
+	shard.dropped = 0
+	shard.tDropped = math.MaxInt64
+	return &shard
+}
+
+// Merge folds the events recorded by a shard back into the visualization.
+func (v *gantt) Merge(shard ShardedVisualizer) {
+	o := shard.(*gantt)
+	v.bars = append(v.bars, o.bars...)
+	v.dropped += o.dropped
+	if o.tDropped < v.tDropped {
+		v.tDropped = o.tDropped
+	}
+	v.trim()
+}
+
+// SetNames sets the names of event types and regions, by code, with which the
+// groups of rows are labeled.
+func (v *gantt) SetNames(types map[uint8]string, regions map[uint8]string) {
+	v.names = groupNames{types, regions}
+}
+
+// InFlight marks the Gantt chart as one which draws events over the span of
+// time they were in flight.
+func (v *gantt) InFlight() {}
+
+// Truncated returns the number of events left out of the visualization for
+// exceeding its limit.
+func (v *gantt) Truncated() int {
+	v.trim()
+	return v.dropped
+}
+
+// Render returns the visualization constructed from all previously-recorded
+// data points.
+func (v *gantt) Render() image.Image {
+
+	vis := initializeVisualization(v.w, v.h, v.bg)
+	if v.xGrid > 0 {
+		for i := 1; i < v.xGrid; i++ {
+			drawXGridLine(vis, i*v.w/v.xGrid)
+		}
+	}
+	v.trim()
+
+	// Pack the events of each group into rows, placing each event in the first
+	// row of its group which is clear by the time it starts.
+	var groups []int
+	rowEnds := make([][]int64, maxGroups)
+	rows := make([]int, len(v.bars))
+	for i, b := range v.bars {
+		if rowEnds[b.group] == nil {
+			groups = append(groups, b.group)
+		}
+		r := 0
+		for r < len(rowEnds[b.group]) && rowEnds[b.group][r] > b.start {
+			r++
+		}
+		if r == len(rowEnds[b.group]) {
+			rowEnds[b.group] = append(rowEnds[b.group], b.end)
+		} else {
+			rowEnds[b.group][r] = b.end
+		}
+		rows[i] = r
+	}
+
+	// Lay out the groups from the top in order, with a grid line between each.
+	sort.Ints(groups)
+	firstRow := make([]int, maxGroups)
+	total := 0
+	for _, g := range groups {
+		firstRow[g] = total
+		total += len(rowEnds[g])
+	}
+	rowHeight := math.Max(1, float64(v.h)/math.Max(float64(total), 1))
+	for _, g := range groups {
+		if firstRow[g] > 0 {
+			drawYGridLine(vis, int(float64(firstRow[g])*rowHeight))
+		}
+	}
+
+	// Draw the bars, leaving a gap between rows which are tall enough for it.
+	for i, b := range v.bars {
+		yMin := int(float64(firstRow[b.group]+rows[i]) * rowHeight)
+		yMax := int(float64(firstRow[b.group]+rows[i]+1) * rowHeight)
+		if yMax-yMin >= 3 {
+			yMin++
+		}
+		if yMax > v.h {
+			yMax = v.h
+		}
+		a := math.Floor(float64(v.w) * float64(b.start-v.tA) / v.tτ)
+		z := math.Floor(float64(v.w) * float64(b.end-v.tA) / v.tτ)
+		if z <= a {
+			z = a + 1
+		}
+		c := statusGroupColors[statusGroup(b.status)]
+		done := z
+		if b.status < 0 {
+			done = a + math.Floor((z-a)*float64(b.progress)/100)
+		}
+
+		// Bars are clamped to the canvas only once the share of an in-progress
+		// bar to be drawn brightly is worked out from the whole of its span.
+		w := float64(v.w)
+		xMin := int(math.Max(0, a))
+		xMax := int(math.Min(w, z))
+		xDone := int(math.Max(0, math.Min(w, done)))
+		dim := color.RGBA{c.R / 2, c.G / 2, c.B / 2, opaque}
+		for y := yMin; y < yMax; y++ {
+			for x := xMin; x < xMax; x++ {
+				if x < xDone {
+					*getRGBA(vis, x, y) = c
+				} else {
+					*getRGBA(vis, x, y) = dim
+				}
+			}
+		}
+	}
+
+	// Label each group with a name at the top-left of its rows, if they leave
+	// room for it below the grid line above them.
+	for _, g := range groups {
+		name := v.grouping.name(v.names, g)
+		if name == "" ||
+			float64(len(rowEnds[g]))*rowHeight < float64(glyphH+3) {
+			continue
+		}
+		y := int(float64(firstRow[g])*rowHeight) + 1
+		drawLabelBox(vis, v.bg, 0, y, labelText(name))
+	}
+
+	// Mark the point beyond which events were left out.
+	if v.dropped > 0 {
+		x := float64(v.w) * float64(v.tDropped-v.tA) / v.tτ
+		drawXClipLine(vis, int(math.Max(0, math.Min(float64(v.w-1), x))))
+	}
+
+	return vis
+}
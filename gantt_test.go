@@ -0,0 +1,143 @@
+// Perspective: Graphing library for quality control in event-driven systems
+
+// Copyright (C) 2016 Christian Paro <christian.paro@gmail.com>,
+//                                   <cparo@digitalocean.com>
+
+// This program is free software: you can redistribute it and/or modify it under
+// the terms of the GNU General Public License version 2 as published by the
+// Free Software Foundation.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+
+// You should have received a copy of the GNU General Public License along with
+// this program. If not, see <http://www.gnu.org/licenses/>.
+
+package perspective
+
+import (
+	"image/color"
+	"testing"
+	"time"
+)
+
+// Only the earliest events up to the limit should be kept, however they are
+// split between shards and in whatever order they are recorded.
+func TestGanttTruncation(t *testing.T) {
+	events := syntheticEvents(1000, 1)
+	v := NewGantt(256, 128, 32, testA, testΩ, GroupType, 100, 0).(*gantt)
+	shard := v.Shard().(*gantt)
+	for i := len(events) - 1; i >= 0; i-- {
+		if i%2 == 0 {
+			v.Record(&events[i])
+		} else {
+			shard.Record(&events[i])
+		}
+	}
+	v.Merge(shard)
+	if v.Truncated() != 900 {
+		t.Errorf("Truncated %d events, expected 900", v.Truncated())
+	}
+	if len(v.bars) != 100 {
+		t.Fatalf("Kept %d events, expected 100", len(v.bars))
+	}
+	for i := range v.bars {
+		if v.bars[i].start != events[i].Start {
+			t.Fatalf("Kept event %d starting at %d, expected %d",
+				i, v.bars[i].start, events[i].Start)
+		}
+	}
+	if v.tDropped != events[100].Start {
+		t.Errorf("Truncation marked at %d, expected %d",
+			v.tDropped, events[100].Start)
+	}
+}
+
+// Bars spanning far beyond the time range should be clamped to the canvas
+// rather than drawn pixel by pixel across their whole span.
+func TestGanttClampsBars(t *testing.T) {
+	s := int64(time.Second)
+	tA := testA + 30*86400*s
+	v := NewGantt(1024, 16, 32, tA, tA+600*s, GroupStatus, 100, 0)
+	v.Record(&EventData64{Start: testA, Run: 60 * 86400 * s})
+	v.Record(&EventData64{
+		Start: tA + 300*s, Run: 30 * 86400 * s, Status: -1, Progress: 1})
+	began := time.Now()
+	vis := toRGBA(v.Render())
+	if elapsed := time.Since(began); elapsed > time.Second {
+		t.Errorf("Rendered in %v", elapsed)
+	}
+
+	// The in-progress bar, in the top row, starts halfway and is drawn brightly
+	// to the end, with only the first 1% of its span done. The successful bar,
+	// in the bottom row, spans the whole width.
+	running := statusGroupColors[statusGroup(-1)]
+	if c := vis.RGBAAt(511, 4); c == running {
+		t.Errorf("In-progress bar drawn before its start")
+	}
+	for _, x := range []int{512, 1023} {
+		if c := vis.RGBAAt(x, 4); c != running {
+			t.Errorf("In-progress bar colored %v at %d", c, x)
+		}
+	}
+	done := statusGroupColors[statusGroup(0)]
+	for _, x := range []int{0, 511, 1023} {
+		if c := vis.RGBAAt(x, 12); c != done {
+			t.Errorf("Successful bar colored %v at %d", c, x)
+		}
+	}
+}
+
+// The server has no other bound on the events held by a Gantt chart, so its
+// limit can neither be lifted nor set beyond the maximum.
+func TestGanttLimitBounded(t *testing.T) {
+	spec := LookupVisualizer("vis-gantt")
+	for _, limit := range []string{"0", "-1", "100001"} {
+		rejected := false
+		ParseParams(
+			spec.Params,
+			func(name string) string {
+				if name == "max-events" {
+					return limit
+				}
+				return ""
+			},
+			func(*ParamError) { rejected = true })
+		if !rejected {
+			t.Errorf("Accepted max-events=%s", limit)
+		}
+	}
+}
+
+// Groups of rows with names should be labeled at their top-left, over their
+// bars, and those without left unlabeled.
+func TestGanttLabels(t *testing.T) {
+	s := int64(time.Second)
+	v := NewGantt(64, 32, 32, testA, testA+60*s, GroupRegion, 100, 0)
+	v.(LabeledVisualizer).SetNames(nil, map[uint8]string{3: "x"})
+	v.Record(&EventData64{Start: testA, Run: 60 * s, Region: 3})
+	v.Record(&EventData64{Start: testA, Run: 60 * s, Region: 5})
+	vis := toRGBA(v.Render())
+
+	// Each region has a row 16 pixels high, with the label for region 3 boxed
+	// from the pixel below the top of its row.
+	label := color.RGBA{labelGray, labelGray, labelGray, opaque}
+	bg := color.RGBA{32, 32, 32, opaque}
+	done := statusGroupColors[statusGroup(0)]
+	cases := []struct {
+		x, y     int
+		expected color.RGBA
+	}{
+		{1, 2, label},         // Top-left of the "X"
+		{2, 2, bg},            // Gap in the "X"
+		{glyphW + 2, 2, done}, // Beyond the box
+		{1, 16 + 2, done}}     // Region 5, without a name
+	for _, c := range cases {
+		if vis.RGBAAt(c.x, c.y) != c.expected {
+			t.Errorf("Gantt chart has %v at (%d, %d), expected %v",
+				vis.RGBAAt(c.x, c.y), c.x, c.y, c.expected)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+// Perspective: Graphing library for quality control in event-driven systems
+
+// Copyright (C) 2016 Christian Paro <christian.paro@gmail.com>,
+//                                   <cparo@digitalocean.com>
+
+// This program is free software: you can redistribute it and/or modify it under
+// the terms of the GNU General Public License version 2 as published by the
+// Free Software Foundation.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+
+// You should have received a copy of the GNU General Public License along with
+// this program. If not, see <http://www.gnu.org/licenses/>.
+
+package perspective
+
+import (
+	"fmt"
+	"image/color"
+)
+
+// Grouping selects the event attribute by which a visualization separates
+// events into groups, such as the layers of a stacked plot.
+type Grouping int
+
+const (
+	// GroupStatus groups events as failed, in-progress or successful.
+	GroupStatus Grouping = iota
+	// GroupType groups events by their type.
+	GroupType
+	// GroupRegion groups events by their region.
+	GroupRegion
+)
+
+// Number of possible groups for any grouping, as types and regions are both
+// stored as uint8 values.
+const maxGroups = 256
+
+var groupingNames = map[Grouping]string{
+	GroupStatus: "status",
+	GroupType:   "type",
+	GroupRegion: "region",
+}
+
+// Names of event types and regions, by code, for labeling groups of events.
+type groupNames struct {
+	types   map[uint8]string
+	regions map[uint8]string
+}
+
+// Colors for groups of events by status, in group order.
+var statusGroupColors = []color.RGBA{
+	{191, 33, 33, opaque}, // Failed
+	{33, 191, 83, opaque}, // In progress
+	{83, 83, 191, opaque}, // Successful
+}
+
+// ParseGrouping returns the grouping with the given name ("status", "type" or
+// "region").
+func ParseGrouping(name string) (Grouping, error) {
+	for g, n := range groupingNames {
+		if n == name {
+			return g, nil
+		}
+	}
+	return GroupStatus, fmt.Errorf("unrecognized grouping: \"%s\"", name)
+}
+
+func (g Grouping) String() string {
+	return groupingNames[g]
+}
+
+// Returns the group of the given event, from 0 to maxGroups-1. Groups by status
+// are ordered from failed through in-progress to successful.
+func (g Grouping) group(e *EventData64) int {
+	switch g {
+	case GroupType:
+		return int(e.Type)
+	case GroupRegion:
+		return int(e.Region)
+	}
+	return statusGroup(e.Status)
+}
+
+// Returns the group for events of the given status, when grouped by status.
+func statusGroup(status int8) int {
+	if status > 0 {
+		return 0
+	} else if status < 0 {
+		return 1
+	}
+	return 2
+}
+
+// Returns the color for the given group, which is the rank-th of n groups
+// present in a visualization. Groups by type or region are spread evenly along
+// the color ramp.
+func (g Grouping) color(group int, rank int, n int) color.RGBA {
+	if g == GroupStatus {
+		return statusGroupColors[group]
+	}
+	if n <= 1 {
+		return rampColor(0.5)
+	}
+	return rampColor(float64(rank) / float64(n-1))
+}
+
+// Returns the name of the given group, or an empty string if it has none.
+// Groups by status are left unnamed, as their colors are the same throughout.
+func (g Grouping) name(names groupNames, group int) string {
+	switch g {
+	case GroupType:
+		return names.types[uint8(group)]
+	case GroupRegion:
+		return names.regions[uint8(group)]
+	}
+	return ""
+}
@@ -0,0 +1,201 @@
+// Perspective: Graphing library for quality control in event-driven systems
+
+// Copyright (C) 2016 Christian Paro <christian.paro@gmail.com>,
+//                                   <cparo@digitalocean.com>
+
+// This program is free software: you can redistribute it and/or modify it under
+// the terms of the GNU General Public License version 2 as published by the
+// Free Software Foundation.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+
+// You should have received a copy of the GNU General Public License along with
+// this program. If not, see <http://www.gnu.org/licenses/>.
+
+package perspective
+
+import (
+	"image"
+	"math"
+)
+
+type heatmap struct {
+	w      int         // Width of the visualization
+	h      int         // Height of the visualization
+	pw     int         // Width of the plot area, less any legend
+	bg     int         // Background gray level
+	tA     int64       // Lower limit of time range to be visualized
+	tτ     float64     // Length of time range to be visualized
+	axis   RunTimeAxis // Mapping of run times to the y-axis
+	clips  axisClips   // Counts of events clipped at run-time axis bounds
+	xBins  int         // Number of start-time bins
+	yBins  int         // Number of run-time bins
+	counts []int       // Counts of events by bin, in rows from the bottom
+	scale  CountScale  // Scaling of counts onto the color ramp
+	xGrid  int         // Number of vertical grid divisions
+	legend bool        // Whether to include a color-scale legend
+}
+
+func init() {
+	RegisterVisualizer(&VisualizerSpec{
+		"vis-heatmap",
+		"Heatmap of event counts by start time and run time.",
+		timeRangeParams(
+			withAxis(
+				XBinsParam,
+				YBinsParam,
+				CountScaleParam,
+				XGridParam,
+				LegendParam)...),
+		allChecks(CheckTimeRange, checkAxis, checkArea(maxArea)),
+		func(p Params) Visualizer {
+			return NewHeatmap(
+				p.Int("width"), p.Int("height"), p.Int("bg"),
+				p.Time("min-time"), p.Time("max-time"), p.runTimeAxis(),
+				p.Int("x-bins"), p.Int("y-bins"), p.countScale(),
+				p.Int("x-grid"), p.Bool("legend"))
+		}})
+}
+
+// NewHeatmap returns a heatmap-visualization generator, which bins events into
+// cells by start time and run time and colors each cell by the number of events
+// in it, on a perceptually-uniform color ramp. Bin counts are limited to the
+// size of the plot area, so cells are always at least a pixel in size.
+func NewHeatmap(
+	width int,
+	height int,
+	bg int,
+	minTime int64,
+	maxTime int64,
+	axis RunTimeAxis,
+	xBins int,
+	yBins int,
+	scale CountScale,
+	xGrid int,
+	legend bool) Visualizer {
+
+	plotWidth := width
+	if legend {
+		plotWidth = width - legendWidth
+	}
+	xBins = int(math.Max(1, math.Min(float64(xBins), float64(plotWidth))))
+	yBins = int(math.Max(1, math.Min(float64(yBins), float64(height))))
+
+	return &heatmap{
+		width,
+		height,
+		plotWidth,
+		bg,
+		minTime,
+		float64(maxTime - minTime),
+		axis.fitted(height),
+		axisClips{},
+		xBins,
+		yBins,
+		make([]int, xBins*yBins),
+		scale,
+		xGrid,
+		legend}
+}
+
+// Record accepts an EventData64 pointer and counts it in its bin.
+func (v *heatmap) Record(e *EventData64) {
+
+	col := int(float64(v.xBins) * float64(e.Start-v.tA) / v.tτ)
+	if col < 0 || col >= v.xBins {
+		return
+	}
+
+	// Run times clipped at the bounds of the run-time axis are counted in the
+	// bottom or top row of bins, as are those below the origin of an axis with
+	// no minimum set in the bottom row. Those beyond the top of the plot are
+	// clipped there too, though the axis has no maximum to clip them.
+	yOffset, clip := v.axis.flooredOffset(seconds(e.Run))
+	if yOffset > float64(v.h) {
+		clip = 1
+	}
+	v.clips.count(clip)
+	row := int(yOffset * float64(v.yBins) / float64(v.h))
+	if row >= v.yBins {
+		row = v.yBins - 1
+	}
+
+	v.counts[row*v.xBins+col]++
+}
+
+// Shard returns an empty heatmap-visualization generator with the same
+// configuration, for recording a share of the events in parallel.
+func (v *heatmap) Shard() ShardedVisualizer {
+	shard := *v
+	shard.counts = make([]int, len(v.counts))
+	return &shard
+}
+
+// Merge folds the counts of a shard back into the visualization.
+func (v *heatmap) Merge(shard ShardedVisualizer) {
+	o := shard.(*heatmap)
+	mergeInts(v.counts, o.counts)
+	v.clips.merge(&o.clips)
+}
+
+// Render returns the visualization constructed from all previously-recorded
+// data points.
+func (v *heatmap) Render() image.Image {
+
+	vis := initializeVisualization(v.w, v.h, v.bg)
+	plot := vis.SubImage(image.Rect(0, 0, v.pw, v.h)).(*image.RGBA)
+
+	// Draw the grid first, so it only shows through empty cells.
+	if v.xGrid > 0 {
+		for i := 1; i < v.xGrid; i++ {
+			drawXGridLine(plot, i*v.pw/v.xGrid)
+		}
+	}
+	step := v.axis.gridStep()
+	for y := float64(v.h); y > 0 && step >= minGridStep; y -= step {
+		drawYGridLine(plot, int(y))
+	}
+
+	maxCount := 0
+	for _, count := range v.counts {
+		if count > maxCount {
+			maxCount = count
+		}
+	}
+
+	// Fill each non-empty cell with the color for its count.
+	for row := 0; row < v.yBins; row++ {
+		yMin := v.h - (row+1)*v.h/v.yBins
+		yMax := v.h - row*v.h/v.yBins
+		for col := 0; col < v.xBins; col++ {
+			count := v.counts[row*v.xBins+col]
+			if count == 0 {
+				continue
+			}
+			c := rampColor(v.scale.fraction(count, maxCount))
+			for y := yMin; y < yMax; y++ {
+				for x := col * v.pw / v.xBins; x < (col+1)*v.pw/v.xBins; x++ {
+					*getRGBA(plot, x, y) = c
+				}
+			}
+		}
+	}
+
+	// Mark any bounds at which events were clipped, over the cells they were
+	// counted in.
+	if v.clips.lo > 0 {
+		drawYClipLine(plot, v.h-1)
+	}
+	if v.clips.hi > 0 {
+		drawYClipLine(plot, 0)
+	}
+
+	if v.legend {
+		drawRampLegend(vis, v.scale.ticks(maxCount))
+	}
+
+	return vis
+}
@@ -0,0 +1,44 @@
+// Perspective: Graphing library for quality control in event-driven systems
+
+// Copyright (C) 2016 Christian Paro <christian.paro@gmail.com>,
+//                                   <cparo@digitalocean.com>
+
+// This program is free software: you can redistribute it and/or modify it under
+// the terms of the GNU General Public License version 2 as published by the
+// Free Software Foundation.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+
+// You should have received a copy of the GNU General Public License along with
+// this program. If not, see <http://www.gnu.org/licenses/>.
+
+package perspective
+
+import (
+	"testing"
+	"time"
+)
+
+// Run times beyond the top of the plot are piled into the top row of bins,
+// which should be marked as clipped even with no maximum set on the axis.
+func TestHeatmapClipsOverflow(t *testing.T) {
+	v := NewHeatmap(
+		256, 128, 32, testA, testΩ, NewLog2Axis(16), 64, 32, CountLinear, 0,
+		false).(*heatmap)
+	for _, run := range []int64{250, 1000} {
+		v.Record(&EventData64{Start: testA, Run: run * int64(time.Second)})
+	}
+	if v.clips.hi != 1 || v.clips.lo != 0 {
+		t.Errorf("Clipped %d high and %d low, expected 1 and 0",
+			v.clips.hi, v.clips.lo)
+	}
+	if n := v.counts[31*v.xBins]; n != 2 {
+		t.Errorf("Counted %d events in the top row, expected 2", n)
+	}
+	if c := toRGBA(v.Render()).RGBAAt(128, 0); c != clipColor {
+		t.Errorf("Top of heatmap colored %v, expected a clip marker", c)
+	}
+}
@@ -21,48 +21,85 @@ import (
 	"image"
 	"image/color"
 	"math"
-	"math/rand"
 )
 
+
 type histogram struct {
-	w     int     // Width of the visualization
-	h     int     // Height of the visualization
-	bg    int     // Background grey level
-	yLog2 float64 // Number of pixels over which elapsed times double
-	pass  []int   // Counts of successful events by x-axis position
-	fail  []int   // Counts of failed events by x-axis position
+	w       int         // Width of the visualization
+	h       int         // Height of the visualization
+	bg      int         // Background grey level
+	axis    RunTimeAxis // Mapping of run times to the x-axis
+	clips   axisClips   // Counts of events clipped at run-time axis bounds
+	pass    []int       // Counts of successful events by x-axis position
+	fail    []int       // Counts of failed events by x-axis position
+	jitter  Jitter      // Mode for noise applied to run times
+	quantum float64     // Resolution of recorded run times, in seconds
+}
+
+func init() {
+	RegisterVisualizer(&VisualizerSpec{
+		"vis-histogram",
+		"Histogram of event run times.",
+		sizeParams(withAxis(JitterParam)...),
+		allChecks(checkAxis, checkArea(maxArea)),
+		func(p Params) Visualizer {
+			return NewHistogram(
+				p.Int("width"), p.Int("height"), p.Int("bg"),
+				p.runTimeAxis(), p.jitter())
+		}})
 }
 
 // NewHistogram returns a histogram-visualization generator.
-func NewHistogram(width int, height int, bg int, yLog2 float64) Visualizer {
+func NewHistogram(
+	width int,
+	height int,
+	bg int,
+	axis RunTimeAxis,
+	jitter Jitter) Visualizer {
+
 	return &histogram{
 		width,
 		height,
 		bg,
-		yLog2,
+		axis.fitted(width),
+		axisClips{},
+		make([]int, width),
 		make([]int, width),
-		make([]int, width)}
+		jitter,
+		1}
 }
 
-// Record accepts an EventData pointer and plots it onto the visualization.
-func (v *histogram) Record(e *EventData) {
-
-	// Apply a bit of random "noise" (on a Gaussian distribution, with a
-	// standard deviation of 0.5), to the time scale to avoid Moire patterns
-	// and quantization artifacts which could distract from real patterns or
-	// create a false sense of consistency in the run times of short-lived
-	// events.
-	t := float64(e.Run) + rand.NormFloat64() / 2
-
-	// Run time is hacked to a floor of 1 because a log of zero doesn't
-	// make a lot of sense, and there are some fun cases of events with
-	// negative recorded run times because of clock skew.
-	x := int(v.yLog2 * math.Log2(math.Max(1, t)))
+// Record accepts an EventData64 pointer and plots it onto the visualization.
+func (v *histogram) Record(e *EventData64) {
+
+	// Apply a bit of "noise" (on a Gaussian distribution, with a standard
+	// deviation of half the resolution at which run times were measured), to
+	// the time scale to avoid Moire patterns and quantization artifacts which
+	// could distract from real patterns or create a false sense of consistency
+	// in the run times of short-lived events.
+	t := seconds(e.Run) + v.jitter.offset(e)*v.quantum
+
+	// Run times are floored at the origin of the run-time axis (by default,
+	// 1 because a log of zero doesn't make a lot of sense, and there are some
+	// fun cases of events with negative recorded run times because of clock
+	// skew), and pinned to its minimum and maximum if they are set.
+	// Offsets which are not numbers can't be plotted anywhere, and those
+	// beyond the last x-position are capped before conversion so they can't
+	// overflow it.
+	xOffset, clip := v.axis.flooredOffset(t)
+	if math.IsNaN(xOffset) {
+		return
+	}
+	x := int(math.Min(float64(v.w), xOffset))
+	if clip > 0 && x >= v.w {
+		x = v.w - 1
+	}
 
 	// Discard data which lies beyond the specified bounds for the
 	// rendered visualization, and only record completed events. Incomplete
 	// events are not of interest in this visualization.
-	if x < v.w {
+	if x < v.w && e.Status >= 0 {
+		v.clips.count(clip)
 		if e.Status == 0 {
 			v.pass[x] = v.pass[x] + 1
 		} else if e.Status > 0 {
@@ -71,6 +108,29 @@ func (v *histogram) Record(e *EventData) {
 	}
 }
 
+// Shard returns an empty histogram-visualization generator with the same
+// configuration, for recording a share of the events in parallel.
+func (v *histogram) Shard() ShardedVisualizer {
+	shard := *v
+	shard.pass = make([]int, len(v.pass))
+	shard.fail = make([]int, len(v.fail))
+	return &shard
+}
+
+// Merge folds the counts of a shard back into the visualization.
+func (v *histogram) Merge(shard ShardedVisualizer) {
+	o := shard.(*histogram)
+	mergeInts(v.pass, o.pass)
+	mergeInts(v.fail, o.fail)
+	v.clips.merge(&o.clips)
+}
+
+// SetResolution sets the resolution, in seconds, at which the run times of the
+// events to be recorded were measured, to scale the noise applied to them.
+func (v *histogram) SetResolution(quantum float64) {
+	v.quantum = quantum
+}
+
 // Render returns the visualization constructed from all previously-recorded
 // data points.
 func (v *histogram) Render() image.Image {
@@ -80,11 +140,14 @@ func (v *histogram) Render() image.Image {
 	v.drawGrid(vis)
 
 	// Find the highest point of the histogram to normalize the height of the
-	// masts.
+	// masts, leaving the canvas blank if there are none.
 	maxCount := float64(0)
 	for x := 0; x < v.w; x++ {
 		maxCount = math.Max(maxCount, float64(v.pass[x]+v.fail[x]))
 	}
+	if maxCount == 0 {
+		return vis
+	}
 	scale := float64(v.h) / maxCount
 
 	// Set up our pass and fail colors.
@@ -108,8 +171,16 @@ func (v *histogram) Render() image.Image {
 
 func (v *histogram) drawGrid(vis *image.RGBA) {
 
-	// Draw vertical grid lines on each doubling of the run time in seconds.
-	for x := v.yLog2; x < float64(v.w); x += v.yLog2 {
+	// Draw vertical grid lines on each step along the run-time axis, and mark
+	// any bounds at which events were clipped.
+	step := v.axis.gridStep()
+	for x := step; x < float64(v.w) && step >= minGridStep; x += step {
 		drawXGridLine(vis, int(x))
 	}
+	if v.clips.lo > 0 {
+		drawXClipLine(vis, 0)
+	}
+	if v.clips.hi > 0 {
+		drawXClipLine(vis, v.w-1)
+	}
 }
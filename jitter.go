@@ -0,0 +1,96 @@
+// Perspective: Graphing library for quality control in event-driven systems
+
+// Copyright (C) 2016 Christian Paro <christian.paro@gmail.com>,
+//                                   <cparo@digitalocean.com>
+
+// This program is free software: you can redistribute it and/or modify it under
+// the terms of the GNU General Public License version 2 as published by the
+// Free Software Foundation.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+
+// You should have received a copy of the GNU General Public License along with
+// this program. If not, see <http://www.gnu.org/licenses/>.
+
+package perspective
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// Jitter selects how visualization generators apply a bit of Gaussian noise to
+// event run times, which they do to avoid Moire patterns and quantization
+// artifacts which could distract from real patterns or create a false sense of
+// consistency in the run times of short-lived events.
+type Jitter int
+
+const (
+	// JitterRandom draws fresh noise for every event each time it is recorded,
+	// so repeated renders of the same data will differ slightly.
+	JitterRandom Jitter = iota
+	// JitterNone plots events at their exact recorded run times.
+	JitterNone
+	// JitterSeeded derives the noise for each event from its ID, so each data
+	// point lands in the same place every time the same data is rendered.
+	JitterSeeded
+)
+
+var jitterNames = map[Jitter]string{
+	JitterRandom: "random",
+	JitterNone:   "none",
+	JitterSeeded: "seeded",
+}
+
+// ParseJitter returns the jitter mode with the given name ("random", "none" or
+// "seeded").
+func ParseJitter(name string) (Jitter, error) {
+	for j, n := range jitterNames {
+		if n == name {
+			return j, nil
+		}
+	}
+	return JitterRandom, fmt.Errorf("unrecognized jitter mode: \"%s\"", name)
+}
+
+func (j Jitter) String() string {
+	return jitterNames[j]
+}
+
+// Returns the noise to be added to the given event's run time, on a Gaussian
+// distribution with a standard deviation of 0.5, in units of the resolution at
+// which the run time was measured.
+func (j Jitter) offset(e *EventData64) float64 {
+	switch j {
+	case JitterNone:
+		return 0
+	case JitterSeeded:
+		return seededNormFloat64(uint64(e.ID)) / 2
+	}
+	return rand.NormFloat64() / 2
+}
+
+// Returns a normally-distributed value which is a pure function of the given
+// seed, by hashing it to a pair of uniform values (with the SplitMix64 mixing
+// function) and applying the Box-Muller transform. This is much cheaper than
+// seeding a new rand.Source per event, and is safe for concurrent use.
+func seededNormFloat64(seed uint64) float64 {
+	a := splitMix64(seed)
+	b := splitMix64(a)
+	// Use the top 53 bits of each hash as a float in (0, 1], avoiding a zero
+	// input to the logarithm.
+	u1 := float64(a>>11+1) / (1 << 53)
+	u2 := float64(b>>11) / (1 << 53)
+	return math.Sqrt(-2*math.Log(u1)) * math.Cos(2*math.Pi*u2)
+}
+
+func splitMix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
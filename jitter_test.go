@@ -0,0 +1,59 @@
+// Perspective: Graphing library for quality control in event-driven systems
+
+// Copyright (C) 2016 Christian Paro <christian.paro@gmail.com>,
+//                                   <cparo@digitalocean.com>
+
+// This program is free software: you can redistribute it and/or modify it under
+// the terms of the GNU General Public License version 2 as published by the
+// Free Software Foundation.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+
+// You should have received a copy of the GNU General Public License along with
+// this program. If not, see <http://www.gnu.org/licenses/>.
+
+package perspective
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseJitter(t *testing.T) {
+	for _, j := range []Jitter{JitterRandom, JitterNone, JitterSeeded} {
+		parsed, err := ParseJitter(j.String())
+		if err != nil || parsed != j {
+			t.Errorf("Parsed \"%s\" as %v (%v)", j, parsed, err)
+		}
+	}
+	if _, err := ParseJitter("bogus"); err == nil {
+		t.Error("Parsed an unrecognized jitter mode without error.")
+	}
+}
+
+// Seeded jitter should be stable for a given event ID, and should follow the
+// same distribution (standard deviation of 0.5) as the random jitter.
+func TestSeededJitter(t *testing.T) {
+	const n = 100000
+	var sum, sumSquares float64
+	for id := int32(0); id < n; id++ {
+		e := &EventData64{ID: int64(id)}
+		o := JitterSeeded.offset(e)
+		if o != JitterSeeded.offset(&EventData64{ID: int64(id), Run: 42}) {
+			t.Fatalf("Seeded jitter for event %d is not stable", id)
+		}
+		sum += o
+		sumSquares += o * o
+	}
+	mean := sum / n
+	σ := math.Sqrt(sumSquares/n - mean*mean)
+	if math.Abs(mean) > 0.01 || math.Abs(σ-0.5) > 0.01 {
+		t.Errorf("Seeded jitter has mean %f and deviation %f", mean, σ)
+	}
+	if JitterNone.offset(&EventData64{ID: 1}) != 0 {
+		t.Error("Disabled jitter applied a non-zero offset.")
+	}
+}
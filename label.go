@@ -0,0 +1,181 @@
+// Perspective: Graphing library for quality control in event-driven systems
+
+// Copyright (C) 2016 Christian Paro <christian.paro@gmail.com>,
+//                                   <cparo@digitalocean.com>
+
+// This program is free software: you can redistribute it and/or modify it under
+// the terms of the GNU General Public License version 2 as published by the
+// Free Software Foundation.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+
+// You should have received a copy of the GNU General Public License along with
+// this program. If not, see <http://www.gnu.org/licenses/>.
+
+package perspective
+
+import (
+	"image"
+	"image/color"
+	"strings"
+)
+
+const (
+	glyphW      = 3   // Width of a character of a label, in pixels
+	glyphH      = 5   // Height of a character of a label, in pixels
+	labelGray   = 191 // Gray level of the text of labels
+	maxLabelLen = 24  // Number of characters of a name shown in a label
+)
+
+// Glyphs of the font in which labels are drawn, given row by row from the top,
+// with "#" for each pixel set. Letters are drawn in capitals whatever their
+// case, and characters with no glyph are drawn as "?".
+var glyphs = map[rune]string{
+	'a': ".#." + "#.#" + "###" + "#.#" + "#.#",
+	'b': "##." + "#.#" + "##." + "#.#" + "##.",
+	'c': ".##" + "#.." + "#.." + "#.." + ".##",
+	'd': "##." + "#.#" + "#.#" + "#.#" + "##.",
+	'e': "###" + "#.." + "##." + "#.." + "###",
+	'f': "###" + "#.." + "##." + "#.." + "#..",
+	'g': ".##" + "#.." + "#.#" + "#.#" + ".##",
+	'h': "#.#" + "#.#" + "###" + "#.#" + "#.#",
+	'i': "###" + ".#." + ".#." + ".#." + "###",
+	'j': "..#" + "..#" + "..#" + "#.#" + ".#.",
+	'k': "#.#" + "#.#" + "##." + "#.#" + "#.#",
+	'l': "#.." + "#.." + "#.." + "#.." + "###",
+	'm': "#.#" + "###" + "###" + "#.#" + "#.#",
+	'n': "##." + "#.#" + "#.#" + "#.#" + "#.#",
+	'o': ".#." + "#.#" + "#.#" + "#.#" + ".#.",
+	'p': "##." + "#.#" + "##." + "#.." + "#..",
+	'q': ".#." + "#.#" + "#.#" + "##." + ".##",
+	'r': "##." + "#.#" + "##." + "#.#" + "#.#",
+	's': ".##" + "#.." + ".#." + "..#" + "##.",
+	't': "###" + ".#." + ".#." + ".#." + ".#.",
+	'u': "#.#" + "#.#" + "#.#" + "#.#" + "###",
+	'v': "#.#" + "#.#" + "#.#" + "#.#" + ".#.",
+	'w': "#.#" + "#.#" + "###" + "###" + "#.#",
+	'x': "#.#" + "#.#" + ".#." + "#.#" + "#.#",
+	'y': "#.#" + "#.#" + ".#." + ".#." + ".#.",
+	'z': "###" + "..#" + ".#." + "#.." + "###",
+	'0': "###" + "#.#" + "#.#" + "#.#" + "###",
+	'1': ".#." + "##." + ".#." + ".#." + "###",
+	'2': "##." + "..#" + ".#." + "#.." + "###",
+	'3': "##." + "..#" + ".#." + "..#" + "##.",
+	'4': "#.#" + "#.#" + "###" + "..#" + "..#",
+	'5': "###" + "#.." + "##." + "..#" + "##.",
+	'6': ".##" + "#.." + "###" + "#.#" + "###",
+	'7': "###" + "..#" + ".#." + ".#." + ".#.",
+	'8': "###" + "#.#" + "###" + "#.#" + "###",
+	'9': "###" + "#.#" + "###" + "..#" + "##.",
+	' ': "..." + "..." + "..." + "..." + "...",
+	'-': "..." + "..." + "###" + "..." + "...",
+	'_': "..." + "..." + "..." + "..." + "###",
+	'.': "..." + "..." + "..." + "..." + ".#.",
+	':': "..." + ".#." + "..." + ".#." + "...",
+	'/': "..#" + "..#" + ".#." + "#.." + "#..",
+	'?': "##." + "..#" + ".#." + "..." + ".#.",
+}
+
+// Returns the text of the label for the given name, cut short if need be.
+func labelText(name string) []rune {
+	text := []rune(strings.ToLower(name))
+	if len(text) > maxLabelLen {
+		text = text[:maxLabelLen]
+	}
+	return text
+}
+
+// Returns the width, in pixels, of the given label text.
+func labelWidth(text []rune) int {
+	if len(text) == 0 {
+		return 0
+	}
+	return len(text)*(glyphW+1) - 1
+}
+
+// Utility function to draw the given label text with its top-left corner at the
+// given position. Any part of the label beyond the bounds of the visualization
+// is left out.
+func drawLabel(vis *image.RGBA, x int, y int, text []rune) {
+	c := color.RGBA{labelGray, labelGray, labelGray, opaque}
+	for i, r := range text {
+		glyph, exists := glyphs[r]
+		if !exists {
+			glyph = glyphs['?']
+		}
+		for p, pixel := range glyph {
+			if pixel == '#' {
+				*getRGBA(vis, x+i*(glyphW+1)+p%glyphW, y+p/glyphW) = c
+			}
+		}
+	}
+}
+
+// Utility function to fill a rectangle of a visualization with a color.
+func fillRect(vis *image.RGBA, r image.Rectangle, c color.RGBA) {
+	r = r.Intersect(vis.Rect)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			*getRGBA(vis, x, y) = c
+		}
+	}
+}
+
+// Utility function to draw a label over a box of the background gray level, so
+// it can be read over anything drawn beneath it, with the top-left corner of
+// the box at the given position.
+func drawLabelBox(vis *image.RGBA, bg int, x int, y int, text []rune) {
+	background := color.RGBA{uint8(bg), uint8(bg), uint8(bg), opaque}
+	fillRect(
+		vis,
+		image.Rect(x, y, x+labelWidth(text)+2, y+glyphH+2),
+		background)
+	drawLabel(vis, x+1, y+1, text)
+}
+
+// Utility function to draw a legend in the top-left corner of a visualization,
+// giving the name of each of the given groups which has one beside a swatch of
+// its color. The legend is drawn over a box of the background gray level, and
+// is cut short at the bottom of the visualization.
+func drawLegend(
+	vis *image.RGBA,
+	bg int,
+	names []string,
+	colors []color.RGBA) {
+
+	var texts [][]rune
+	var swatches []color.RGBA
+	width := 0
+	for i, name := range names {
+		if name == "" {
+			continue
+		}
+		text := labelText(name)
+		texts = append(texts, text)
+		swatches = append(swatches, colors[i])
+		if w := labelWidth(text); w > width {
+			width = w
+		}
+	}
+	if len(texts) == 0 {
+		return
+	}
+
+	// Each row holds a swatch the height of a character with the name beside
+	// it, with a pixel of space around each.
+	rowH := glyphH + 1
+	rows := (vis.Rect.Dy() - 1) / rowH
+	if rows > len(texts) {
+		rows = len(texts)
+	}
+	background := color.RGBA{uint8(bg), uint8(bg), uint8(bg), opaque}
+	fillRect(vis, image.Rect(0, 0, glyphH+width+3, rows*rowH+1), background)
+	for i := 0; i < rows; i++ {
+		y := 1 + i*rowH
+		fillRect(vis, image.Rect(1, y, 1+glyphH, y+glyphH), swatches[i])
+		drawLabel(vis, glyphH+2, y, texts[i])
+	}
+}
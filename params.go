@@ -0,0 +1,246 @@
+// Perspective: Graphing library for quality control in event-driven systems
+
+// Copyright (C) 2016 Christian Paro <christian.paro@gmail.com>,
+//                                   <cparo@digitalocean.com>
+
+// This program is free software: you can redistribute it and/or modify it under
+// the terms of the GNU General Public License version 2 as published by the
+// Free Software Foundation.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+
+// You should have received a copy of the GNU General Public License along with
+// this program. If not, see <http://www.gnu.org/licenses/>.
+
+package perspective
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Limits on the dimensions of visualizations, in pixels. Visualizations
+// rendered from floating-point canvases (holding several float64 values per
+// pixel, for each recording shard) are held to a smaller area than those drawn
+// directly to an image.
+const (
+	maxSide      = 8192
+	maxArea      = 1 << 23
+	maxFloatArea = 1 << 21
+)
+
+// Parameters shared by many visualizers:
+var (
+	WidthParam = Param{
+		"width", "", IntParam, "256", nil, between(1, maxSide),
+		"Width of the rendered graph, in pixels."}
+	HeightParam = Param{
+		"height", "", IntParam, "128", nil, between(1, maxSide),
+		"Height of the rendered graph, in pixels."}
+	BGParam = Param{
+		"bg", "", IntParam, "32", nil, between(0, 255),
+		"Background gray level."}
+	MinTimeParam = Param{
+		"min-time", "", TimeParam, "0", nil, nil,
+		"Least recent time to show, as Unix epoch time (seconds by " +
+			"default), a timestamp, now, or a negative offset from now " +
+			"(like -1h)."}
+	MaxTimeParam = Param{
+		"max-time", "", TimeParam, "now", nil, nil,
+		"Most recent time to show, in any of the forms taken by min-time."}
+	PeriodStartParam = Param{
+		"period-start", "", TimeParam, "now", nil, nil,
+		"A point in time representing the start of a period."}
+	PeriodLengthParam = Param{
+		"period-length", "", DurationParam, "-1", nil, nil,
+		"The interval length for periodic visualizations (like 1day or " +
+			"90m), or a negative value for the whole time range shown."}
+	XGridParam = Param{
+		"x-grid", "", IntParam, "0", nil, atLeast(0),
+		"Number of divisions to be separated with vertical grid lines."}
+	ColorStepsParam = Param{
+		"color-steps", "", FloatParam, "1", nil, positive,
+		"Number of color steps to use in rendering before clipping."}
+	ResonanceParam = Param{
+		"smoothing-resonance", "", FloatParam, "0.85", nil, between(0, 1),
+		"Resonance value for line-smoothing."}
+	JitterParam = Param{
+		"jitter", "", ChoiceParam, "random",
+		[]string{"random", "seeded", "none"}, nil,
+		"Run-time noise mode: random, seeded (stable per event ID) or none."}
+	XBinsParam = Param{
+		"x-bins", "", IntParam, "64", nil, between(1, maxSide),
+		"Number of start-time bins for heatmaps."}
+	YBinsParam = Param{
+		"y-bins", "", IntParam, "32", nil, between(1, maxSide),
+		"Number of run-time bins for heatmaps."}
+	CountScaleParam = Param{
+		"count-scale", "", ChoiceParam, "linear",
+		[]string{"linear", "log"}, nil,
+		"Scaling of counts onto heatmap colors: linear or log."}
+	LegendParam = Param{
+		"legend", "", BoolParam, "false", nil, nil,
+		"Include a color-scale legend in heatmaps."}
+	GroupByParam = Param{
+		"group-by", "", ChoiceParam, "status",
+		[]string{"status", "type", "region"}, nil,
+		"Grouping of events into layers or rows: status, type or region."}
+	MinProgressRateParam = Param{
+		"min-progress-rate", "", FloatParam, "10", nil, atLeast(0),
+		"Progress rate, in percent per hour, below which events are " +
+			"stalled."}
+)
+
+// Parameters describing the run-time axis, for visualizers which have one:
+var AxisParams = []Param{
+	{
+		"run-time-axis", "", ChoiceParam, "log",
+		[]string{"log", "linear"}, nil,
+		"Run-time axis type: log or linear."},
+	{
+		"run-time-scale", "", FloatParam, "16", nil, atLeast(0),
+		"Pixels along run-time axis for every base-fold increase in run " +
+			"time (or second, if linear), or 0 to fit the axis to its " +
+			"bounds."},
+	{
+		"run-time-base", "", FloatParam, "2", nil, nil,
+		"Logarithm base for a log run-time axis."},
+	{
+		"min-run-time", "", FloatParam, "", nil, atLeast(0),
+		"Run time at the axis origin, in seconds, below which events are " +
+			"clipped (default none, with the origin at 1 if log, 0 if " +
+			"linear)."},
+	{
+		"max-run-time", "", FloatParam, "0", nil, atLeast(0),
+		"Run time beyond which events are clipped, in seconds (0 for " +
+			"none)."},
+}
+
+// Returns the given parameters, followed by those describing the run-time
+// axis.
+func withAxis(params ...Param) []Param {
+	return append(params, AxisParams...)
+}
+
+// Returns the run-time axis described by the axis parameters, along with any
+// error in its description, in which case the axis originally used by all
+// visualizations is returned in its place.
+func (p Params) axis() (RunTimeAxis, *ParamError) {
+	var axis RunTimeAxis
+	min, _ := p["min-run-time"].(float64)
+	scale, max := p.Float("run-time-scale"), p.Float("max-run-time")
+	if p.String("run-time-axis") == "linear" {
+		axis = NewLinearAxis(scale, min, max)
+	} else {
+		axis = NewLogAxis(scale, p.Float("run-time-base"), min, max)
+	}
+	if field, err := axis.validate(); err != nil {
+		// Report the problem against the parameter for the field at fault.
+		name, value := "run-time-axis", p.String("run-time-axis")
+		switch field {
+		case "Base":
+			name, value = "run-time-base", formatFloat(axis.Base)
+		case "Min":
+			name, value = "min-run-time", formatFloat(axis.Min)
+		case "Max":
+			name, value = "max-run-time", formatFloat(axis.Max)
+		case "Scale":
+			name, value = "run-time-scale", formatFloat(axis.Scale)
+		}
+		return NewLog2Axis(16), &ParamError{name, value, err.Error()}
+	}
+	return axis, nil
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// Checks that the axis parameters describe a usable run-time axis.
+func checkAxis(p Params) *ParamError {
+	_, err := p.axis()
+	return err
+}
+
+// Returns a check that the area of a visualization, in pixels, is no greater
+// than the given limit.
+func checkArea(limit int) ParamCheck {
+	return func(p Params) *ParamError {
+		w, h := p.Int("width"), p.Int("height")
+		if w*h > limit {
+			return &ParamError{
+				"width",
+				strconv.Itoa(w),
+				fmt.Sprintf(
+					"width × height (%d × %d) must not exceed %d pixels",
+					w,
+					h,
+					limit)}
+		}
+		return nil
+	}
+}
+
+// CheckTimeRange checks that the time range selected by the min-time and
+// max-time parameters is not empty.
+func CheckTimeRange(p Params) *ParamError {
+	tA, tΩ := p.Time("min-time"), p.Time("max-time")
+	if tA >= tΩ {
+		return &ParamError{
+			"min-time",
+			time.Unix(0, tA).UTC().Format(time.RFC3339Nano),
+			fmt.Sprintf(
+				"must be before max-time (%s)",
+				time.Unix(0, tΩ).UTC().Format(time.RFC3339Nano))}
+	}
+	return nil
+}
+
+// Returns the run-time axis described by the axis parameters, or the axis
+// originally used by all visualizations if they do not describe a usable one.
+func (p Params) runTimeAxis() RunTimeAxis {
+	axis, _ := p.axis()
+	return axis
+}
+
+func (p Params) calendarLayout() CalendarLayout {
+	layout, _ := ParseCalendarLayout(p.String("calendar-layout"))
+	return layout
+}
+
+func (p Params) calendarValue() CalendarValue {
+	value, _ := ParseCalendarValue(p.String("calendar-value"))
+	return value
+}
+
+func (p Params) countScale() CountScale {
+	scale, _ := ParseCountScale(p.String("count-scale"))
+	return scale
+}
+
+func (p Params) grouping() Grouping {
+	grouping, _ := ParseGrouping(p.String("group-by"))
+	return grouping
+}
+
+func (p Params) jitter() Jitter {
+	jitter, _ := ParseJitter(p.String("jitter"))
+	return jitter
+}
+
+// Standard parameters of visualizers which plot events over a range of time:
+// their dimensions and background, and the bounds of the range.
+func timeRangeParams(params ...Param) []Param {
+	return append(
+		[]Param{WidthParam, HeightParam, BGParam, MinTimeParam, MaxTimeParam},
+		params...)
+}
+
+// Standard parameters of all visualizers: their dimensions and background.
+func sizeParams(params ...Param) []Param {
+	return append([]Param{WidthParam, HeightParam, BGParam}, params...)
+}
@@ -18,12 +18,18 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"flag"
+	"fmt"
 	"github.com/cparo/perspective"
+	"github.com/cparo/perspective/actions"
 	"github.com/cparo/perspective/feeds"
+	"io"
 	"log"
 	"os"
-	"time"
+	"path/filepath"
+	"strings"
 )
 
 // Mapping of action names to handler functions:
@@ -31,67 +37,77 @@ var handlers = make(map[string]func())
 
 // Command-line options and arguments:
 var (
-	errorClassConf string  // Optional conf file for error classification.
-	typeFilter     int     // Event type to filter for, if non-negative.
-	regionFilter   int     // Region to filter for, if non-negative.
-	statusFilter   int     // Least significant bits: {done, failed, running}.
-	tA             int     // Lower limit of time range to be visualized.
-	tΩ             int     // Upper limit of time range to be visualized.
-	p0             int     // Point in time representing the start of a period.
-	pτ             int     // The interval length for periodic visualizations.
-	xGrid          int     // Number of horizontal grid divisions.
-	yLog2          float64 // Number of pixels over which elapsed times double.
-	w              int     // Visualization width, in pixels.
-	h              int     // Visualization height, in pixels.
-	bg             int     // Graph background color.
-	colors         float64 // The number of color steps before saturation.
-	resonance      float64 // Resonance value for line-smoothing.
-	action         string  // Indication of action to be taken.
-	iPath          string  // Filesystem path for input.
-	oPath          string  // Filesystem path for output.
-	lookback       int     // Events to look back through in feed (0 for all).
+	errorClassConf string // Optional conf file for error classification.
+	metadataPath   string // Metadata naming event types and regions.
+	csvSchemaPath  string // Schema describing the layout of CSV input.
+	timeUnit       string // Unit of times in CSV input.
+	wide           bool   // Write 64-bit binary logs even for whole seconds.
+	action         string // Indication of action to be taken.
+	iPath          string // Filesystem path for input.
+	oPath          string // Filesystem path for output.
 )
 
+// Mapping of action parameter names (and their aliases) to the flags holding
+// their values:
+var paramFlags = make(map[string]*paramFlag)
+
+// Names of the event types and regions of the input feed:
+var names = &feeds.Metadata{}
+
+// Command-line flag holding the value of an action parameter, which is parsed
+// along with all other parameters of the action once all flags have been set.
+// Parameters not given on the command line are left empty, so each action
+// takes its own default values for them.
+type paramFlag struct {
+	value  string
+	isBool bool
+}
+
+func (f *paramFlag) String() string {
+	return f.value
+}
+
+func (f *paramFlag) Set(value string) error {
+	f.value = value
+	return nil
+}
+
+func (f *paramFlag) IsBoolFlag() bool {
+	return f.isBool
+}
+
 func init() {
 
 	handlers["csv-convert"] = func() {
+		p := perspective.ParseParams(
+			actions.FeedParams,
+			lookupParam,
+			rejectParam)
 		feeds.ConvertCSVToBinary(
 			iPath,
 			oPath,
-			int32(tA),
-			int32(tΩ),
-			typeFilter,
-			regionFilter,
-			statusFilter,
-			errorClassConf)
-	}
-
-	handlers["vis-count-lines"] = func() {
-		visualize(
-			perspective.NewCountLines(w, h, bg, tA, tΩ, resonance, xGrid))
-	}
-
-	handlers["vis-histogram"] = func() {
-		visualize(perspective.NewHistogram(w, h, bg, yLog2))
+			p.Time("min-time"),
+			p.Time("max-time"),
+			p.Int("event-type"),
+			p.Int("region"),
+			p.Int("status-filter"),
+			errorClassConf,
+			metadataPath,
+			csvSchemaPath,
+			csvTimeUnit(),
+			wide)
 	}
 
-	handlers["vis-polar-scatter"] = func() {
-		visualize(
-			perspective.NewPolarScatter(
-				w, h, bg, tA, tΩ, p0, pτ, yLog2, colors))
+	handlers["feed-upgrade"] = func() {
+		err := feeds.UpgradeBinLog(iPath, oPath)
+		if err != nil {
+			log.Fatalln(err)
+		}
 	}
 
-	handlers["vis-run-time-line"] = func() {
-		visualize(
-			perspective.NewRunTimeLine(
-				w, h, bg, tA, tΩ, yLog2, xGrid))
-	}
+	handlers["feed-info"] = describeFeed
 
-	handlers["vis-scatter"] = func() {
-		visualize(
-			perspective.NewScatter(
-				w, h, bg, tA, tΩ, yLog2, colors, xGrid))
-	}
+	handlers["vis-batch"] = visualizeBatch
 }
 
 func main() {
@@ -102,114 +118,128 @@ func main() {
 		"",
 		"Error reason filter congfiguration.")
 
-	flag.IntVar(
-		&typeFilter,
-		"event-type-id",
-		-1,
-		"Event type ID to filter for.")
-
-	flag.IntVar(
-		&regionFilter,
-		"region-id",
-		-1,
-		"Event region ID to filter for.")
-
-	flag.IntVar(
-		&statusFilter,
-		"status-filter",
-		-1,
-		"Bitmask for event statuses; LSB are {done,failed,running}.")
-
-	flag.IntVar(
-		&tA,
-		"min-time",
-		0,
-		"Least recent time to show, expressed as seconds in Unix epoch time.")
-
-	flag.IntVar(
-		&tΩ,
-		"max-time",
-		int(time.Now().Unix()),
-		"Most recent time to show, expressed as seconds in Unix epoch time.")
-
-	flag.IntVar(
-		&p0,
-		"period-start",
-		int(time.Now().Unix()),
-		"A point in time representing the start of a period.")
-
-	flag.IntVar(
-		&pτ,
-		"period-length",
-		-1,
-		"The interval length for periodic visualizations.")
-
-	flag.IntVar(
-		&xGrid,
-		"x-grid",
-		0,
-		"Number of divisions to be separated with vertical grid lines.")
-
-	flag.Float64Var(
-		&yLog2,
-		"run-time-scale",
-		16,
-		"Pixels along y-axis for every doubling in seconds of run time.")
-
-	flag.IntVar(
-		&w,
-		"width",
-		256,
-		"Width of the rendered graph, in pixels.")
-
-	flag.IntVar(
-		&h,
-		"height",
-		128,
-		"Height of the rendered graph, in pixels.")
-
-	flag.IntVar(
-		&bg,
-		"bg",
-		32,
-		"Background gray level.")
-
-	flag.Float64Var(
-		&colors,
-		"color-steps",
-		1,
-		"Number of color steps to use in rendering before clipping.")
-
-	flag.Float64Var(
-		&resonance,
-		"smoothing-resonance",
-		0.85,
-		"Resonance value for line-smoothin.")
-
-	flag.IntVar(
-		&lookback,
-		"lookback",
-		0,
-		"Number of events to scan, from end of log (or 0 for all events).")
+	flag.StringVar(
+		&metadataPath,
+		"metadata",
+		"",
+		"Metadata naming event types and regions (by default, that kept "+
+			"alongside the input feed), to which csv-convert adds new names.")
+
+	flag.StringVar(
+		&csvSchemaPath,
+		"csv-schema",
+		"",
+		"Schema describing the delimiter, header and columns of CSV input.")
+
+	flag.StringVar(
+		&timeUnit,
+		"time-unit",
+		"s",
+		"Unit of times in CSV input: s, ms, us or ns.")
+
+	flag.BoolVar(
+		&wide,
+		"wide",
+		false,
+		"Write CSV input with times in seconds to a 64-bit (2038-safe) log.")
+
+	for _, param := range actions.AllParams() {
+		f := &paramFlag{"", param.Type == perspective.BoolParam}
+		usage := param.Usage
+		if param.Default != "" {
+			usage += fmt.Sprintf(" (default %s)", param.Default)
+		}
+		paramFlags[param.Name] = f
+		flag.Var(f, param.Name, usage)
+		if param.Alias != "" {
+			paramFlags[param.Alias] = f
+			flag.Var(f, param.Alias, fmt.Sprintf("Alias for -%s.", param.Name))
+		}
+	}
+
+	flag.Usage = func() {
+		fmt.Fprintf(
+			os.Stderr,
+			"Usage: %s [flags] action input output\n\n"+
+				"Run \"%s help\" for a list of actions, or \"%s help "+
+				"action\" for the flags an action takes.\n\nFlags:\n",
+			os.Args[0],
+			os.Args[0],
+			os.Args[0])
+		flag.PrintDefaults()
+	}
 
 	flag.Parse()
+	action = flag.Arg(0)
+
+	if action == "help" {
+		if err := actions.Help(os.Stdout, flag.Arg(1)); err != nil {
+			log.Fatalln(err)
+		}
+		return
+	}
 
-	if flag.NArg() != 3 {
+	// Batch visualizations take their specs as trailing arguments, all other
+	// actions take only an input and output path.
+	if flag.NArg() < 3 || flag.NArg() > 3 && action != "vis-batch" {
 		log.Fatalln("Incorrect argument count.")
 	}
 
-	action = flag.Arg(0)
 	iPath = flag.Arg(1)
 	oPath = flag.Arg(2)
 
+	// Event types and regions may be given by the names in the metadata, which
+	// for a binary log is kept alongside it unless given elsewhere.
+	path := metadataPath
+	if path == "" && action != "csv-convert" {
+		path = feeds.MetadataPath(iPath)
+	}
+	if path != "" {
+		var err error
+		if names, err = feeds.LoadMetadata(path); err != nil {
+			log.Fatalln(err)
+		}
+	}
+
 	if handler, exists := handlers[action]; exists {
 		handler()
+	} else if report, exists := actions.Reports[action]; exists {
+		writeReport(report, actions.Parse(action, lookupParam, rejectParam))
+	} else if spec := perspective.LookupVisualizer(action); spec != nil {
+		p := actions.Parse(action, lookupParam, rejectParam)
+		visualize(spec.New(p), p)
 	} else {
 		log.Fatalln("Unrecognized action.")
 	}
 }
 
-func visualize(v perspective.Visualizer) {
+func csvTimeUnit() int64 {
+	unit, err := perspective.ParseTimeUnit(timeUnit)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	return unit
+}
+
+// Returns the value of the named action parameter given on the command line,
+// or an empty string if none was given, with event types and regions given by
+// name translated into their codes.
+func lookupParam(name string) string {
+	return actions.Named(flagValue, names)(name)
+}
+
+// Returns the value of the named action parameter given on the command line,
+// as given.
+func flagValue(name string) string {
+	return paramFlags[name].value
+}
+
+// Bails out on a malformed action parameter value.
+func rejectParam(err *perspective.ParamError) {
+	log.Fatalf("Malformed option: %v\n", err)
+}
+
+func visualize(v perspective.Visualizer, p perspective.Params) {
 
 	out, err := os.Create(oPath)
 	if err != nil {
@@ -217,18 +247,170 @@ func visualize(v perspective.Visualizer) {
 		log.Fatalln(err)
 	}
 
-	eventData := feeds.MapBinLogFile(iPath, int64(lookback))
+	eventData := feeds.MapBinLogFile(iPath, actions.Lookback(p))
 	if eventData == nil {
 		log.Fatalln("Failed to parse data feed.")
 	}
+	eventData.SetNames(names)
 
-	feeds.GeneratePNGFromBinLog(
+	f := actions.Filter(p)
+	err = feeds.GeneratePNGFromBinLog(
+		context.Background(),
 		eventData,
-		int32(tA),
-		int32(tΩ),
-		typeFilter,
-		regionFilter,
-		statusFilter,
+		f.MinTime,
+		f.MaxTime,
+		f.Type,
+		f.Region,
+		f.Status,
 		v,
 		out)
+	if err != nil {
+		log.Println("Failed to write visualization.")
+		log.Fatalln(err)
+	}
+	logTruncation(v, oPath)
+}
+
+// Logs the number of events left out of the given visualization, if it is one
+// which may leave out events and has done so.
+func logTruncation(v perspective.Visualizer, name string) {
+	if t, ok := v.(perspective.TruncatedVisualizer); ok && t.Truncated() > 0 {
+		log.Printf(
+			"%s: %d events left out of the visualization.\n",
+			name,
+			t.Truncated())
+	}
+}
+
+// Renders each visualization specified in the trailing command-line arguments
+// from a single pass over the input feed, writing them out as numbered PNG
+// files in the output directory. Each spec names a visualization action,
+// optionally followed by flags which override the global command-line options
+// for that visualization alone (as in "vis-scatter -status-filter=2").
+func visualizeBatch() {
+
+	specs := flag.Args()[3:]
+	if len(specs) == 0 {
+		log.Fatalln("No visualizations specified.")
+	}
+
+	// The feed is read as selected by the global options alone.
+	feedParams := perspective.ParseParams(
+		actions.FeedParams,
+		lookupParam,
+		rejectParam)
+
+	// Snapshot the global options so each spec's overrides can be reverted
+	// before the next spec is parsed.
+	defaults := make(map[string]string)
+	flag.VisitAll(func(f *flag.Flag) {
+		defaults[f.Name] = f.Value.String()
+	})
+
+	layers := make([]feeds.Layer, len(specs))
+	for i, spec := range specs {
+		for name, value := range defaults {
+			flag.Set(name, value)
+		}
+		fields := strings.Fields(spec)
+		if len(fields) == 0 {
+			log.Fatalln("Empty visualization spec.")
+		}
+		visualizer := perspective.LookupVisualizer(fields[0])
+		if visualizer == nil {
+			log.Fatalf("Unrecognized visualization: \"%s\"\n", fields[0])
+		}
+		flag.CommandLine.Parse(fields[1:])
+		if flag.NArg() > 0 {
+			log.Fatalf("Unexpected argument in spec: \"%s\"\n", spec)
+		}
+		p := actions.Parse(fields[0], lookupParam, rejectParam)
+		layers[i] = feeds.Layer{
+			Name:       fmt.Sprintf("%d-%s.png", i, fields[0]),
+			Filter:     actions.Filter(p),
+			Visualizer: visualizer.New(p)}
+	}
+
+	err := os.MkdirAll(oPath, 0755)
+	if err != nil {
+		log.Println("Failed to create output directory.")
+		log.Fatalln(err)
+	}
+
+	eventData := feeds.MapBinLogFile(iPath, actions.Lookback(feedParams))
+	if eventData == nil {
+		log.Fatalln("Failed to parse data feed.")
+	}
+	eventData.SetNames(names)
+
+	var files []*os.File
+	err = feeds.GeneratePNGsFromBinLog(
+		context.Background(),
+		eventData,
+		layers,
+		func(l *feeds.Layer) (io.Writer, error) {
+			logTruncation(l.Visualizer, l.Name)
+			out, err := os.Create(filepath.Join(oPath, l.Name))
+			if err == nil {
+				files = append(files, out)
+			}
+			return out, err
+		})
+	for _, out := range files {
+		out.Close()
+	}
+	if err != nil {
+		log.Println("Failed to write visualization batch.")
+		log.Fatalln(err)
+	}
+}
+
+// Writes a description of the input feed (its record count, size, time range,
+// event types and regions, and when it was last modified) to the output file as
+// JSON, bailing out after doing so if the feed is malformed.
+func describeFeed() {
+
+	name := strings.TrimSuffix(filepath.Base(iPath), filepath.Ext(iPath))
+	info, err := feeds.DescribeBinLog(context.Background(), iPath, name)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	out, err := os.Create(oPath)
+	if err != nil {
+		log.Println("Failed to open output file for writing.")
+		log.Fatalln(err)
+	}
+	defer out.Close()
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(info); err != nil {
+		log.Fatalln(err)
+	}
+	if info.Error != "" {
+		out.Close()
+		log.Fatalf("Malformed feed: %s\n", info.Error)
+	}
+}
+
+func writeReport(report *actions.Report, p perspective.Params) {
+
+	out, err := os.Create(oPath)
+	if err != nil {
+		log.Println("Failed to open output file for writing.")
+		log.Fatalln(err)
+	}
+	defer out.Close()
+
+	eventData := feeds.MapBinLogFile(iPath, actions.Lookback(p))
+	if eventData == nil {
+		log.Fatalln("Failed to parse data feed.")
+	}
+	eventData.SetNames(names)
+
+	err = report.Write(context.Background(), eventData, p, out)
+	if err != nil {
+		log.Fatalln(err)
+	}
 }
@@ -0,0 +1,116 @@
+// Perspective: Graphing library for quality control in event-driven systems
+
+// Copyright (C) 2014 Christian Paro <christian.paro@gmail.com>,
+//                                   <cparo@digitalocean.com>
+
+// This program is free software: you can redistribute it and/or modify it under
+// the terms of the GNU General Public License version 2 as published by the
+// Free Software Foundation.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+
+// You should have received a copy of the GNU General Public License along with
+// this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/cparo/perspective"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// Runs the tool in place of the tests when the test binary is run by runCLI.
+func TestMain(m *testing.M) {
+	if os.Getenv("PERSPECTIVE_CLI_TEST") != "" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// Runs the tool with the given arguments, failing the test if it fails.
+func runCLI(t *testing.T, args ...string) {
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "PERSPECTIVE_CLI_TEST=1")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%v: %v\n%s", args, err, out)
+	}
+}
+
+func readFile(t *testing.T, path string) []byte {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return content
+}
+
+// Each visualization in a batch should match the one rendered on its own with
+// the global options and its own overrides, which must not carry over to the
+// specs after it.
+func TestVisualizeBatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "perspective-cli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	feed := filepath.Join(dir, "test.dat")
+	file, err := os.Create(feed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := []perspective.EventData{
+		{ID: 1, Start: 10, Run: 5},
+		{ID: 2, Start: 20, Run: 50, Status: 1},
+		{ID: 3, Start: 30, Run: 500, Status: -1}}
+	err = binary.Write(file, binary.LittleEndian, events)
+	file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	global := []string{"-max-time=600", "-jitter=none"}
+	batch := filepath.Join(dir, "batch")
+	runCLI(t, append(
+		global,
+		"vis-batch",
+		feed,
+		batch,
+		"vis-histogram -status-filter=2",
+		"vis-histogram")...)
+	runCLI(t, append(
+		global,
+		"-status-filter=2",
+		"vis-histogram",
+		feed,
+		filepath.Join(dir, "failed.png"))...)
+	runCLI(t, append(
+		global,
+		"vis-histogram",
+		feed,
+		filepath.Join(dir, "all.png"))...)
+
+	failed := readFile(t, filepath.Join(dir, "failed.png"))
+	all := readFile(t, filepath.Join(dir, "all.png"))
+	if bytes.Equal(failed, all) {
+		t.Fatal("Status filter override makes no difference to the test feed")
+	}
+	if !bytes.Equal(readFile(t, filepath.Join(batch, "0-vis-histogram.png")),
+		failed) {
+		t.Error("Batch visualization with overrides rendered differently.")
+	}
+	if !bytes.Equal(readFile(t, filepath.Join(batch, "1-vis-histogram.png")),
+		all) {
+		t.Error("Overrides carried over to the next batch visualization.")
+	}
+}
@@ -0,0 +1,253 @@
+// Perspective: Graphing library for quality control in event-driven systems
+
+// Copyright (C) 2016 Christian Paro <christian.paro@gmail.com>,
+//                                   <cparo@digitalocean.com>
+
+// This program is free software: you can redistribute it and/or modify it under
+// the terms of the GNU General Public License version 2 as published by the
+// Free Software Foundation.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+
+// You should have received a copy of the GNU General Public License along with
+// this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Query parameters of a signed URL, naming the key it was signed with, the
+// Unix time in seconds after which it is no longer accepted, and the signature
+// itself (a hex-encoded HMAC-SHA256 of the rest of the URL).
+const (
+	signedKeyParam     = "key-id"
+	signedExpiryParam  = "expires"
+	signatureParam     = "signature"
+	authenticateHeader = `Bearer realm="perspective"`
+)
+
+// apiKey is a static API key from the configuration, with the feeds which it
+// may be used to read and to write given as glob patterns on feed names (like
+// "nyc-*", or "*" for all feeds). Any feed which may be written with a key may
+// also be read with it.
+type apiKey struct {
+	Name  string   `json:"name"`  // Name of the key, as given in signed URLs
+	Key   string   `json:"key"`   // Secret, as given in bearer tokens
+	Read  []string `json:"read"`  // Patterns for feeds which may be read
+	Write []string `json:"write"` // Patterns for feeds which may be written
+}
+
+// Checks the key for a name and secret, and for well-formed patterns.
+func (k *apiKey) validate() error {
+	if k.Name == "" || strings.ContainsAny(k.Name, " &=?") {
+		return fmt.Errorf("invalid API key name \"%s\"", k.Name)
+	}
+	if len(k.Key) < 16 {
+		return fmt.Errorf("API key \"%s\" is shorter than 16 bytes", k.Name)
+	}
+	for _, pattern := range append(k.Read, k.Write...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf(
+				"invalid feed pattern \"%s\" for API key \"%s\"",
+				pattern,
+				k.Name)
+		}
+	}
+	return nil
+}
+
+// Reports whether the named feed matches any of the given patterns.
+func matchFeed(patterns []string, feed string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, feed); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func (k *apiKey) canRead(feed string) bool {
+	return matchFeed(k.Read, feed) || k.canWrite(feed)
+}
+
+func (k *apiKey) canWrite(feed string) bool {
+	return matchFeed(k.Write, feed)
+}
+
+// Returns the signature of a request for the given path with the given query
+// values (leaving out any signature among them), made with the given key.
+func signature(key *apiKey, path string, values url.Values) string {
+	unsigned := url.Values{}
+	for name, value := range values {
+		if name != signatureParam {
+			unsigned[name] = value
+		}
+	}
+	mac := hmac.New(sha256.New, []byte(key.Key))
+	io.WriteString(mac, path+"?"+unsigned.Encode())
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Returns a URL for the given path and query values, signed with the given key
+// to be accepted until the given expiry time.
+func signURL(
+	key *apiKey,
+	path string,
+	values url.Values,
+	expires time.Time) string {
+
+	signed := url.Values{}
+	for name, value := range values {
+		signed[name] = value
+	}
+	signed.Set(signedKeyParam, key.Name)
+	signed.Set(signedExpiryParam, strconv.FormatInt(expires.Unix(), 10))
+	signed.Set(signatureParam, signature(key, path, signed))
+	return path + "?" + signed.Encode()
+}
+
+// Returns the API key a request was made with, given as a bearer token in its
+// Authorization header or (if signed URLs are accepted for the request) by the
+// signature of its URL, or an error if it was made with no valid key.
+func authenticate(request *http.Request, allowSigned bool) (*apiKey, error) {
+
+	if token := request.Header.Get("Authorization"); token != "" {
+		if !strings.HasPrefix(token, "Bearer ") {
+			return nil, errors.New("unsupported authorization scheme")
+		}
+		secret := []byte(strings.TrimPrefix(token, "Bearer "))
+		for _, key := range conf.apiKeys {
+			if subtle.ConstantTimeCompare([]byte(key.Key), secret) == 1 {
+				return key, nil
+			}
+		}
+		return nil, errors.New("unrecognized API key")
+	}
+
+	values := request.URL.Query()
+	if values.Get(signatureParam) == "" {
+		return nil, errors.New("no API key or signature")
+	}
+	if !allowSigned {
+		return nil, errors.New("signed URL not accepted for request")
+	}
+	var key *apiKey
+	for _, k := range conf.apiKeys {
+		if k.Name == values.Get(signedKeyParam) {
+			key = k
+		}
+	}
+	if key == nil {
+		return nil, errors.New("signed with unrecognized API key")
+	}
+	expires, err := strconv.ParseInt(values.Get(signedExpiryParam), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return nil, errors.New("signed URL expired")
+	}
+	expected, _ := hex.DecodeString(signature(key, request.URL.Path, values))
+	given, err := hex.DecodeString(values.Get(signatureParam))
+	if err != nil || !hmac.Equal(expected, given) {
+		return nil, errors.New("invalid signature")
+	}
+	return key, nil
+}
+
+// Responds to a request made without a valid API key.
+func unauthorized(out http.ResponseWriter, request *http.Request, err error) {
+	log.Printf("Unauthorized request from %s: %v\n", request.RemoteAddr, err)
+	out.Header().Set("WWW-Authenticate", authenticateHeader)
+	http.Error(out, "Unauthorized", 401)
+}
+
+// Checks that a request was made with an API key allowing it to read (or, if
+// write is set, to write) the named feed, responding with an error and
+// returning false if not. Every request is allowed if no API keys are
+// configured.
+func authorize(
+	out http.ResponseWriter,
+	request *http.Request,
+	feed string,
+	write bool) bool {
+
+	if len(conf.apiKeys) == 0 {
+		return true
+	}
+
+	key, err := authenticate(request, !write)
+	if err != nil {
+		unauthorized(out, request, err)
+		return false
+	}
+	if write && !key.canWrite(feed) || !write && !key.canRead(feed) {
+		log.Printf(
+			"Forbidden request from %s with API key \"%s\" for feed \"%s\"\n",
+			request.RemoteAddr,
+			key.Name,
+			feed)
+		http.Error(out, "Forbidden", 403)
+		return false
+	}
+	return true
+}
+
+// Responds to a request for a signed URL for a request to read a feed, given as
+// a path and query string in the "url" parameter, to be accepted for the
+// length of time given in the "ttl" parameter. The URL is signed with the API
+// key the request was made with, which must be allowed to read the feed.
+func writeSignedURL(out http.ResponseWriter, request *http.Request) {
+
+	if len(conf.apiKeys) == 0 {
+		http.Error(out, "No API keys configured to sign with", 404)
+		return
+	}
+	key, err := authenticate(request, false)
+	if err != nil {
+		unauthorized(out, request, err)
+		return
+	}
+
+	values := request.URL.Query()
+	target, err := url.Parse(values.Get("url"))
+	if err != nil || target.Path == "" || target.IsAbs() {
+		http.Error(out, "Malformed URL to sign", 400)
+		return
+	}
+	ttl := conf.maxSignedTTL
+	if values.Get("ttl") != "" {
+		ttl, err = time.ParseDuration(values.Get("ttl"))
+		if err != nil || ttl <= 0 || ttl > conf.maxSignedTTL {
+			msg := fmt.Sprintf("TTL must be up to %v", conf.maxSignedTTL)
+			http.Error(out, msg, 400)
+			return
+		}
+	}
+
+	feed := target.Query().Get("feed")
+	if !key.canRead(feed) {
+		http.Error(out, "Forbidden", 403)
+		return
+	}
+
+	out.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(
+		out,
+		signURL(key, target.Path, target.Query(), time.Now().Add(ttl)))
+}
@@ -0,0 +1,260 @@
+// Perspective: Graphing library for quality control in event-driven systems
+
+// Copyright (C) 2016 Christian Paro <christian.paro@gmail.com>,
+//                                   <cparo@digitalocean.com>
+
+// This program is free software: you can redistribute it and/or modify it under
+// the terms of the GNU General Public License version 2 as published by the
+// Free Software Foundation.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+
+// You should have received a copy of the GNU General Public License along with
+// this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	dashboardsKey = "dashboards-secret-0001"
+	nycKey        = "nyc-team-secret-0001"
+)
+
+// Starts a server with one key to read all feeds, and one to read and write
+// only feeds for the nyc region.
+func testAuthServer(t *testing.T, dir string) *httptest.Server {
+	return testServer(
+		t,
+		dir,
+		map[string]interface{}{
+			"api-keys": []map[string]interface{}{
+				{
+					"name": "dashboards",
+					"key":  dashboardsKey,
+					"read": []string{"*"}},
+				{
+					"name":  "nyc",
+					"key":   nycKey,
+					"write": []string{"nyc-*"}}}})
+}
+
+// Makes a GET request with the given API key (if any), returning the status of
+// the response along with its body.
+func get(t *testing.T, address string, key string) (int, string) {
+	return send(t, "GET", address, key)
+}
+
+// Makes a request with the given method and API key (if any), returning the
+// status of the response along with its body.
+func send(
+	t *testing.T,
+	method string,
+	address string,
+	key string) (int, string) {
+
+	request, err := http.NewRequest(method, address, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != "" {
+		request.Header.Set("Authorization", "Bearer "+key)
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return response.StatusCode, string(body)
+}
+
+// File to be uploaded as the given field of a multipart form.
+type formFile struct {
+	field   string
+	name    string
+	content []byte
+}
+
+// Uploads the given content as a feed file with the given name to the given
+// address, with the given API key (if any).
+func postFile(
+	t *testing.T,
+	address string,
+	key string,
+	name string,
+	content []byte) *http.Response {
+
+	return postFiles(t, address, key, formFile{"file", name, content})
+}
+
+// Uploads the given files as a multipart form to the given address, with the
+// given API key (if any).
+func postFiles(
+	t *testing.T,
+	address string,
+	key string,
+	files ...formFile) *http.Response {
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for _, f := range files {
+		file, err := form.CreateFormFile(f.field, f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file.Write(f.content)
+	}
+	form.Close()
+	request, err := http.NewRequest("POST", address, &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set("Content-Type", form.FormDataContentType())
+	if key != "" {
+		request.Header.Set("Authorization", "Bearer "+key)
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return response
+}
+
+// Uploads a feed file as postFile does, returning the status of the response.
+func upload(
+	t *testing.T,
+	address string,
+	key string,
+	name string,
+	content []byte) int {
+
+	response := postFile(t, address, key, name, content)
+	response.Body.Close()
+	return response.StatusCode
+}
+
+func TestAuthRead(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	server := testAuthServer(t, dir)
+	defer server.Close()
+
+	address := server.URL + "/success-rate?feed=test&max-time=600"
+	cases := []struct {
+		address string
+		key     string
+		status  int
+	}{
+		{address, "", 401},
+		{address, "wrong-secret-000001", 401},
+		{address, dashboardsKey, 200},
+		{address, nycKey, 403},
+		{server.URL + "/help", "", 200}}
+	for _, c := range cases {
+		if status, _ := get(t, c.address, c.key); status != c.status {
+			t.Errorf("%s with %q: status %d", c.address, c.key, status)
+		}
+	}
+}
+
+func TestAuthWrite(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	server := testAuthServer(t, dir)
+	defer server.Close()
+
+	content := make([]byte, 32)
+	cases := []struct {
+		key    string
+		name   string
+		status int
+	}{
+		{"", "nyc-jobs.dat", 401},
+		{dashboardsKey, "nyc-jobs.dat", 403},
+		{nycKey, "test.dat", 403},
+		{nycKey, "nyc-jobs.dat", 200}}
+	for _, c := range cases {
+		status := upload(t, server.URL+"/post-data", c.key, c.name, content)
+		if status != c.status {
+			t.Errorf("Upload of %s with %q: status %d", c.name, c.key, status)
+		}
+	}
+
+	// Only the permitted upload should have replaced or created a feed.
+	info, err := os.Stat(filepath.Join(dir, "feeds", "test.dat"))
+	if err != nil || info.Size() == int64(len(content)) {
+		t.Errorf("Feed overwritten by forbidden upload: %v", err)
+	}
+	_, err = os.Stat(filepath.Join(dir, "feeds", "nyc-jobs.dat"))
+	if err != nil {
+		t.Errorf("Permitted upload not written: %v", err)
+	}
+
+	// Keys allowed to write a feed are allowed to read it.
+	status, _ := get(t, server.URL+"/success-rate?feed=nyc-jobs", nycKey)
+	if status != 200 {
+		t.Errorf("Feed written with key not readable with it: %d", status)
+	}
+}
+
+func TestSignedURL(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	server := testAuthServer(t, dir)
+	defer server.Close()
+
+	target := "/success-rate?feed=test&max-time=600"
+	sign := server.URL + "/sign-url?url=" + url.QueryEscape(target)
+	status, signed := get(t, sign+"&ttl=1h", dashboardsKey)
+	if status != 200 {
+		t.Fatalf("Signing failed with status %d", status)
+	}
+	signed = strings.TrimSpace(signed)
+	if status, rate := get(t, server.URL+signed, ""); status != 200 {
+		t.Errorf("Signed URL %s refused with status %d", signed, status)
+	} else if rate != "50.000%" {
+		t.Errorf("Signed URL gave %q", rate)
+	}
+
+	key := conf.apiKeys[0]
+	values := url.Values{"feed": {"test"}, "max-time": {"600"}}
+	expired := signURL(
+		key, "/success-rate", values, time.Now().Add(-time.Second))
+	tampered := strings.Replace(signed, "max-time=600", "max-time=700", 1)
+	write := signURL(key, "/post-data", values, time.Now().Add(time.Hour))
+	cases := []struct {
+		address string
+		key     string
+		status  int
+	}{
+		{server.URL + expired, "", 401},
+		{server.URL + tampered, "", 401},
+		{server.URL + write, "", 401},
+		{sign, "", 401},
+		{sign, nycKey, 403},
+		{sign + "&ttl=10000h", dashboardsKey, 400}}
+	for _, c := range cases {
+		if status, _ := get(t, c.address, c.key); status != c.status {
+			t.Errorf("%s with %q: status %d", c.address, c.key, status)
+		}
+	}
+}
@@ -0,0 +1,387 @@
+// Perspective: Graphing library for quality control in event-driven systems
+
+// Copyright (C) 2016 Christian Paro <christian.paro@gmail.com>,
+//                                   <cparo@digitalocean.com>
+
+// This program is free software: you can redistribute it and/or modify it under
+// the terms of the GNU General Public License version 2 as published by the
+// Free Software Foundation.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+
+// You should have received a copy of the GNU General Public License along with
+// this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/cparo/perspective"
+	"github.com/cparo/perspective/actions"
+	"github.com/cparo/perspective/feeds"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Prefix of the names of environment variables overriding settings, which are
+// otherwise named as their flags are, in upper case with underscores in place
+// of dashes (as in PERSPECTIVE_DATA_PATH for -data-path).
+const envPrefix = "PERSPECTIVE_"
+
+// Keys in the configuration file under which default values for the parameters
+// of actions are given (by parameter name), and the API keys which requests may
+// be made with.
+const (
+	defaultsKey = "defaults"
+	apiKeysKey  = "api-keys"
+)
+
+// config holds the settings of the server, taken from (in increasing order of
+// precedence) their built-in defaults, a configuration file, environment
+// variables and command-line flags.
+type config struct {
+	listen        string            // Address to listen on
+	dataPath      string            // Directory holding feeds
+	stagePath     string            // Directory for feeds being uploaded
+	staticPath    string            // Directory of static content
+	tlsCert       string            // TLS certificate file, if serving TLS
+	tlsKey        string            // TLS private key file, if serving TLS
+	readTimeout   time.Duration     // Time limit for reading a request
+	writeTimeout  time.Duration     // Time limit for writing a response
+	renderTimeout time.Duration     // Time limit for a render, queue included
+	renderWorkers int               // Number of renders run at once
+	renderQueue   int               // Number of renders waiting for a worker
+	retryAfter    time.Duration     // Delay for retries after overloads
+	maxUpload     int64             // Size limit for uploads, in bytes
+	maxSignedTTL  time.Duration     // Longest lifetime of a signed URL
+	apiKeys       []*apiKey         // API keys, if access is restricted
+	errorConfig   string            // Error-reason filter config file
+	errorFilters  []*regexp.Regexp  // Filters classifying error reasons
+	defaults      map[string]string // Default parameter values, by name
+	aliases       map[string]string // Parameter aliases, by name
+}
+
+// Returns the flags for the settings of the server, set into the given
+// configuration, with the flag for the path to the configuration file.
+func configFlags(c *config) (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet("perspective-server", flag.ContinueOnError)
+	path := fs.String("config", "", "Path to JSON configuration file.")
+	fs.StringVar(&c.listen, "listen", ":8080", "Address to listen on.")
+	fs.StringVar(
+		&c.dataPath,
+		"data-path",
+		"/var/opt/perspective/feeds/",
+		"Directory holding feeds.")
+	fs.StringVar(
+		&c.stagePath,
+		"stage-path",
+		"/var/opt/perspective/feeds/stage/",
+		"Directory for feeds being uploaded.")
+	fs.StringVar(
+		&c.staticPath,
+		"static-path",
+		"/var/opt/perspective/static/",
+		"Directory of static content.")
+	fs.StringVar(&c.tlsCert, "tls-cert", "", "TLS certificate file.")
+	fs.StringVar(&c.tlsKey, "tls-key", "", "TLS private key file.")
+	fs.DurationVar(
+		&c.readTimeout,
+		"read-timeout",
+		time.Minute,
+		"Time limit for reading a request, including any uploaded feed.")
+	fs.DurationVar(
+		&c.writeTimeout,
+		"write-timeout",
+		2*time.Minute,
+		"Time limit for writing a response, from the end of the request.")
+	fs.DurationVar(
+		&c.renderTimeout,
+		"render-timeout",
+		90*time.Second,
+		"Time limit for a render, including time queued for a worker.")
+	fs.IntVar(
+		&c.renderWorkers,
+		"render-workers",
+		runtime.GOMAXPROCS(0),
+		"Number of renders run at once.")
+	fs.IntVar(
+		&c.renderQueue,
+		"render-queue",
+		16,
+		"Number of renders which may wait for a worker before further "+
+			"requests are turned away.")
+	fs.DurationVar(
+		&c.retryAfter,
+		"retry-after",
+		5*time.Second,
+		"Time after which requests turned away are to be retried.")
+	fs.Int64Var(
+		&c.maxUpload,
+		"max-upload-size",
+		1<<30,
+		"Size limit for uploaded feeds, in bytes.")
+	fs.DurationVar(
+		&c.maxSignedTTL,
+		"max-signed-ttl",
+		30*24*time.Hour,
+		"Longest time for which a signed URL may be accepted.")
+	fs.StringVar(
+		&c.errorConfig,
+		"error-reason-filter",
+		"",
+		"Error-reason filter config, for classifying failures in uploaded "+
+			"CSV.")
+	return fs, path
+}
+
+// Returns the name of the environment variable overriding the named setting.
+func envName(setting string) string {
+	return envPrefix + strings.ToUpper(strings.Replace(setting, "-", "_", -1))
+}
+
+// loadConfig reads the settings of the server from the given command-line
+// arguments, the environment (through the given lookup function), and the
+// configuration file named by either of them, if any. The configuration file
+// is a JSON object of values keyed by flag name, along with an object of
+// default values for the parameters of actions under the "defaults" key and an
+// array of API keys under the "api-keys" key. An error is returned if any
+// setting is unrecognized or invalid.
+func loadConfig(args []string, getenv func(string) string) (*config, error) {
+
+	c := &config{defaults: make(map[string]string)}
+	fs, path := configFlags(c)
+	fs.SetOutput(ioutil.Discard)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected argument: \"%s\"", fs.Arg(0))
+	}
+
+	// Settings given as flags take precedence over all others, so are left
+	// as they are.
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+	set := func(name string, value string, source string) error {
+		if given[name] {
+			return nil
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf(
+				"invalid value \"%s\" for %s in %s", value, name, source)
+		}
+		return nil
+	}
+
+	if !given["config"] {
+		*path = getenv(envName("config"))
+	}
+	if *path != "" {
+		settings, err := readConfigFile(*path)
+		if err != nil {
+			return nil, err
+		}
+		for name, value := range settings {
+			if name == defaultsKey {
+				err = c.setDefaults(value)
+			} else if name == apiKeysKey {
+				err = c.setAPIKeys(value)
+			} else if fs.Lookup(name) == nil || name == "config" {
+				err = fmt.Errorf(
+					"unrecognized setting \"%s\" in %s", name, *path)
+			} else {
+				err = set(name, jsonString(value), *path)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		value := getenv(envName(f.Name))
+		if err == nil && value != "" && f.Name != "config" {
+			err = set(f.Name, value, envName(f.Name))
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return c, c.validate()
+}
+
+// Reads a configuration file, returning its settings with numbers left as they
+// were written.
+func readConfigFile(path string) (map[string]interface{}, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var settings map[string]interface{}
+	decoder := json.NewDecoder(file)
+	decoder.UseNumber()
+	if err := decoder.Decode(&settings); err != nil {
+		return nil, fmt.Errorf("malformed configuration file %s: %v", path, err)
+	}
+	return settings, nil
+}
+
+// Returns a value from a configuration file in the form it would take as a flag
+// value, for strings, numbers and booleans.
+func jsonString(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	return fmt.Sprint(value)
+}
+
+// Sets the default parameter values given in a configuration file.
+func (c *config) setDefaults(value interface{}) error {
+	defaults, ok := value.(map[string]interface{})
+	if !ok {
+		return errors.New("defaults must be an object of parameter values")
+	}
+	for name, value := range defaults {
+		c.defaults[name] = jsonString(value)
+	}
+	return nil
+}
+
+// Sets the API keys given in a configuration file, as an array of objects in
+// the form of apiKey.
+func (c *config) setAPIKeys(value interface{}) error {
+	encoded, err := json.Marshal(value)
+	if err == nil {
+		err = json.Unmarshal(encoded, &c.apiKeys)
+	}
+	if err != nil {
+		return fmt.Errorf("malformed API keys: %v", err)
+	}
+	return nil
+}
+
+// Checks the settings, API keys and default parameter values for validity.
+func (c *config) validate() error {
+
+	if _, _, err := net.SplitHostPort(c.listen); err != nil {
+		return fmt.Errorf("invalid listen address \"%s\": %v", c.listen, err)
+	}
+	if c.dataPath == "" || c.stagePath == "" || c.staticPath == "" {
+		return errors.New("data, stage and static paths must all be set")
+	}
+
+	if (c.tlsCert == "") != (c.tlsKey == "") {
+		return errors.New("TLS certificate and key must be given together")
+	}
+	if c.tlsCert != "" {
+		if _, err := tls.LoadX509KeyPair(c.tlsCert, c.tlsKey); err != nil {
+			return fmt.Errorf("unusable TLS certificate or key: %v", err)
+		}
+	}
+
+	// A render which runs out of time needs time left over to say so before
+	// its response is cut off.
+	if c.readTimeout < 0 || c.writeTimeout < 0 || c.retryAfter < 0 {
+		return errors.New("timeouts must not be negative")
+	}
+	if c.renderTimeout <= 0 {
+		return errors.New("render timeout must be positive")
+	}
+	if c.writeTimeout > 0 && c.renderTimeout >= c.writeTimeout {
+		return errors.New("render timeout must be less than the write timeout")
+	}
+	if c.renderWorkers < 1 || c.renderQueue < 0 {
+		return errors.New(
+			"render workers must be positive, and queue non-negative")
+	}
+	if c.maxUpload <= 0 {
+		return errors.New("upload size limit must be positive")
+	}
+	if c.maxSignedTTL <= 0 {
+		return errors.New("signed URL lifetime must be positive")
+	}
+	filters, err := feeds.LoadErrorReasonFilters(c.errorConfig)
+	if err != nil {
+		return fmt.Errorf("unusable error-reason filter config: %v", err)
+	}
+	c.errorFilters = filters
+
+	// Keys are told apart by their names in signed URLs, and by their secrets
+	// in bearer tokens, so neither may be shared.
+	names := make(map[string]bool)
+	secrets := make(map[string]bool)
+	for _, key := range c.apiKeys {
+		if err := key.validate(); err != nil {
+			return err
+		}
+		if names[key.Name] || secrets[key.Key] {
+			return fmt.Errorf("API key \"%s\" is not unique", key.Name)
+		}
+		names[key.Name], secrets[key.Key] = true, true
+	}
+
+	// Defaults are checked as they would be if given in a request, and may
+	// only be given under the names (rather than the aliases) of parameters.
+	params := actions.AllParams()
+	c.aliases = make(map[string]string)
+	known := make(map[string]bool)
+	for _, p := range params {
+		known[p.Name] = true
+		if p.Alias != "" {
+			c.aliases[p.Name] = p.Alias
+		}
+	}
+	for name := range c.defaults {
+		if !known[name] {
+			return fmt.Errorf("default for unrecognized parameter \"%s\"", name)
+		}
+	}
+	perspective.ParseParams(
+		params,
+		func(name string) string {
+			return c.defaults[name]
+		},
+		func(rejected *perspective.ParamError) {
+			if err == nil {
+				err = fmt.Errorf(
+					"invalid default \"%s\" for %s: %s",
+					rejected.Value,
+					rejected.Name,
+					rejected.Reason)
+			}
+		})
+	return err
+}
+
+// Returns a lookup function for parameter values from the given query values,
+// falling back on the configured defaults for those not given under either
+// their names or aliases.
+func (c *config) lookup(values url.Values) func(string) string {
+	return func(name string) string {
+		if value := values.Get(name); value != "" {
+			return value
+		}
+		if alias, exists := c.aliases[name]; exists && values.Get(alias) != "" {
+			return ""
+		}
+		return c.defaults[name]
+	}
+}
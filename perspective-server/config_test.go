@@ -0,0 +1,175 @@
+// Perspective: Graphing library for quality control in event-driven systems
+
+// Copyright (C) 2016 Christian Paro <christian.paro@gmail.com>,
+//                                   <cparo@digitalocean.com>
+
+// This program is free software: you can redistribute it and/or modify it under
+// the terms of the GNU General Public License version 2 as published by the
+// Free Software Foundation.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+
+// You should have received a copy of the GNU General Public License along with
+// this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Returns an environment lookup function for the given variables.
+func env(vars map[string]string) func(string) string {
+	return func(name string) string {
+		return vars[name]
+	}
+}
+
+// Creates a temporary directory, returning its path along with a function to
+// clean it up.
+func tempDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "perspective")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+// Writes a configuration file with the given content into the given directory,
+// returning its path.
+func writeConfig(t *testing.T, dir string, content string) string {
+	path := filepath.Join(dir, "perspective.json")
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigDefaults(t *testing.T) {
+	c, err := loadConfig(nil, env(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.listen != ":8080" || c.dataPath != "/var/opt/perspective/feeds/" {
+		t.Errorf("Unexpected defaults: %s, %s", c.listen, c.dataPath)
+	}
+}
+
+// Settings from flags take precedence over those from the environment, which
+// take precedence over those from the configuration file.
+func TestLoadConfigPrecedence(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	path := writeConfig(t, dir, `{
+		"listen": "127.0.0.1:9000",
+		"data-path": "/srv/file/feeds",
+		"render-workers": 3,
+		"render-queue": 5,
+		"defaults": {"height": 256, "jitter": "none"}}`)
+	c, err := loadConfig(
+		[]string{"-config", path, "-render-queue", "7"},
+		env(map[string]string{
+			"PERSPECTIVE_DATA_PATH":    "/srv/env/feeds",
+			"PERSPECTIVE_RENDER_QUEUE": "6"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.listen != "127.0.0.1:9000" {
+		t.Errorf("Listen address from file not applied: %s", c.listen)
+	}
+	if c.dataPath != "/srv/env/feeds" {
+		t.Errorf("Data path from environment not applied: %s", c.dataPath)
+	}
+	if c.renderWorkers != 3 || c.renderQueue != 7 {
+		t.Errorf("Render limits %d, %d", c.renderWorkers, c.renderQueue)
+	}
+	if c.defaults["height"] != "256" || c.defaults["jitter"] != "none" {
+		t.Errorf("Defaults from file not applied: %v", c.defaults)
+	}
+}
+
+func TestLoadConfigFromEnvironment(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	path := writeConfig(t, dir, `{"write-timeout": "10m"}`)
+	c, err := loadConfig(
+		nil, env(map[string]string{"PERSPECTIVE_CONFIG": path}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.writeTimeout != 10*time.Minute {
+		t.Errorf("Write timeout from file not applied: %v", c.writeTimeout)
+	}
+}
+
+func TestLoadConfigInvalid(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	cert := filepath.Join(dir, "missing.pem")
+	cases := []struct {
+		args   []string
+		config string
+		reason string
+	}{
+		{[]string{"-render-workers", "x"}, "", "invalid value"},
+		{[]string{"extra"}, "", "unexpected argument"},
+		{nil, `{"listen": "8080"}`, "listen address"},
+		{nil, `{"lissen": ":8080"}`, "unrecognized setting"},
+		{nil, `{"read-timeout": "soon"}`, "invalid value"},
+		{nil, `{"data-path": ""}`, "paths"},
+		{nil, `[]`, "malformed"},
+		{[]string{"-tls-cert", cert}, "", "together"},
+		{[]string{"-tls-cert", cert, "-tls-key", cert}, "", "TLS"},
+		{[]string{"-render-timeout", "5m"}, "", "write timeout"},
+		{[]string{"-render-workers", "0"}, "", "render workers"},
+		{[]string{"-max-upload-size", "0"}, "", "upload"},
+		{nil, `{"defaults": []}`, "defaults"},
+		{nil, `{"defaults": {"hieght": 256}}`, "unrecognized parameter"},
+		{nil, `{"defaults": {"event-type-id": 3}}`, "unrecognized parameter"},
+		{nil, `{"defaults": {"height": "tall"}}`, "invalid default"},
+		{nil, `{"defaults": {"width": 0}}`, "invalid default"},
+		{nil, `{"api-keys": {}}`, "malformed API keys"},
+		{nil, `{"api-keys": [{"name": "a", "key": "short"}]}`, "shorter"},
+		{nil, `{"api-keys": [{"key": "0123456789abcdef"}]}`, "name"},
+		{
+			nil,
+			`{"api-keys": [
+				{"name": "a", "key": "0123456789abcdef"},
+				{"name": "a", "key": "fedcba9876543210"}]}`,
+			"not unique"},
+		{
+			nil,
+			`{"api-keys": [
+				{"name": "a", "key": "0123456789abcdef", "read": ["["]}]}`,
+			"invalid feed pattern"}}
+	for _, c := range cases {
+		args := c.args
+		if c.config != "" {
+			args = append(args, "-config", writeConfig(t, dir, c.config))
+		}
+		_, err := loadConfig(args, env(nil))
+		if err == nil || !strings.Contains(err.Error(), c.reason) {
+			t.Errorf("%v %s: got error %v, expected %q",
+				c.args, c.config, err, c.reason)
+		}
+	}
+}
+
+func TestLoadConfigMissingFile(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	path := filepath.Join(dir, "missing.json")
+	if _, err := loadConfig([]string{"-config", path}, env(nil)); err == nil {
+		t.Error("Missing configuration file accepted.")
+	} else if !os.IsNotExist(err) {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
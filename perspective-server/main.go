@@ -18,8 +18,14 @@
 package main
 
 import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
 	"github.com/cparo/perspective"
+	"github.com/cparo/perspective/actions"
 	"github.com/cparo/perspective/feeds"
 	"io"
 	"log"
@@ -28,203 +34,143 @@ import (
 	"os"
 	"strconv"
 	"strings"
-	"time"
 )
 
-const dataPath = "/var/opt/perspective/feeds/"
-const stagePath = "/var/opt/perspective/feeds/stage/"
-const staticContentPath = "/var/opt/perspective/static/"
-
-// Mapping of action names to handler functions:
-var handlers = make(map[string]func(http.ResponseWriter, *options))
-
-// Options and arguments:
-type options struct {
-	statusFilter int     // Least significant bits: {done, failed, running}.
-	typeFilter   int     // Event type to filter for, if non-negative.
-	regionFilter int     // Region to filter for, if non-negative.
-	tA           int     // Lower limit of time range to be visualized.
-	tΩ           int     // Upper limit of time range to be visualized.
-	p0           int     // A point in time representing the start of a period.
-	pτ           int     // The interval length for periodic visualizations.
-	xGrid        int     // Number of horizontal grid divisions.
-	yLog2        float64 // Number of pixels over which elapsed times double.
-	w            int     // Visualization width, in pixels.
-	h            int     // Visualization height, in pixels.
-	bg           int     // Graph background color.
-	colors       float64 // The number of color steps before saturation.
-	resonance    float64 // Resonance value for line-smoothing.
-	feed         string  // Input feed name.
-	lookback     int     // Events to look back through in feed (0 for all).
-}
-
-func init() {
-
-	handlers["vis-count-lines"] = func(out http.ResponseWriter, r *options) {
-		visualize(
-			perspective.NewCountLines(
-				r.w, r.h, r.bg, r.tA, r.tΩ, r.resonance, r.xGrid),
-			out,
-			r)
-	}
+// Settings of the server, the pool of workers for its renders, and the
+// registry of its feeds.
+var (
+	conf     *config
+	renders  *renderPool
+	registry *feeds.Registry
+)
 
-	handlers["vis-run-time-line"] = func(out http.ResponseWriter, r *options) {
-		visualize(
-			perspective.NewRunTimeLine(
-				r.w, r.h, r.bg, r.tA, r.tΩ, r.yLog2, r.xGrid),
-			out,
-			r)
-	}
+func main() {
 
-	handlers["vis-histogram"] = func(out http.ResponseWriter, r *options) {
-		visualize(perspective.NewHistogram(r.w, r.h, r.bg, r.yLog2), out, r)
+	c, err := loadConfig(os.Args[1:], os.Getenv)
+	if err == flag.ErrHelp {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags]\n", os.Args[0])
+		fmt.Fprintf(
+			os.Stderr,
+			"Each flag may also be set by environment variable (like %s) "+
+				"or in the -config file.\n",
+			envName("data-path"))
+		fs, _ := configFlags(&config{})
+		fs.PrintDefaults()
+		return
 	}
-
-	handlers["vis-polar-scatter"] = func(out http.ResponseWriter, r *options) {
-		visualize(
-			perspective.NewPolarScatter(
-				r.w, r.h, r.bg, r.tA, r.tΩ, r.p0, r.pτ, r.yLog2, r.colors),
-			out,
-			r)
+	if err != nil {
+		log.Fatalln("Invalid configuration:", err)
 	}
 
-	handlers["vis-scatter"] = func(out http.ResponseWriter, r *options) {
-		visualize(
-			perspective.NewScatter(
-				r.w, r.h, r.bg, r.tA, r.tΩ, r.yLog2, r.colors, r.xGrid),
-			out,
-			r)
+	handler, err := setup(c)
+	if err != nil {
+		log.Fatalln(err)
 	}
 
-	handlers["vis-median-lines"] = func(out http.ResponseWriter, r *options) {
-		visualize(
-			perspective.NewMedianLines(
-				r.w, r.h, r.bg, r.tA, r.tΩ, r.yLog2, r.resonance, r.xGrid),
-			out,
-			r)
+	server := &http.Server{
+		Addr:         c.listen,
+		Handler:      handler,
+		ReadTimeout:  c.readTimeout,
+		WriteTimeout: c.writeTimeout}
+	if c.tlsCert != "" {
+		log.Fatalln(server.ListenAndServeTLS(c.tlsCert, c.tlsKey))
 	}
+	log.Fatalln(server.ListenAndServe())
 }
 
-func dumpEventData(out http.ResponseWriter, r *options) {
+// Makes the server ready to run with the given settings, returning the handler
+// for its requests.
+func setup(c *config) (http.Handler, error) {
 
-	eventData := loadFeed(r.feed, r.lookback, out)
-	if eventData == nil {
-		return
-	}
-	feeds.DumpEventData(
-		eventData,
-		int32(r.tA),
-		int32(r.tΩ),
-		r.typeFilter,
-		r.regionFilter,
-		r.statusFilter,
-		out)
-	feeds.UnmapBinLogFile(eventData)
-}
+	conf = c
+	renders = newRenderPool(c.renderWorkers, c.renderQueue)
+	registry = feeds.NewRegistry(c.dataPath, c.stagePath)
 
-func f64Opt(values url.Values, name string, defaultValue float64) float64 {
-	strValue := values.Get(name)
-	if strValue == "" {
-		return defaultValue
-	}
-	f64Value, err := strconv.ParseFloat(strValue, 64)
-	if err != nil {
-		logMalformedOption(name, strValue)
-		return defaultValue
+	// Make sure we have a valid set of paths, and bail with a clear explanation
+	// if we can't find or create them:
+	dirs := []struct {
+		path        string
+		description string
+	}{
+		{c.dataPath, "data"},
+		{c.stagePath, "data staging"},
+		{c.staticPath, "static-content"}}
+	for _, dir := range dirs {
+		if err := os.MkdirAll(dir.path, 0700); err != nil {
+			return nil, fmt.Errorf(
+				"failed to create missing %s directory at \"%s\": %v",
+				dir.description,
+				dir.path,
+				err)
+		}
 	}
-	return f64Value
-}
 
-func getSuccessRate(out http.ResponseWriter, r *options) {
-
-	eventData := loadFeed(r.feed, r.lookback, out)
-	if eventData == nil {
-		return
-	}
-	feeds.GetSuccessRate(
-		eventData,
-		int32(r.tA),
-		int32(r.tΩ),
-		r.typeFilter,
-		r.regionFilter,
-		out)
-	feeds.UnmapBinLogFile(eventData)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", responder)
+	fs := http.FileServer(http.Dir(c.staticPath))
+	mux.Handle("/static/", http.StripPrefix("/static/", fs))
+	return mux, nil
 }
 
-func hasUnitSuffix(value string, unit string) (trimmed string, match bool) {
-	if strings.HasSuffix(value, unit) {
-		return strings.TrimSuffix(value, unit), true
-	}
-	return value, false
-}
+func receiveEventData(request *http.Request, response http.ResponseWriter) {
 
-func intOpt(values url.Values, name string, defaultValue int) int {
-	strValue := values.Get(name)
-	if strValue == "" {
-		return defaultValue
+	// Requests without a valid API key are turned away before their uploads
+	// are read, and those with one are checked for access to the feed once
+	// its name is known.
+	if len(conf.apiKeys) > 0 {
+		if _, err := authenticate(request, false); err != nil {
+			unauthorized(response, request, err)
+			return
+		}
 	}
-	intValue, err := strconv.Atoi(strValue)
+
+	request.Body = http.MaxBytesReader(response, request.Body, conf.maxUpload)
+	file, header, err := request.FormFile("file")
 	if err != nil {
-		logMalformedOption(name, strValue)
-		return defaultValue
+		log.Printf("Failed to handle post request.")
+		log.Println(err)
+		rejectUpload(response, request, err)
+		return
 	}
-	return intValue
-}
-
-func logMalformedOption(name string, value string) {
-	log.Printf(
-		"Malformed option: %s = \"%s\", falling back to default.\n",
-		name,
-		value)
-}
 
-func main() {
+	defer file.Close()
 
-	// Make sure we have a valid set of paths, and bail with a clear explanation
-	// if we can't find or create them:
-	err := os.MkdirAll(dataPath, 0700)
-	if err != nil {
-		log.Printf(
-			"Failed to create missing data directory at \"%s\"\n",
-			dataPath)
-		log.Fatalln(err)
-	}
-	err = os.MkdirAll(stagePath, 0700)
-	if err != nil {
-		log.Printf(
-			"Failed to create missing data staging directory at \"%s\"\n",
-			dataPath)
-		log.Fatalln(err)
+	// The feed is named by the "feed" parameter if given, or otherwise by the
+	// name of the uploaded file, less its extension. Names which are not valid
+	// identifiers (like those with path separators) are rejected outright.
+	name := request.FormValue("feed")
+	if name == "" {
+		name = header.Filename
+		for _, extension := range []string{".dat", ".csv"} {
+			name = strings.TrimSuffix(name, extension)
+		}
 	}
-	err = os.MkdirAll(staticContentPath, 0700)
-	if err != nil {
+	if feeds.ValidateFeedName(name) != nil {
 		log.Printf(
-			"Failed to create missing static-content directory at \"%s\"\n",
-			staticContentPath)
-		log.Fatalln(err)
+			"Rejected upload of invalid feed name \"%s\" from %s\n",
+			name,
+			request.RemoteAddr)
+		http.Error(response, "Invalid Feed Name", 400)
+		return
 	}
 
-	http.HandleFunc("/", responder)
-	fs := http.FileServer(http.Dir(staticContentPath))
-	http.Handle("/static/", http.StripPrefix("/static/", fs))
-	http.ListenAndServe(":8080", nil)
-}
-
-func receiveEventData(request *http.Request, response http.ResponseWriter) {
+	if !authorize(response, request, name, true) {
+		return
+	}
 
-	file, header, err := request.FormFile("file")
+	// Names for the feed's event types and regions may be uploaded along with
+	// it, replacing any it had before, or added to those it has. Uploads to
+	// the feed are taken one at a time from here until the feed and its names
+	// are in place, so names added by one upload are not lost to another.
+	defer registry.Lock(name)()
+	names, keepNames, err := uploadMetadata(request, name)
 	if err != nil {
-		log.Printf("Failed to handle post request.")
-		http.Error(
-			response,
-			fmt.Sprintf("File Upload Failed"),
-			500)
+		log.Println(err)
+		rejectUpload(response, request, err)
 		return
 	}
 
-	defer file.Close()
-
-	feed, err := os.Create(stagePath + header.Filename)
+	feed, err := registry.Stage(name)
 	if err != nil {
 		log.Printf("Failed to create feed file.")
 		http.Error(
@@ -234,82 +180,153 @@ func receiveEventData(request *http.Request, response http.ResponseWriter) {
 		return
 	}
 
-	defer feed.Close()
-
 	_, err = io.Copy(feed, file)
 	if err != nil {
+		registry.Discard(feed)
 		log.Printf("Failed to write to feed file.")
-		http.Error(
-			response,
-			fmt.Sprintf("File Upload Failed"),
-			500)
+		log.Println(err)
+		rejectUpload(response, request, err)
+		return
+	}
+
+	// Only well-formed binary logs are accepted as feeds, with CSV converted
+	// into one first.
+	feed, summary, err := prepareUpload(request, name, names, feed)
+	if err != nil {
+		rejectUpload(response, request, err)
 		return
 	}
 
-	err = os.Rename(stagePath+header.Filename, dataPath+header.Filename)
+	err = registry.Commit(feed, name)
+	if err == nil && keepNames {
+		err = registry.SetMetadata(name, names)
+	}
 	if err != nil {
-		log.Printf("Failed to move feed file from staging directory.")
+		log.Printf("Failed to move feed file and metadata into place.")
 		http.Error(
 			response,
 			fmt.Sprintf("File Upload Failed"),
 			500)
 		return
 	}
+
+	response.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(response).Encode(summary); err != nil {
+		log.Println("Failed to write upload summary.")
+		log.Println(err)
+	}
+}
+
+// Parses the parameters of the given action from the given query values, with
+// event types and regions given by code or by the given names, returning any
+// values rejected along with them.
+func parseParams(
+	action string,
+	values url.Values,
+	names *feeds.Metadata) (perspective.Params, []*perspective.ParamError) {
+
+	var rejected []*perspective.ParamError
+	p := actions.Parse(
+		action,
+		actions.Named(conf.lookup(values), names),
+		func(err *perspective.ParamError) {
+			rejected = append(rejected, err)
+		})
+	return p, rejected
+}
+
+// Responds to a request with a description of each parameter value rejected
+// from it, as JSON.
+func rejectParams(out http.ResponseWriter, rejected []*perspective.ParamError) {
+	out.Header().Set("Content-Type", "application/json")
+	out.WriteHeader(400)
+	err := json.NewEncoder(out).Encode(
+		struct {
+			Errors []*perspective.ParamError `json:"errors"`
+		}{rejected})
+	if err != nil {
+		log.Println("Failed to write parameter errors.")
+		log.Println(err)
+	}
 }
 
 func responder(response http.ResponseWriter, request *http.Request) {
 
-	// Parse options, using the same defaults as are used by the CLI interface
-	// where options are missing or malformed:
-	now := int(time.Now().Unix())
 	values := request.URL.Query()
-	options := &options{
-		intOpt(values, "status-filter", -1),
-		intOpt(values, "event-type", -1),
-		intOpt(values, "region", -1),
-		timeOpt(values, "min-time", 0),
-		timeOpt(values, "max-time", now),
-		timeOpt(values, "period-start", now),
-		timeOpt(values, "period-length", -1),
-		intOpt(values, "x-grid", 0),
-		f64Opt(values, "run-time-scale", 16),
-		intOpt(values, "width", 256),
-		intOpt(values, "height", 256),
-		intOpt(values, "bg", 33),
-		f64Opt(values, "color-steps", 1),
-		f64Opt(values, "smoothing-resonance", 0.85),
-		strOpt(values, "feed", ""),
-		intOpt(values, "lookback", 0)}
-
-	// All lookback values should be positive.
-	if options.lookback < 0 {
-		options.lookback = -options.lookback
-	}
+	feed := values.Get("feed")
 
 	action := request.URL.Path[1:]
 
-	// Special case to handle a request for a dump of the event data (filtered
-	// by the specified time and type options) rather than a visualization of
-	// the event data...
-	if action == "event-data" {
-		dumpEventData(response, options)
+	// Special case to handle a request for to push feed data.
+	if action == "post-data" {
+		receiveEventData(request, response)
 		return
 	}
 
-	// Special case to handle a request for a success-rate percentage.
-	if action == "success-rate" {
-		getSuccessRate(response, options)
+	// Special case to handle a request for a description of the actions, or
+	// of the parameters taken by the action named in the request.
+	if action == "help" {
+		writeHelp(response, values.Get("action"))
 		return
 	}
 
-	// Special case to handle a request for to push feed data.
-	if action == "post-data" {
-		receiveEventData(request, response)
+	// Special case to handle a request for a signed URL, with which another
+	// request may be made without an API key of its own.
+	if action == "sign-url" {
+		writeSignedURL(response, request)
+		return
+	}
+
+	// Requests to list, describe, delete or rename feeds, which check access
+	// to the feeds themselves.
+	if manage, exists := feedManagers[action]; exists {
+		manage(response, request)
+		return
+	}
+
+	// Every other action reads from a feed.
+	if !authorize(response, request, feed, false) {
 		return
 	}
 
-	if handler, exists := handlers[action]; exists {
-		handler(response, options)
+	// Event types and regions may be selected by the names in the feed's
+	// metadata, as well as by their codes.
+	names, err := registry.Metadata(feed)
+	if err != nil {
+		rejectFeed(response, request, feed, err)
+		return
+	}
+
+	// Special case to handle a request for several visualizations rendered
+	// from a single pass over the feed, returned together as a zip archive.
+	if action == "vis-batch" {
+		visualizeBatch(response, request, values, feed, names)
+		return
+	}
+
+	// Requests for a report on the event data (like a dump of the events or a
+	// success-rate percentage) rather than a visualization of the event data.
+	if report, exists := actions.Reports[action]; exists {
+		p, rejected := parseParams(action, values, names)
+		if len(rejected) > 0 {
+			rejectParams(response, rejected)
+			return
+		}
+		render(response, request, func(ctx context.Context) error {
+			return writeReport(ctx, report, response, feed, p)
+		})
+		return
+	}
+
+	if spec := perspective.LookupVisualizer(action); spec != nil {
+		p, rejected := parseParams(action, values, names)
+		if len(rejected) > 0 {
+			rejectParams(response, rejected)
+			return
+		}
+		render(response, request, func(ctx context.Context) error {
+			return visualize(ctx, spec.New(p), response, feed, p)
+		})
 	} else {
 		msg := fmt.Sprintf(
 			"Unrecognized action: \"%s\" from %s",
@@ -320,117 +337,193 @@ func responder(response http.ResponseWriter, request *http.Request) {
 	}
 }
 
-func strOpt(values url.Values, name string, defaultValue string) string {
-	strValue := values.Get(name)
-	if strValue == "" {
-		return defaultValue
+func setTruncatedHeader(out http.ResponseWriter, v perspective.Visualizer) {
+	if t, ok := v.(perspective.TruncatedVisualizer); ok {
+		out.Header().Set("X-Truncated-Events", strconv.Itoa(t.Truncated()))
 	}
-	return strValue
 }
 
-func timeOpt(values url.Values, name string, defaultValue int) int {
-	strValue := values.Get(name)
-	// If no value is specified, fall back to default value...
-	if strValue == "" {
-		return defaultValue
-	}
-	// Attempt parsing the time as a human-friendly timestamp...
-	// Format is: "YYYY-MM-DD HH:MM:SS Z"
-	timeValue, err := time.Parse("2006-01-02 15:04:05 MST", strValue)
-	if err == nil {
-		return int(timeValue.Unix())
-	}
-	// Check for leading "-" as indication of time offset backward from NOW()
-	// rather than forward from the beginning of the Unix epoch.
-	if strings.HasPrefix(strValue, "-") {
-		// Trim any trailing "s" from the option-value string, as this is either
-		// an unimportant plural indicator (which can be safely discarded in
-		// parsing) or an indicator of the seconds unit of time (which can also
-		// be safely discarded in parsing, as seconds are the default unit).
-		// Note that this would not allow for fractional-second units - but that
-		// is okay as the internal assumption is that time is represented in a
-		// granularity of seconds and has no smaller fractional unit. A consumer
-		// of this graphing system could of course submit time stamps whose
-		// integer values represent something else (ms, µs, ns, samples, etc.),
-		// record events with these units and display them with a window in
-		// these units. This off-label usage would just be a bit of a hack in
-		// that internally this system would assume that it is working with
-		// second-level epoch times - and might do unexpected things if given a
-		// unit-suffixed or human-friendly time value for the display range.
-		strValue = strings.TrimSuffix(strValue, "s")
-		// Detect and handle any time-unit-specifying suffix...
-		var unitSeconds int
-		if trimmed, match := hasUnitSuffix(strValue, "year"); match {
-			strValue, unitSeconds = trimmed, 31536000 // Assume 365-day year
-		} else if trimmed, match := hasUnitSuffix(strValue, "month"); match {
-			strValue, unitSeconds = trimmed, 2678400 // Assume 31-day month
-		} else if trimmed, match := hasUnitSuffix(strValue, "week"); match {
-			strValue, unitSeconds = trimmed, 604800
-		} else if trimmed, match := hasUnitSuffix(strValue, "day"); match {
-			strValue, unitSeconds = trimmed, 86400
-		} else if trimmed, match := hasUnitSuffix(strValue, "h"); match {
-			strValue, unitSeconds = trimmed, 3600
-		} else if trimmed, match := hasUnitSuffix(strValue, "m"); match {
-			strValue, unitSeconds = trimmed, 60
-		} else {
-			unitSeconds = 1 // Default to a one-second unit
+func visualize(
+	ctx context.Context,
+	v perspective.Visualizer,
+	out http.ResponseWriter,
+	feed string,
+	p perspective.Params) error {
+
+	eventData := loadFeed(feed, actions.Lookback(p), out)
+	if eventData == nil {
+		return nil
+	}
+	defer feeds.UnmapBinLogFile(eventData)
+
+	// Visualizations which may leave out events get a chance to say so in a
+	// header, as the writer for the rendered visualization is only requested
+	// once all events have been recorded.
+	return feeds.GeneratePNGsFromBinLog(
+		ctx,
+		eventData,
+		[]feeds.Layer{{Filter: actions.Filter(p), Visualizer: v}},
+		func(l *feeds.Layer) (io.Writer, error) {
+			setTruncatedHeader(out, l.Visualizer)
+			return out, nil
+		})
+}
+
+func visualizeBatch(
+	out http.ResponseWriter,
+	request *http.Request,
+	values url.Values,
+	feed string,
+	names *feeds.Metadata) {
+
+	// Each "vis" value names a visualization action, optionally followed by a
+	// query string of options which override those of the batch request itself
+	// for that visualization alone (as in "vis-scatter?status-filter=2").
+	// Every spec is checked before any visualization is constructed, so all
+	// rejected values can be reported together.
+	var rejected []*perspective.ParamError
+	reject := func(err *perspective.ParamError) {
+		rejected = append(rejected, err)
+	}
+	specs := values["vis"]
+	if len(specs) == 0 {
+		reject(&perspective.ParamError{
+			Name:   "vis",
+			Reason: "no visualizations specified"})
+	}
+	visualizers := make([]*perspective.VisualizerSpec, len(specs))
+	params := make([]perspective.Params, len(specs))
+	for i, spec := range specs {
+		action, query := spec, ""
+		if q := strings.Index(spec, "?"); q >= 0 {
+			action, query = spec[:q], spec[q+1:]
 		}
-		// Process what is left of the option value, which should be parsable as
-		// an integer at this point.
-		intValue, err := strconv.Atoi(strValue)
+		visualizers[i] = perspective.LookupVisualizer(action)
+		if visualizers[i] == nil {
+			reject(&perspective.ParamError{
+				Name:   "vis",
+				Value:  spec,
+				Reason: "unrecognized visualization"})
+			continue
+		}
+		overrides, err := url.ParseQuery(query)
 		if err != nil {
-			logMalformedOption(name, strValue)
-			return defaultValue
+			reject(&perspective.ParamError{
+				Name:   "vis",
+				Value:  spec,
+				Reason: "malformed visualization options"})
+			continue
+		}
+		layerValues := url.Values{}
+		for name, value := range values {
+			layerValues[name] = value
+		}
+		for name, value := range overrides {
+			layerValues[name] = value
 		}
-		return int(time.Now().Unix()) + intValue*unitSeconds
+		params[i] = actions.Parse(
+			action,
+			actions.Named(conf.lookup(layerValues), names),
+			reject)
+	}
+	p := perspective.ParseParams(
+		actions.FeedParams,
+		actions.Named(conf.lookup(values), names),
+		reject)
+	if len(rejected) > 0 {
+		rejectParams(out, rejected)
+		return
 	}
-	// Attempt parsing the time value as Unix epoch time in seconds...
-	intValue, err := strconv.Atoi(strValue)
-	if err != nil {
-		logMalformedOption(name, strValue)
-		return defaultValue
+
+	render(out, request, func(ctx context.Context) error {
+
+		layers := make([]feeds.Layer, len(specs))
+		for i, visualizer := range visualizers {
+			layers[i] = feeds.Layer{
+				Name:       fmt.Sprintf("%d-%s.png", i, visualizer.Name),
+				Filter:     actions.Filter(params[i]),
+				Visualizer: visualizer.New(params[i])}
+		}
+
+		eventData := loadFeed(feed, actions.Lookback(p), out)
+		if eventData == nil {
+			return nil
+		}
+		defer feeds.UnmapBinLogFile(eventData)
+
+		// The archive is only started once all events have been recorded, so
+		// a render cut short can still be answered with an error status.
+		var archive *zip.Writer
+		err := feeds.GeneratePNGsFromBinLog(
+			ctx,
+			eventData,
+			layers,
+			func(l *feeds.Layer) (io.Writer, error) {
+				if archive == nil {
+					out.Header().Set("Content-Type", "application/zip")
+					archive = zip.NewWriter(out)
+				}
+				return archive.Create(l.Name)
+			})
+		if err == nil {
+			err = archive.Close()
+		}
+		return err
+	})
+}
+
+func writeHelp(out http.ResponseWriter, action string) {
+	out.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if err := actions.Help(out, action); err != nil {
+		http.Error(out, err.Error(), 404)
 	}
-	return intValue
 }
 
-func visualize(v perspective.Visualizer, out http.ResponseWriter, r *options) {
+func writeReport(
+	ctx context.Context,
+	report *actions.Report,
+	out http.ResponseWriter,
+	feed string,
+	p perspective.Params) error {
 
-	eventData := loadFeed(r.feed, r.lookback, out)
+	eventData := loadFeed(feed, actions.Lookback(p), out)
 	if eventData == nil {
-		return
+		return nil
 	}
-	feeds.GeneratePNGFromBinLog(
-		eventData,
-		int32(r.tA),
-		int32(r.tΩ),
-		r.typeFilter,
-		r.regionFilter,
-		r.statusFilter,
-		v,
-		out)
-	feeds.UnmapBinLogFile(eventData)
+	defer feeds.UnmapBinLogFile(eventData)
+
+	// The report is held until it is complete, so that a report abandoned
+	// part way through can still be answered with an error in its place.
+	var body bytes.Buffer
+	if err := report.Write(ctx, eventData, p, &body); err != nil {
+		return err
+	}
+	out.Header().Set("Content-Type", report.ContentType)
+	_, err := body.WriteTo(out)
+	return err
 }
 
 func loadFeed(
 	feed string,
-	lookback int,
-	out http.ResponseWriter) *[]perspective.EventData {
-
-	path := dataPath + feed + ".dat"
+	lookback int64,
+	out http.ResponseWriter) *feeds.Feed {
 
-	_, err := os.Stat(path)
-	if err != nil {
-		log.Printf(
-			"Unable to stat file for loading: \"%s\"\n", path)
+	eventData, err := registry.Map(feed, lookback)
+	if err == feeds.ErrInvalidFeedName {
+		log.Printf("Invalid feed name requested: \"%s\"\n", feed)
+		http.Error(out, "Invalid Feed Name", 400)
+		return nil
+	}
+	if err == feeds.ErrFeedNotFound {
+		log.Printf("Unable to find feed for loading: \"%s\"\n", feed)
 		http.Error(
 			out,
 			fmt.Sprintf("Specified Feed Not Found"),
 			404)
 		return nil
 	}
-
-	eventData := feeds.MapBinLogFile(path, int64(lookback))
-	if eventData == nil {
+	if err != nil {
+		log.Println(err)
 		http.Error(
 			out,
 			fmt.Sprintf("Internal Server Error"),
@@ -0,0 +1,190 @@
+// Perspective: Graphing library for quality control in event-driven systems
+
+// Copyright (C) 2016 Christian Paro <christian.paro@gmail.com>,
+//                                   <cparo@digitalocean.com>
+
+// This program is free software: you can redistribute it and/or modify it under
+// the terms of the GNU General Public License version 2 as published by the
+// Free Software Foundation.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+
+// You should have received a copy of the GNU General Public License along with
+// this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/cparo/perspective/feeds"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// Handlers for the actions which manage the feeds in the data directory, rather
+// than reading events from one of them.
+var feedManagers = map[string]func(http.ResponseWriter, *http.Request){
+	"feeds":       listFeeds,
+	"feed-info":   describeFeed,
+	"feed-delete": deleteFeed,
+	"feed-rename": renameFeed}
+
+// Responds with a description of each feed the request's API key (if API keys
+// are configured) allows it to read.
+func listFeeds(out http.ResponseWriter, request *http.Request) {
+
+	var key *apiKey
+	if len(conf.apiKeys) > 0 {
+		var err error
+		if key, err = authenticate(request, true); err != nil {
+			unauthorized(out, request, err)
+			return
+		}
+	}
+
+	// Describing the feeds means reading each of them in full, so this is done
+	// with a worker from the render pool like any other pass over a feed.
+	render(out, request, func(ctx context.Context) error {
+		list, err := registry.List(ctx)
+		if err != nil && err == ctx.Err() {
+			return err
+		}
+		if err != nil {
+			rejectFeed(out, request, "", err)
+			return nil
+		}
+		readable := make([]*feeds.FeedInfo, 0, len(list))
+		for _, info := range list {
+			if key == nil || key.canRead(info.Name) {
+				readable = append(readable, info)
+			}
+		}
+		return writeJSON(
+			out,
+			struct {
+				Feeds []*feeds.FeedInfo `json:"feeds"`
+			}{readable})
+	})
+}
+
+// Responds with a description of the feed named by the "feed" parameter.
+func describeFeed(out http.ResponseWriter, request *http.Request) {
+	feed := request.URL.Query().Get("feed")
+	if !authorize(out, request, feed, false) {
+		return
+	}
+	render(out, request, func(ctx context.Context) error {
+		info, err := registry.Describe(ctx, feed)
+		if err != nil && err == ctx.Err() {
+			return err
+		}
+		if err != nil {
+			rejectFeed(out, request, feed, err)
+			return nil
+		}
+		return writeJSON(out, info)
+	})
+}
+
+// Deletes the feed named by the "feed" parameter.
+func deleteFeed(out http.ResponseWriter, request *http.Request) {
+	feed := request.URL.Query().Get("feed")
+	if !allowMethods(out, request, "POST", "DELETE") ||
+		!authorize(out, request, feed, true) {
+		return
+	}
+	defer registry.Lock(feed)()
+	if err := registry.Delete(feed); err != nil {
+		rejectFeed(out, request, feed, err)
+		return
+	}
+	log.Printf("Deleted feed \"%s\" for %s\n", feed, request.RemoteAddr)
+	out.WriteHeader(204)
+}
+
+// Renames the feed named by the "feed" parameter to the name given by the "to"
+// parameter, which must not already name a feed. Renaming a feed requires
+// access to write feeds under both names.
+func renameFeed(out http.ResponseWriter, request *http.Request) {
+	values := request.URL.Query()
+	feed, to := values.Get("feed"), values.Get("to")
+	if !allowMethods(out, request, "POST") ||
+		!authorize(out, request, feed, true) ||
+		!authorize(out, request, to, true) {
+		return
+	}
+
+	// Both names are locked against uploads, in order of name so that renames
+	// between the same two names cannot each wait on a lock the other holds.
+	first, second := feed, to
+	if second < first {
+		first, second = second, first
+	}
+	defer registry.Lock(first)()
+	if second != first {
+		defer registry.Lock(second)()
+	}
+	if err := registry.Rename(feed, to); err != nil {
+		rejectFeed(out, request, feed, err)
+		return
+	}
+	log.Printf(
+		"Renamed feed \"%s\" to \"%s\" for %s\n",
+		feed,
+		to,
+		request.RemoteAddr)
+	out.WriteHeader(204)
+}
+
+// Checks that a request was made with one of the given methods, responding with
+// an error and returning false if not.
+func allowMethods(
+	out http.ResponseWriter,
+	request *http.Request,
+	methods ...string) bool {
+
+	for _, method := range methods {
+		if request.Method == method {
+			return true
+		}
+	}
+	out.Header().Set("Allow", strings.Join(methods, ", "))
+	http.Error(out, "Method Not Allowed", 405)
+	return false
+}
+
+// Responds to a request which the registry failed to carry out for the named
+// feed.
+func rejectFeed(
+	out http.ResponseWriter,
+	request *http.Request,
+	feed string,
+	err error) {
+
+	switch err {
+	case feeds.ErrInvalidFeedName:
+		http.Error(out, "Invalid Feed Name", 400)
+	case feeds.ErrFeedNotFound:
+		http.Error(out, "Specified Feed Not Found", 404)
+	case feeds.ErrFeedExists:
+		http.Error(out, "Feed Already Exists", 409)
+	default:
+		log.Printf(
+			"Failed to manage feed \"%s\" for %s: %v\n",
+			feed,
+			request.RemoteAddr,
+			err)
+		http.Error(out, "Internal Server Error", 500)
+	}
+}
+
+// Writes the given value to a response as JSON.
+func writeJSON(out http.ResponseWriter, value interface{}) error {
+	out.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(out).Encode(value)
+}
@@ -0,0 +1,206 @@
+// Perspective: Graphing library for quality control in event-driven systems
+
+// Copyright (C) 2016 Christian Paro <christian.paro@gmail.com>,
+//                                   <cparo@digitalocean.com>
+
+// This program is free software: you can redistribute it and/or modify it under
+// the terms of the GNU General Public License version 2 as published by the
+// Free Software Foundation.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+
+// You should have received a copy of the GNU General Public License along with
+// this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"github.com/cparo/perspective/feeds"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestListFeeds(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	server := testAuthServer(t, dir)
+	defer server.Close()
+
+	feedPath := filepath.Join(dir, "feeds")
+	err := os.Link(
+		filepath.Join(feedPath, "test.dat"),
+		filepath.Join(feedPath, "nyc-jobs.dat"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each key only sees the feeds it may read.
+	cases := []struct {
+		key   string
+		feeds []string
+	}{
+		{dashboardsKey, []string{"nyc-jobs", "test"}},
+		{nycKey, []string{"nyc-jobs"}}}
+	for _, c := range cases {
+		status, body := get(t, server.URL+"/feeds", c.key)
+		var list struct {
+			Feeds []*feeds.FeedInfo `json:"feeds"`
+		}
+		if err := json.Unmarshal([]byte(body), &list); err != nil {
+			t.Fatalf("Malformed feed list (%d): %s", status, body)
+		}
+		var names []string
+		for _, info := range list.Feeds {
+			names = append(names, info.Name)
+		}
+		if !jsonEqual(names, c.feeds) {
+			t.Errorf("Feeds listed for %q: %v", c.key, names)
+		}
+	}
+	if status, _ := get(t, server.URL+"/feeds", ""); status != 401 {
+		t.Errorf("Feeds listed without key: status %d", status)
+	}
+}
+
+func TestDescribeFeed(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	server := testServer(t, dir, nil)
+	defer server.Close()
+
+	status, body := get(t, server.URL+"/feed-info?feed=test", "")
+	var info map[string]interface{}
+	if err := json.Unmarshal([]byte(body), &info); err != nil {
+		t.Fatalf("Malformed feed description (%d): %s", status, body)
+	}
+	expected := map[string]interface{}{
+		"name":      "test",
+		"format":    "binlog",
+		"size":      3 * 16,
+		"records":   3,
+		"min_start": 10e9,
+		"max_start": 30e9,
+		"types":     []int{0},
+		"regions":   []int{0}}
+	for field, value := range expected {
+		if !jsonEqual(info[field], value) {
+			t.Errorf("Feed %s: %v, expected %v", field, info[field], value)
+		}
+	}
+	if _, exists := info["modified"]; !exists {
+		t.Error("Feed description lacks modification time.")
+	}
+
+	cases := []struct {
+		feed   string
+		status int
+	}{
+		{"missing", 404},
+		{"..", 400}}
+	for _, c := range cases {
+		address := server.URL + "/feed-info?feed=" + c.feed
+		if status, _ := get(t, address, ""); status != c.status {
+			t.Errorf("Description of %q: status %d", c.feed, status)
+		}
+	}
+}
+
+func TestDeleteAndRenameFeeds(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	server := testAuthServer(t, dir)
+	defer server.Close()
+
+	if status := upload(
+		t,
+		server.URL+"/post-data",
+		nycKey,
+		"nyc-jobs.dat",
+		make([]byte, 32)); status != 200 {
+		t.Fatalf("Upload failed: status %d", status)
+	}
+
+	cases := []struct {
+		method  string
+		address string
+		key     string
+		status  int
+	}{
+		{"GET", "/feed-delete?feed=nyc-jobs", nycKey, 405},
+		{"POST", "/feed-delete?feed=nyc-jobs", "", 401},
+		{"POST", "/feed-delete?feed=nyc-jobs", dashboardsKey, 403},
+		{"DELETE", "/feed-delete?feed=test", nycKey, 403},
+		{"POST", "/feed-rename?feed=nyc-jobs&to=test", nycKey, 403},
+		{"POST", "/feed-rename?feed=nyc-jobs&to=nyc-%0A", nycKey, 400},
+		{"POST", "/feed-rename?feed=nyc-jobs&to=nyc-queue", nycKey, 204},
+		{"POST", "/feed-rename?feed=nyc-jobs&to=nyc-queue", nycKey, 404},
+		{"POST", "/feed-delete?feed=nyc-queue", nycKey, 204},
+		{"DELETE", "/feed-delete?feed=nyc-queue", nycKey, 404}}
+	for _, c := range cases {
+		status, _ := send(t, c.method, server.URL+c.address, c.key)
+		if status != c.status {
+			t.Errorf(
+				"%s %s with %q: status %d, expected %d",
+				c.method,
+				c.address,
+				c.key,
+				status,
+				c.status)
+		}
+	}
+
+	// Renaming never replaces an existing feed.
+	upload(t, server.URL+"/post-data", nycKey, "nyc-a.dat", make([]byte, 32))
+	upload(t, server.URL+"/post-data", nycKey, "nyc-b.dat", make([]byte, 16))
+	address := server.URL + "/feed-rename?feed=nyc-a&to=nyc-b"
+	if status, _ := send(t, "POST", address, nycKey); status != 409 {
+		t.Errorf("Rename over existing feed: status %d", status)
+	}
+	info, err := os.Stat(filepath.Join(dir, "feeds", "nyc-b.dat"))
+	if err != nil || info.Size() != 16 {
+		t.Errorf("Existing feed replaced by rename: %v", err)
+	}
+}
+
+// Deleting or renaming a feed waits for any upload to it (or, for a rename, to
+// the name it is given) to finish, so neither can undo the other.
+func TestDeleteAndRenameLocked(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	server := testAuthServer(t, dir)
+	defer server.Close()
+	upload(t, server.URL+"/post-data", nycKey, "nyc-a.dat", make([]byte, 32))
+	upload(t, server.URL+"/post-data", nycKey, "nyc-b.dat", make([]byte, 32))
+
+	cases := []struct {
+		address string
+		locked  string
+	}{
+		{"/feed-delete?feed=nyc-a", "nyc-a"},
+		{"/feed-rename?feed=nyc-b&to=nyc-c", "nyc-c"}}
+	for _, c := range cases {
+		unlock := registry.Lock(c.locked)
+		done := make(chan int)
+		go func() {
+			status, _ := send(t, "POST", server.URL+c.address, nycKey)
+			done <- status
+		}()
+		select {
+		case status := <-done:
+			t.Errorf("%s: status %d with the feed locked", c.address, status)
+			unlock()
+			continue
+		case <-time.After(100 * time.Millisecond):
+		}
+		unlock()
+		if status := <-done; status != 204 {
+			t.Errorf("%s: status %d once unlocked", c.address, status)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+// Perspective: Graphing library for quality control in event-driven systems
+
+// Copyright (C) 2016 Christian Paro <christian.paro@gmail.com>,
+//                                   <cparo@digitalocean.com>
+
+// This program is free software: you can redistribute it and/or modify it under
+// the terms of the GNU General Public License version 2 as published by the
+// Free Software Foundation.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+
+// You should have received a copy of the GNU General Public License along with
+// this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// renderPool bounds the number of renders run at once, holding further renders
+// in a queue of bounded length until a worker is free for them.
+type renderPool struct {
+	workers chan struct{} // Tokens held by renders which are running
+	slots   chan struct{} // Tokens held by renders which are running or queued
+}
+
+func newRenderPool(workers int, queue int) *renderPool {
+	return &renderPool{
+		make(chan struct{}, workers),
+		make(chan struct{}, workers+queue)}
+}
+
+// Waits for a worker to be free, returning false without waiting if the queue
+// is full, or once the context is done if no worker frees up before then.
+func (p *renderPool) acquire(ctx context.Context) bool {
+	select {
+	case p.slots <- struct{}{}:
+	default:
+		return false
+	}
+	select {
+	case p.workers <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		<-p.slots
+		return false
+	}
+}
+
+// Frees the worker held by a render.
+func (p *renderPool) release() {
+	<-p.workers
+	<-p.slots
+}
+
+// Runs a render with a worker from the pool, giving it a context which is done
+// when the client goes away or the render timeout passes. If no worker can be
+// had, or the render cannot be finished, in time, the client is told the server
+// is overloaded and when to try again.
+func render(
+	out http.ResponseWriter,
+	request *http.Request,
+	r func(context.Context) error) {
+
+	ctx, cancel := context.WithTimeout(request.Context(), conf.renderTimeout)
+	defer cancel()
+
+	if !renders.acquire(ctx) {
+		overloaded(out, request)
+		return
+	}
+	defer renders.release()
+
+	err := r(ctx)
+	if err != nil && err == ctx.Err() {
+		overloaded(out, request)
+	} else if err != nil {
+		log.Println("Failed to write response.")
+		log.Println(err)
+	}
+}
+
+// Responds that the server is too busy to handle a request, unless the client
+// has already gone away.
+func overloaded(out http.ResponseWriter, request *http.Request) {
+	if request.Context().Err() != nil {
+		log.Printf("Render abandoned by %s\n", request.RemoteAddr)
+		return
+	}
+	log.Printf("Render refused for %s\n", request.RemoteAddr)
+	seconds := int((conf.retryAfter + time.Second - 1) / time.Second)
+	out.Header().Set("Retry-After", strconv.Itoa(seconds))
+	http.Error(out, "Server Overloaded", 503)
+}
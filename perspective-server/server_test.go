@@ -0,0 +1,364 @@
+// Perspective: Graphing library for quality control in event-driven systems
+
+// Copyright (C) 2016 Christian Paro <christian.paro@gmail.com>,
+//                                   <cparo@digitalocean.com>
+
+// This program is free software: you can redistribute it and/or modify it under
+// the terms of the GNU General Public License version 2 as published by the
+// Free Software Foundation.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+
+// You should have received a copy of the GNU General Public License along with
+// this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"github.com/cparo/perspective"
+	"github.com/cparo/perspective/actions"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Starts a server with its data in the given directory and the given settings
+// (besides its paths), holding a feed named "test" with a few events.
+func testServer(
+	t *testing.T,
+	dir string,
+	settings map[string]interface{}) *httptest.Server {
+
+	if settings == nil {
+		settings = make(map[string]interface{})
+	}
+	settings["data-path"] = filepath.Join(dir, "feeds")
+	settings["stage-path"] = filepath.Join(dir, "stage")
+	settings["static-path"] = filepath.Join(dir, "static")
+	content, err := json.Marshal(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := writeConfig(t, dir, string(content))
+	c, err := loadConfig([]string{"-config", path}, env(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler, err := setup(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	feed, err := os.Create(filepath.Join(c.dataPath, "test.dat"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer feed.Close()
+	events := []perspective.EventData{
+		{ID: 1, Start: 10, Run: 5},
+		{ID: 2, Start: 20, Run: 50, Status: 1},
+		{ID: 3, Start: 30, Run: 500, Status: -1}}
+	if err := binary.Write(feed, binary.LittleEndian, events); err != nil {
+		t.Fatal(err)
+	}
+
+	return httptest.NewServer(handler)
+}
+
+// Default parameter values from the configuration apply where a request gives
+// no value of its own.
+func TestServerDefaults(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	server := testServer(
+		t,
+		dir,
+		map[string]interface{}{
+			"defaults": map[string]interface{}{"width": 64, "height": 32}})
+	defer server.Close()
+
+	cases := []struct {
+		query string
+		w     int
+		h     int
+	}{
+		{"", 64, 32},
+		{"&height=48", 64, 48}}
+	for _, c := range cases {
+		response, err := http.Get(
+			server.URL + "/vis-histogram?feed=test&max-time=600" + c.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		image, err := png.Decode(response.Body)
+		response.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		size := image.Bounds().Size()
+		if size.X != c.w || size.Y != c.h {
+			t.Errorf("%s: rendered at %v", c.query, size)
+		}
+	}
+}
+
+// A default value given under a parameter's name gives way to a value given in
+// a request under its alias.
+func TestServerDefaultsAlias(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	server := testServer(
+		t,
+		dir,
+		map[string]interface{}{
+			"defaults": map[string]interface{}{"event-type": 1}})
+	defer server.Close()
+
+	response, err := http.Get(
+		server.URL + "/success-rate?feed=test&max-time=600&event-type-id=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	rate, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(rate) != "50.000%" {
+		t.Errorf("Success rate %q", rate)
+	}
+}
+
+func TestServerMissingFeed(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	server := testServer(t, dir, nil)
+	defer server.Close()
+
+	response, err := http.Get(server.URL + "/vis-histogram?feed=missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != 404 {
+		t.Errorf("Missing feed gave status %d", response.StatusCode)
+	}
+}
+
+// A report abandoned part way through should have written nothing, so that the
+// client can still be told the server is overloaded.
+func TestServerReportCancelled(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	server := testServer(t, dir, nil)
+	defer server.Close()
+
+	names, err := registry.Metadata("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, rejected := parseParams(
+		"event-data",
+		url.Values{"feed": {"test"}, "max-time": {"600"}},
+		names)
+	if len(rejected) > 0 {
+		t.Fatal(rejected[0])
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	out := httptest.NewRecorder()
+	err = writeReport(ctx, actions.Reports["event-data"], out, "test", p)
+	if err != context.Canceled {
+		t.Errorf("Cancelled report returned %v", err)
+	}
+	overloaded(out, httptest.NewRequest("GET", "/event-data?feed=test", nil))
+	if out.Code != 503 || out.Header().Get("Retry-After") == "" {
+		t.Errorf("Cancelled report answered with status %d", out.Code)
+	}
+	kind := out.Header().Get("Content-Type")
+	if !strings.HasPrefix(kind, "text/plain") {
+		t.Errorf("Cancelled report answered as %s", kind)
+	}
+}
+
+// Once every worker is busy and the queue is full, further renders should be
+// turned away at once, and told when to try again.
+func TestServerRenderQueueFull(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	server := testServer(
+		t,
+		dir,
+		map[string]interface{}{"render-workers": 1, "render-queue": 0})
+	defer server.Close()
+
+	get := func() *http.Response {
+		response, err := http.Get(
+			server.URL + "/vis-histogram?feed=test&max-time=600")
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		return response
+	}
+
+	if !renders.acquire(context.Background()) {
+		t.Fatal("Could not take the only worker")
+	}
+	response := get()
+	renders.release()
+	if response.StatusCode != 503 || response.Header.Get("Retry-After") == "" {
+		t.Errorf("Render with a full queue answered with status %d",
+			response.StatusCode)
+	}
+	if response := get(); response.StatusCode != 200 {
+		t.Errorf("Render with a free worker answered with status %d",
+			response.StatusCode)
+	}
+}
+
+// Each visualization in a batch should match the one rendered on its own with
+// the options of the batch request and its own overrides.
+func TestServerBatch(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	server := testServer(t, dir, nil)
+	defer server.Close()
+
+	get := func(query string) []byte {
+		response, err := http.Get(server.URL + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+		body, err := ioutil.ReadAll(response.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if response.StatusCode != 200 {
+			t.Fatalf("%s: status %d: %s", query, response.StatusCode, body)
+		}
+		return body
+	}
+
+	body := get("/vis-batch?feed=test&max-time=600&jitter=none" +
+		"&vis=" + url.QueryEscape("vis-histogram?status-filter=2") +
+		"&vis=vis-histogram")
+	archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"/vis-histogram?feed=test&max-time=600&jitter=none&status-filter=2",
+		"/vis-histogram?feed=test&max-time=600&jitter=none"}
+	if bytes.Equal(get(expected[0]), get(expected[1])) {
+		t.Fatal("Status filter override makes no difference to the test feed")
+	}
+	if len(archive.File) != len(expected) {
+		t.Fatalf("Batch of %d visualizations", len(archive.File))
+	}
+	for i, file := range archive.File {
+		r, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		batched, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(batched, get(expected[i])) {
+			t.Errorf("%s: rendered differently from %s", file.Name, expected[i])
+		}
+	}
+}
+
+func TestServerRejectParams(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	server := testServer(t, dir, nil)
+	defer server.Close()
+
+	cases := []struct {
+		query string
+		param string
+	}{
+		{"/vis-histogram?feed=test&width=x", "width"},
+		{"/vis-scatter?feed=test&run-time-scale=0.00001", "run-time-scale"},
+		{"/vis-scatter?feed=test&run-time-scale=NaN", "run-time-scale"}}
+	for _, c := range cases {
+		response, err := http.Get(server.URL + c.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var body struct {
+			Errors []*perspective.ParamError `json:"errors"`
+		}
+		err = json.NewDecoder(response.Body).Decode(&body)
+		response.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if response.StatusCode != 400 ||
+			len(body.Errors) != 1 || body.Errors[0].Name != c.param {
+			t.Errorf("%s: status %d, errors %v",
+				c.query, response.StatusCode, body.Errors)
+		}
+	}
+}
+
+// Feed names which could escape the data directory are rejected, for both
+// reads and uploads.
+func TestServerPathTraversal(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	server := testServer(t, dir, nil)
+	defer server.Close()
+
+	secret := filepath.Join(dir, "secret.dat")
+	if err := ioutil.WriteFile(secret, make([]byte, 48), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for _, feed := range []string{"../secret", "..%2Fsecret", "%2Ftmp%2Fx"} {
+		status, _ := get(t, server.URL+"/success-rate?feed="+feed, "")
+		if status != 400 {
+			t.Errorf("Read of feed %s gave status %d", feed, status)
+		}
+	}
+
+	for _, feed := range []string{"../secret", "..", ".hidden", "a%2Fb"} {
+		address := server.URL + "/post-data?feed=" + feed
+		status := upload(t, address, "", "feed.dat", make([]byte, 16))
+		if status != 400 {
+			t.Errorf("Upload to feed %s gave status %d", feed, status)
+		}
+	}
+
+	// Directories in the names of uploaded files are dropped by the client or
+	// (if not) by the multipart reader, so uploads of files with such names
+	// land in the data directory, if anywhere.
+	for _, name := range []string{"../secret.dat", "../../escape.dat"} {
+		upload(t, server.URL+"/post-data", "", name, make([]byte, 16))
+	}
+	if _, err := os.Stat(filepath.Join(dir, "escape.dat")); err == nil {
+		t.Error("Upload escaped the data directory.")
+	}
+	info, err := os.Stat(secret)
+	if err != nil || info.Size() != 48 {
+		t.Errorf("File outside data directory overwritten: %v", err)
+	}
+}
@@ -0,0 +1,240 @@
+// Perspective: Graphing library for quality control in event-driven systems
+
+// Copyright (C) 2016 Christian Paro <christian.paro@gmail.com>,
+//                                   <cparo@digitalocean.com>
+
+// This program is free software: you can redistribute it and/or modify it under
+// the terms of the GNU General Public License version 2 as published by the
+// Free Software Foundation.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+
+// You should have received a copy of the GNU General Public License along with
+// this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/cparo/perspective"
+	"github.com/cparo/perspective/feeds"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+// uploadSummary describes an accepted upload: the feed it was stored as, the
+// format it was uploaded in, and the events stored.
+type uploadSummary struct {
+	Feed     string `json:"feed"`
+	Uploaded string `json:"uploaded_format"`
+	*feeds.Summary
+}
+
+// malformedUpload is the error for an upload rejected for its content, rather
+// than for any failure on the part of the server.
+type malformedUpload struct {
+	reason string
+}
+
+func (err *malformedUpload) Error() string {
+	return err.reason
+}
+
+// Checks a staged upload for the named feed, converting it to a binary log
+// first if it is CSV (with event types and regions given by the given names or
+// by their codes), and returns the staged binary log to be committed along
+// with a summary of its events. Uploads which are malformed (or which can't be
+// checked) are discarded, with the reason returned.
+func prepareUpload(
+	request *http.Request,
+	name string,
+	names *feeds.Metadata,
+	staged *os.File) (*os.File, *uploadSummary, error) {
+
+	head := make([]byte, feeds.DetectFormatBytes)
+	n, _ := staged.ReadAt(head, 0)
+	format := feeds.DetectFormat(head[:n])
+	if format == feeds.FormatCSV {
+		converted, err := convertUpload(request, name, names, staged)
+		registry.Discard(staged)
+		if err != nil {
+			return nil, nil, err
+		}
+		staged = converted
+	}
+
+	summary, err := feeds.InspectBinLog(request.Context(), staged.Name())
+	if err == nil && summary.Records == 0 {
+		err = errors.New("no records")
+	}
+	if err != nil && err == request.Context().Err() {
+		registry.Discard(staged)
+		return nil, nil, err
+	}
+	if err != nil {
+		registry.Discard(staged)
+		return nil, nil, &malformedUpload{
+			fmt.Sprintf("malformed %v upload: %v", format, err)}
+	}
+	return staged, &uploadSummary{name, format.String(), summary}, nil
+}
+
+// Converts a staged CSV upload for the named feed into a new staged binary log,
+// with times read in the unit given in the "time-unit" parameter (in seconds by
+// default) and written to a high-resolution binary log if the "wide" parameter
+// is set, as by the csv-convert action of the command-line interface. Event
+// types and regions may be given by the given names, which gain new codes for
+// any new names if the "assign-codes" parameter is set. The CSV is laid out as
+// described by the schema uploaded as the "schema" file, if any. Error reasons
+// are classified by the server's error-reason filters.
+func convertUpload(
+	request *http.Request,
+	name string,
+	names *feeds.Metadata,
+	csv *os.File) (*os.File, error) {
+
+	unit := int64(1e9)
+	if value := request.FormValue("time-unit"); value != "" {
+		var err error
+		if unit, err = perspective.ParseTimeUnit(value); err != nil {
+			return nil, &malformedUpload{err.Error()}
+		}
+	}
+	wide, err := formBool(request, "wide")
+	if err != nil {
+		return nil, err
+	}
+	assign, err := formBool(request, "assign-codes")
+	if err != nil {
+		return nil, err
+	}
+	schema, err := uploadSchema(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = csv.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	converted, err := registry.Stage(name)
+	if err != nil {
+		return nil, err
+	}
+	w := bufio.NewWriter(converted)
+	_, err = feeds.ConvertCSV(
+		bufio.NewReader(csv),
+		w,
+		schema,
+		nil,
+		conf.errorFilters,
+		names,
+		assign,
+		unit,
+		wide)
+	if err != nil {
+		registry.Discard(converted)
+		return nil, &malformedUpload{"malformed csv upload: " + err.Error()}
+	}
+	if err = w.Flush(); err != nil {
+		registry.Discard(converted)
+		return nil, err
+	}
+	return converted, nil
+}
+
+// Returns the schema uploaded with a CSV feed as the "schema" file, or the
+// default schema if there is none.
+func uploadSchema(request *http.Request) (*feeds.CSVSchema, error) {
+	file, _, err := request.FormFile("schema")
+	if err == http.ErrMissingFile {
+		return feeds.DefaultCSVSchema(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	schema, err := feeds.ReadCSVSchema(file)
+	if err != nil {
+		return nil, &malformedUpload{err.Error()}
+	}
+	return schema, nil
+}
+
+// Parses the named boolean option of an upload, which is false if not given.
+func formBool(request *http.Request, name string) (bool, error) {
+	value := request.FormValue(name)
+	if value == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, &malformedUpload{
+			fmt.Sprintf("malformed %s option: \"%s\"", name, value)}
+	}
+	return b, nil
+}
+
+// Returns the metadata uploaded along with a feed as the "metadata" file, if
+// any, or otherwise the metadata already held for the named feed, reporting
+// whether it is to be kept for the feed: if it was uploaded, or if it may gain
+// new names (with the "assign-codes" option).
+func uploadMetadata(
+	request *http.Request,
+	name string) (*feeds.Metadata, bool, error) {
+
+	file, _, err := request.FormFile("metadata")
+	if err == http.ErrMissingFile {
+		names, err := registry.Metadata(name)
+		if err != nil {
+			return nil, false, err
+		}
+		assign, err := formBool(request, "assign-codes")
+		return names, assign, err
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	defer file.Close()
+	names, err := feeds.ReadMetadata(file)
+	if err != nil {
+		return nil, false, &malformedUpload{err.Error()}
+	}
+	return names, true, nil
+}
+
+// Responds to an upload which could not be accepted, with the reason as JSON
+// if it was rejected for its content (or for its size).
+func rejectUpload(out http.ResponseWriter, request *http.Request, err error) {
+
+	status := 500
+	var tooLarge *http.MaxBytesError
+	if _, ok := err.(*malformedUpload); ok || err == http.ErrMissingFile {
+		status = 400
+	} else if errors.As(err, &tooLarge) {
+		status = 413
+	}
+	if status == 500 {
+		http.Error(out, "File Upload Failed", status)
+		return
+	}
+
+	log.Printf("Rejected upload from %s: %v\n", request.RemoteAddr, err)
+	out.Header().Set("Content-Type", "application/json")
+	out.WriteHeader(status)
+	err = json.NewEncoder(out).Encode(struct {
+		Error string `json:"error"`
+	}{err.Error()})
+	if err != nil {
+		log.Println("Failed to write upload rejection.")
+		log.Println(err)
+	}
+}
@@ -0,0 +1,331 @@
+// Perspective: Graphing library for quality control in event-driven systems
+
+// Copyright (C) 2016 Christian Paro <christian.paro@gmail.com>,
+//                                   <cparo@digitalocean.com>
+
+// This program is free software: you can redistribute it and/or modify it under
+// the terms of the GNU General Public License version 2 as published by the
+// Free Software Foundation.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+
+// You should have received a copy of the GNU General Public License along with
+// this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/cparo/perspective/feeds"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Uploads a feed file as postFile does, returning the status of the response
+// and the upload summary or error it gives.
+func uploadJSON(
+	t *testing.T,
+	address string,
+	name string,
+	content string) (int, map[string]interface{}) {
+
+	response := postFile(t, address, "", name, []byte(content))
+	defer response.Body.Close()
+	var result map[string]interface{}
+	if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	return response.StatusCode, result
+}
+
+// CSV uploads are converted into binary logs, with a summary of the events
+// accepted in the response.
+func TestUploadCSV(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	server := testServer(t, dir, nil)
+	defer server.Close()
+
+	csv := "1,2,1470659696789,1500,0,3,100,\n" +
+		"2,1,1470659697001,250,1,3,50,timeout\n"
+	status, summary := uploadJSON(
+		t, server.URL+"/post-data?time-unit=ms", "jobs.csv", csv)
+	if status != 200 {
+		t.Fatalf("CSV upload rejected with status %d: %v", status, summary)
+	}
+	expected := map[string]interface{}{
+		"feed":            "jobs",
+		"uploaded_format": "csv",
+		"format":          "binlog64",
+		"records":         2.0,
+		"resolution":      1e6,
+		"min_start":       1470659696789e6,
+		"max_start":       1470659697001e6,
+		"types":           []interface{}{1.0, 2.0},
+		"regions":         []interface{}{3.0}}
+	for key, value := range expected {
+		if !jsonEqual(summary[key], value) {
+			t.Errorf("Summary %s: %v, expected %v", key, summary[key], value)
+		}
+	}
+
+	status, rate := get(t, server.URL+"/success-rate?feed=jobs", "")
+	if status != 200 || rate != "50.000%" {
+		t.Errorf("Converted feed gave status %d, %q", status, rate)
+	}
+}
+
+// Event types and regions of CSV uploads may be given by the names in metadata
+// uploaded along with them, which are then kept for the feed.
+func TestUploadCSVNamed(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	server := testServer(t, dir, nil)
+	defer server.Close()
+
+	metadata := `{"types": {"7": "snapshot"}, "regions": {"3": "nyc3"}}`
+	csv := "1,snapshot,1470659696,1,0,nyc3,100,\n" +
+		"2,snapshot,1470659697,1,1,3,50,timeout\n" +
+		"3,2,1470659698,1,1,1,50,timeout\n"
+	response := postFiles(
+		t,
+		server.URL+"/post-data",
+		"",
+		formFile{"file", "jobs.csv", []byte(csv)},
+		formFile{"metadata", "jobs.meta.json", []byte(metadata)})
+	response.Body.Close()
+	if response.StatusCode != 200 {
+		t.Fatalf("Named CSV upload rejected: status %d", response.StatusCode)
+	}
+
+	cases := []struct {
+		query string
+		rate  string
+	}{
+		{"region=nyc3", "50.000%"},
+		{"region-id=nyc3&event-type=snapshot", "50.000%"},
+		{"region=1", "0.000%"}}
+	for _, c := range cases {
+		address := server.URL + "/success-rate?feed=jobs&" + c.query
+		if status, rate := get(t, address, ""); rate != c.rate {
+			t.Errorf("%s: status %d, %q", c.query, status, rate)
+		}
+	}
+	address := server.URL + "/success-rate?feed=jobs&region=ams2"
+	if status, _ := get(t, address, ""); status != 400 {
+		t.Errorf("Unknown region name gave status %d", status)
+	}
+
+	_, body := get(t, server.URL+"/feed-info?feed=jobs", "")
+	var info map[string]interface{}
+	json.Unmarshal([]byte(body), &info)
+	names := map[string]interface{}{
+		"types":   map[string]string{"7": "snapshot"},
+		"regions": map[string]string{"3": "nyc3"}}
+	if !jsonEqual(info["names"], names) {
+		t.Errorf("Feed described with names %v", info["names"])
+	}
+
+	// Names with no metadata to give their codes are rejected.
+	response = postFile(
+		t, server.URL+"/post-data", "", "other.csv", []byte(csv))
+	response.Body.Close()
+	if response.StatusCode != 400 {
+		t.Errorf("Unnamed CSV upload gave status %d", response.StatusCode)
+	}
+}
+
+// With the assign-codes option, names in CSV uploads are given codes which are
+// kept with the feed, so later uploads give the same names the same codes.
+func TestUploadCSVAssignCodes(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	server := testServer(t, dir, nil)
+	defer server.Close()
+
+	address := server.URL + "/post-data?assign-codes=true"
+	uploads := []string{
+		"1,backup,1470659696,1,0,nyc3,100,\n",
+		"2,snapshot,1470659697,1,1,ams2,50,timeout\n" +
+			"3,backup,1470659698,1,0,nyc3,100,\n"}
+	for _, csv := range uploads {
+		status, result := uploadJSON(t, address, "jobs.csv", csv)
+		if status != 200 {
+			t.Fatalf("Upload rejected with status %d: %v", status, result)
+		}
+	}
+
+	names, err := registry.Metadata("jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &feeds.Metadata{
+		Types:   feeds.Names{0: "backup", 1: "snapshot"},
+		Regions: feeds.Names{0: "nyc3", 1: "ams2"}}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("Names kept for feed: %+v", names)
+	}
+	query := "/success-rate?feed=jobs&event-type=backup&region=nyc3"
+	if _, rate := get(t, server.URL+query, ""); rate != "100.000%" {
+		t.Errorf("Success rate for named codes: %q", rate)
+	}
+
+	status, _ := uploadJSON(
+		t, server.URL+"/post-data?assign-codes=maybe", "jobs.csv", uploads[0])
+	if status != 400 {
+		t.Errorf("Malformed assign-codes option gave status %d", status)
+	}
+}
+
+func TestUploadCSVSchema(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	server := testServer(t, dir, nil)
+	defer server.Close()
+
+	schema := `{"delimiter": ";", "header": true,
+		"columns": {"id": "job", "start": "started", "run": "secs",
+			"status": "exit"}}`
+	csv := "job;exit;started;secs\n" +
+		"1;0;2016-08-08T12:34:56Z;1\n" +
+		"2;1;2016-08-08T12:34:57Z;1\n"
+	response := postFiles(
+		t,
+		server.URL+"/post-data",
+		"",
+		formFile{"file", "jobs.csv", []byte(csv)},
+		formFile{"schema", "jobs.schema.json", []byte(schema)})
+	response.Body.Close()
+	if response.StatusCode != 200 {
+		t.Fatalf("CSV upload with schema rejected: %d", response.StatusCode)
+	}
+	if _, rate := get(t, server.URL+"/success-rate?feed=jobs", ""); rate !=
+		"50.000%" {
+		t.Errorf("Success rate for CSV upload with schema: %q", rate)
+	}
+
+	response = postFiles(
+		t,
+		server.URL+"/post-data",
+		"",
+		formFile{"file", "other.csv", []byte(csv)},
+		formFile{"schema", "other.schema.json", []byte(`{"header": 1}`)})
+	response.Body.Close()
+	if response.StatusCode != 400 {
+		t.Errorf("Malformed schema gave status %d", response.StatusCode)
+	}
+}
+
+// Reports whether two values decoded from JSON are the same.
+func jsonEqual(a interface{}, b interface{}) bool {
+	x, _ := json.Marshal(a)
+	y, _ := json.Marshal(b)
+	return bytes.Equal(x, y)
+}
+
+func TestUploadBinLog(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	server := testServer(t, dir, nil)
+	defer server.Close()
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, "feeds", "test.dat"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, summary := uploadJSON(
+		t, server.URL+"/post-data", "copy.dat", string(content))
+	if status != 200 || summary["uploaded_format"] != "binlog" ||
+		summary["records"] != 3.0 {
+		t.Errorf("Binary log upload gave status %d: %v", status, summary)
+	}
+}
+
+// Malformed uploads are rejected with the reason, and leave no feed behind.
+func TestUploadMalformed(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	server := testServer(
+		t, dir, map[string]interface{}{"max-upload-size": 4096})
+	defer server.Close()
+
+	cases := []struct {
+		query   string
+		content string
+		status  int
+		reason  string
+	}{
+		{"", "", 400, "no records"},
+		{"", string(make([]byte, 20)), 400, "16-byte records"},
+		{"", "1,2,3,4,0,3,100\n", 400, "record 1: 7 fields"},
+		{"", "1,2,3,4,0,3,100,\n1,x,3,4,0,3,100,\n", 400, "record 2"},
+		{"?time-unit=fortnights", "1,2,3,4,0,3,100,\n", 400, "time unit"},
+		{"?wide=maybe", "1,2,3,4,0,3,100,\n", 400, "wide"},
+		{"", strings.Repeat("1,2,3,4,0,3,100,\n", 1000), 413, "too large"}}
+	for _, c := range cases {
+		status, result := uploadJSON(
+			t, server.URL+"/post-data"+c.query, "bad.dat", c.content)
+		reason, _ := result["error"].(string)
+		if status != c.status || !strings.Contains(reason, c.reason) {
+			t.Errorf("%q%s: status %d, %v", c.content, c.query, status, result)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "feeds", "bad.dat")); err == nil {
+		t.Error("Malformed upload stored as a feed.")
+	}
+	staged, _ := ioutil.ReadDir(filepath.Join(dir, "stage"))
+	if len(staged) > 0 {
+		t.Errorf("Staged files left behind: %d", len(staged))
+	}
+}
+
+// Concurrent CSV uploads to a feed, each adding a name to its metadata, should
+// keep every name rather than each replacing the names the others added.
+func TestUploadCSVAssignCodesConcurrently(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	server := testServer(t, dir, nil)
+	defer server.Close()
+
+	address := server.URL + "/post-data?assign-codes=true"
+	statuses := make([]int, 8)
+	var wg sync.WaitGroup
+	for i := range statuses {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			csv := fmt.Sprintf("%d,type-%d,1470659696,1,0,nyc3,100,\n", i, i)
+			statuses[i] = upload(t, address, "", "jobs.csv", []byte(csv))
+		}(i)
+	}
+	wg.Wait()
+	for i, status := range statuses {
+		if status != 200 {
+			t.Errorf("Upload %d rejected with status %d", i, status)
+		}
+	}
+
+	names, err := registry.Metadata("jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names.Types) != len(statuses) {
+		t.Errorf("Type names kept for feed: %v", names.Types)
+	}
+	for i := range statuses {
+		if _, exists := names.Types.Code(fmt.Sprintf("type-%d", i)); !exists {
+			t.Errorf("Name for upload %d lost", i)
+		}
+	}
+}
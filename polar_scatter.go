@@ -20,25 +20,48 @@ package perspective
 import (
 	"image"
 	"math"
-	"math/rand"
 )
 
 // Note that floating-point pre-rendering canvases have a two-pixel bleed on all
 // edges to allow for simple use of the bloom effect's convolution kernel.
 type polarScatter struct {
-	w     int       // Width of the visualization
-	h     int       // Height of the visualization
-	s     []float64 // Channel for successful events
-	f     []float64 // Channel for failed events
-	a     []float64 // Channel for active events
-	tA    float64   // Lower limit of time range to be visualized
-	tτ    float64   // Length of time range to be visualized
-	p0    float64   // Temporal period phase offset value
-	pτ    float64   // The periodic interval length
-	yLog2 float64   // Number of pixels over which elapsed times double
-	cΔ    float64   // Increment for color channel value increases
-	bg    int       // Background gray level
-	ϕΔ    float64   // Angular value, in radians, of a step in time
+	w       int         // Width of the visualization
+	h       int         // Height of the visualization
+	s       []float64   // Channel for successful events
+	f       []float64   // Channel for failed events
+	a       []float64   // Channel for active events
+	tA      int64       // Lower limit of time range to be visualized
+	tτ      float64     // Length of time range to be visualized
+	p0      int64       // Temporal period phase offset value
+	pτ      int64       // The periodic interval length
+	axis    RunTimeAxis // Mapping of run times to distances from center
+	clips   axisClips   // Counts of events clipped at run-time axis bounds
+	cΔ      float64     // Increment for color channel value increases
+	bg      int         // Background gray level
+	ϕΔ      float64     // Angular value, in radians, of a step in time
+	jitter  Jitter      // Mode for noise applied to run times
+	quantum float64     // Resolution of recorded run times, in seconds
+}
+
+func init() {
+	RegisterVisualizer(&VisualizerSpec{
+		"vis-polar-scatter",
+		"Scatter plot of event run times around the phase of their start " +
+			"times within a period.",
+		timeRangeParams(
+			withAxis(
+				PeriodStartParam,
+				PeriodLengthParam,
+				ColorStepsParam,
+				JitterParam)...),
+		allChecks(CheckTimeRange, checkAxis, checkArea(maxFloatArea)),
+		func(p Params) Visualizer {
+			return NewPolarScatter(
+				p.Int("width"), p.Int("height"), p.Int("bg"),
+				p.Time("min-time"), p.Time("max-time"),
+				p.Time("period-start"), p.Time("period-length"),
+				p.runTimeAxis(), p.Float("color-steps"), p.jitter())
+		}})
 }
 
 // NewPolarScatter returns a polar floating-point scatter-visualization
@@ -47,12 +70,13 @@ func NewPolarScatter(
 	width int,
 	height int,
 	bg int,
-	minTime int,
-	maxTime int,
-	phasePoint int,
-	period int,
-	yLog2 float64,
-	colorSteps float64) Visualizer {
+	minTime int64,
+	maxTime int64,
+	phasePoint int64,
+	period int64,
+	axis RunTimeAxis,
+	colorSteps float64,
+	jitter Jitter) Visualizer {
 
 	// Ensure we have a positive, non-zero period length. If we don't (for
 	// instance, if none was specified by the end user and we were given a
@@ -74,31 +98,41 @@ func NewPolarScatter(
 		make([]float64, (width+4)*(height+4)),
 		make([]float64, (width+4)*(height+4)),
 		make([]float64, (width+4)*(height+4)),
-		float64(minTime),
+		minTime,
 		float64(maxTime - minTime),
-		float64(phasePoint%period - period),
-		float64(period),
-		float64(yLog2),
+		phasePoint%period - period,
+		period,
+		axis.fitted(int(math.Min(float64(width), float64(height)) / 2)),
+		axisClips{},
 		saturated / colorSteps,
 		bg,
-		2 * math.Pi / float64(period)})
+		2 * math.Pi / float64(period),
+		jitter,
+		1})
 }
 
-// Record accepts an EventData pointer and plots it onto the visualization.
-func (v *polarScatter) Record(e *EventData) {
+// Record accepts an EventData64 pointer and plots it onto the visualization.
+func (v *polarScatter) Record(e *EventData64) {
 
 	// Angular position (for event start time).
-	ϕ := math.Pi / 2 - v.ϕΔ * math.Mod(float64(e.Start) - v.p0, v.pτ)
-
-	// Apply a bit of random "noise" (on a Gaussian distribution, with a
-	// standard deviation of 0.5), to the time scale to avoid Moire patterns
-	// and quantization artifacts which could distract from real patterns or
-	// create a false sense of consistency in the run times of short-lived
-	// events./
-	t := float64(e.Run) + rand.NormFloat64() / 2
-
-	// Distance from center of visualization (for event run time).
-	r := v.yLog2 * math.Log2(t)
+	ϕ := math.Pi / 2 - v.ϕΔ * float64((e.Start - v.p0) % v.pτ)
+
+	// Apply a bit of "noise" (on a Gaussian distribution, with a standard
+	// deviation of half the resolution at which run times were measured), to
+	// the time scale to avoid Moire patterns and quantization artifacts which
+	// could distract from real patterns or create a false sense of consistency
+	// in the run times of short-lived events.
+	t := seconds(e.Run) + v.jitter.offset(e)*v.quantum
+
+	// Distance from center of visualization (for event run time). Run times
+	// below the origin of an axis with no minimum set are plotted at negative
+	// distances, across the center, as they originally were, unless they are
+	// not positive and so have no distance to plot at all.
+	r, clip := v.axis.offset(t)
+	if math.IsInf(r, -1) {
+		return
+	}
+	v.clips.count(clip)
 
 	w, h := v.w, v.h
 
@@ -134,6 +168,31 @@ func (v *polarScatter) Record(e *EventData) {
 	}
 }
 
+// Shard returns an empty polar scatter-visualization generator with the same
+// configuration, for recording a share of the events in parallel.
+func (v *polarScatter) Shard() ShardedVisualizer {
+	shard := *v
+	shard.s = make([]float64, len(v.s))
+	shard.f = make([]float64, len(v.f))
+	shard.a = make([]float64, len(v.a))
+	return &shard
+}
+
+// Merge folds the channels of a shard back into the visualization.
+func (v *polarScatter) Merge(shard ShardedVisualizer) {
+	o := shard.(*polarScatter)
+	mergeFloat64s(v.s, o.s)
+	mergeFloat64s(v.f, o.f)
+	mergeFloat64s(v.a, o.a)
+	v.clips.merge(&o.clips)
+}
+
+// SetResolution sets the resolution, in seconds, at which the run times of the
+// events to be recorded were measured, to scale the noise applied to them.
+func (v *polarScatter) SetResolution(quantum float64) {
+	v.quantum = quantum
+}
+
 // Render returns the visualization constructed from all previously-recorded
 // data points.
 func (v *polarScatter) Render() image.Image {
@@ -146,8 +205,10 @@ func (v *polarScatter) Render() image.Image {
 	drawXGridLine(vis, v.w/2)
 	drawYGridLine(vis, v.h/2)
 
-	// Draw radial increments for time-period doublings.
-	for r := v.yLog2; int(r) < h || int(r) < w; r += v.yLog2 {
+	// Draw radial increments for each step along the run-time axis.
+	step := v.axis.gridStep()
+	extent := math.Max(float64(w), float64(h))
+	for r := step; r < extent && step >= minGridStep; r += step {
 		// This could be exchanged for drawPolarGridCircle(vis, r) if actual
 		// radial rings are desired for the grid rendering. Subjectively putting
 		// the two side-by-side, the crosshair ticks are less distracting and
@@ -155,6 +216,16 @@ func (v *polarScatter) Render() image.Image {
 		drawPolarGridRadialTicks(vis, r)
 	}
 
+	// Mark any bounds at which events were clipped, with a small ring around
+	// the center for those pinned at the minimum run time.
+	if v.clips.lo > 0 {
+		drawPolarClipCircle(vis, 3)
+	}
+	if v.clips.hi > 0 {
+		r, _ := v.axis.offset(v.axis.Max)
+		drawPolarClipCircle(vis, r)
+	}
+
 	// Render point data to final image.
 	s, f, a := v.s, v.f, v.a
 	for y := 0; y < h; y++ {
@@ -0,0 +1,195 @@
+// Perspective: Graphing library for quality control in event-driven systems
+
+// Copyright (C) 2016 Christian Paro <christian.paro@gmail.com>,
+//                                   <cparo@digitalocean.com>
+
+// This program is free software: you can redistribute it and/or modify it under
+// the terms of the GNU General Public License version 2 as published by the
+// Free Software Foundation.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+
+// You should have received a copy of the GNU General Public License along with
+// this program. If not, see <http://www.gnu.org/licenses/>.
+
+package perspective
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// ProgressRate returns the rate at which an in-progress event has progressed,
+// in percentage points per hour of its run time so far, or +Inf for an event
+// which has no run time yet (and so can't be judged to be progressing slowly).
+func ProgressRate(e *EventData64) float64 {
+	if e.Run <= 0 {
+		return math.Inf(1)
+	}
+	return float64(e.Progress) * 3600 / seconds(e.Run)
+}
+
+// Note that floating-point pre-rendering canvases have a two-pixel bleed on all
+// edges to allow for simple use of the bloom effect's convolution kernel.
+type progressStall struct {
+	w       int         // Width of the visualization
+	h       int         // Height of the visualization
+	bg      int         // Background gray level
+	axis    RunTimeAxis // Mapping of run times to the x-axis
+	clips   axisClips   // Counts of events clipped at run-time axis bounds
+	minRate float64     // Progress rate below which events are stalled
+	p       []float64   // Channel for progressing events
+	s       []float64   // Channel for stalled events
+	cΔ      float64     // Increment for color channel value increases
+}
+
+func init() {
+	RegisterVisualizer(&VisualizerSpec{
+		"vis-progress-stall",
+		"Scatter plot of the progress of in-progress events against their " +
+			"run times, marking those progressing too slowly.",
+		sizeParams(withAxis(MinProgressRateParam, ColorStepsParam)...),
+		allChecks(checkAxis, checkArea(maxFloatArea)),
+		func(p Params) Visualizer {
+			return NewProgressStall(
+				p.Int("width"), p.Int("height"), p.Int("bg"),
+				p.runTimeAxis(), p.Float("min-progress-rate"),
+				p.Float("color-steps"))
+		}})
+}
+
+// NewProgressStall returns a progress-stall-visualization generator, which
+// plots in-progress events by their run time so far (along the x-axis) against
+// their progress percentage (along the y-axis), highlighting those progressing
+// at less than the given rate (in percentage points per hour) as stalled. The
+// threshold between progressing and stalled events is drawn as a curve, so
+// stalled events are those below and to the right of it. Completed events are
+// ignored.
+func NewProgressStall(
+	width int,
+	height int,
+	bg int,
+	axis RunTimeAxis,
+	minRate float64,
+	colorSteps float64) Visualizer {
+
+	return &progressStall{
+		width,
+		height,
+		bg,
+		axis.fitted(width),
+		axisClips{},
+		minRate,
+		make([]float64, (width+4)*(height+4)),
+		make([]float64, (width+4)*(height+4)),
+		saturated / colorSteps}
+}
+
+// Record accepts an EventData64 pointer and plots it onto the visualization.
+func (v *progressStall) Record(e *EventData64) {
+
+	if e.Status >= 0 {
+		return
+	}
+
+	w, h := v.w, v.h
+
+	// Events clipped at the upper bound of the run-time axis are pinned to the
+	// last column, and those below the origin of an axis with no minimum set to
+	// the first.
+	xOffset, clip := v.axis.flooredOffset(seconds(e.Run))
+	xP := int(math.Min(float64(w-1), xOffset))
+	v.clips.count(clip)
+	progress := math.Min(100, float64(e.Progress))
+	yP := int(float64(h-1) * (1 - progress/100))
+
+	frame := v.p
+	if ProgressRate(e) < v.minRate {
+		frame = v.s
+	}
+
+	// The convolution kernel is centered on the plot point, which with the
+	// bleed on the floating-point canvas puts its corner at the same
+	// coordinates on the canvas as the plot point has on the image.
+	if xP >= 0 && xP < w && yP >= 0 && yP < h {
+		iK := 0
+		for y := yP; y < yP+5; y++ {
+			for x := xP; x < xP+5; x++ {
+				frame[y*(w+4)+x] += pointConvolutionKernel[iK]
+				iK++
+			}
+		}
+	}
+}
+
+// Shard returns an empty progress-stall-visualization generator with the same
+// configuration, for recording a share of the events in parallel.
+func (v *progressStall) Shard() ShardedVisualizer {
+	shard := *v
+	shard.p = make([]float64, len(v.p))
+	shard.s = make([]float64, len(v.s))
+	return &shard
+}
+
+// Merge folds the channels of a shard back into the visualization.
+func (v *progressStall) Merge(shard ShardedVisualizer) {
+	o := shard.(*progressStall)
+	mergeFloat64s(v.p, o.p)
+	mergeFloat64s(v.s, o.s)
+	v.clips.merge(&o.clips)
+}
+
+// Render returns the visualization constructed from all previously-recorded
+// data points.
+func (v *progressStall) Render() image.Image {
+
+	w, h, cΔ := v.w, v.h, v.cΔ
+	vis := initializeVisualization(w, h, v.bg)
+
+	// Draw vertical grid lines on each step along the run-time axis, and
+	// horizontal grid lines at each quarter of progress.
+	step := v.axis.gridStep()
+	for x := step; x < float64(w) && step >= minGridStep; x += step {
+		drawXGridLine(vis, int(x))
+	}
+	for i := 1; i < 4; i++ {
+		drawYGridLine(vis, i*(h-1)/4)
+	}
+	if v.clips.lo > 0 {
+		drawXClipLine(vis, 0)
+	}
+	if v.clips.hi > 0 {
+		drawXClipLine(vis, w-1)
+	}
+
+	// Draw the threshold curve for stalled events, of progress at the minimum
+	// rate for the run time at each x-position.
+	threshold := color.RGBA{grid * 2, grid * 2, grid * 2, opaque}
+	for x := 0; x < w; x++ {
+		progress := v.minRate * v.axis.at(float64(x)) / 3600
+		if progress <= 100 {
+			vis.Set(x, int(float64(h-1)*(1-progress/100)), threshold)
+		}
+	}
+
+	// Render point data to final image, with progressing events in green and
+	// stalled events in red.
+	p, s := v.p, v.s
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			i := (y+2)*(w+4) + x + 2
+			if p[i] > 0 || s[i] > 0 {
+				c := getRGBA(vis, x, y)
+				c.R = uint8(math.Min(saturated, float64(c.R)+(p[i]/4+s[i])*cΔ))
+				c.G = uint8(math.Min(saturated, float64(c.G)+(p[i]+s[i]/4)*cΔ))
+				c.B = uint8(math.Min(saturated, float64(c.B)+(p[i]/4)*cΔ))
+			}
+		}
+	}
+
+	return vis
+}
@@ -0,0 +1,139 @@
+// Perspective: Graphing library for quality control in event-driven systems
+
+// Copyright (C) 2016 Christian Paro <christian.paro@gmail.com>,
+//                                   <cparo@digitalocean.com>
+
+// This program is free software: you can redistribute it and/or modify it under
+// the terms of the GNU General Public License version 2 as published by the
+// Free Software Foundation.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+
+// You should have received a copy of the GNU General Public License along with
+// this program. If not, see <http://www.gnu.org/licenses/>.
+
+package perspective
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+)
+
+// Width, in pixels, of the strip reserved for a color-scale legend, including
+// the gap between the legend and the plot area.
+const legendWidth = 12
+
+// Control points of the color ramp used to map normalized values to colors,
+// sampled at even intervals from the viridis color map, which is perceptually
+// uniform (so equal steps in value read as equal steps in color), legible to
+// readers with the common forms of color blindness, and legible in grayscale.
+var rampStops = []color.RGBA{
+	{68, 1, 84, opaque},
+	{72, 40, 120, opaque},
+	{62, 74, 137, opaque},
+	{49, 104, 142, opaque},
+	{38, 130, 142, opaque},
+	{31, 158, 137, opaque},
+	{53, 183, 121, opaque},
+	{109, 205, 89, opaque},
+	{180, 222, 44, opaque},
+	{253, 231, 37, opaque},
+}
+
+// CountScale selects how counts are scaled before being mapped onto the color
+// ramp.
+type CountScale int
+
+const (
+	// CountLinear maps counts onto the color ramp in proportion to the
+	// largest count.
+	CountLinear CountScale = iota
+	// CountLog maps the logarithms of counts onto the color ramp, which keeps
+	// sparse areas distinguishable when a few areas are much denser than the
+	// rest.
+	CountLog
+)
+
+var countScaleNames = map[CountScale]string{
+	CountLinear: "linear",
+	CountLog:    "log",
+}
+
+// ParseCountScale returns the count scale with the given name ("linear" or
+// "log").
+func ParseCountScale(name string) (CountScale, error) {
+	for s, n := range countScaleNames {
+		if n == name {
+			return s, nil
+		}
+	}
+	return CountLinear, fmt.Errorf("unrecognized count scale: \"%s\"", name)
+}
+
+func (s CountScale) String() string {
+	return countScaleNames[s]
+}
+
+// Returns the position along the color ramp, from 0 to 1, for the given count
+// relative to the largest count.
+func (s CountScale) fraction(count int, max int) float64 {
+	if max <= 0 {
+		return 0
+	}
+	if s == CountLog {
+		return math.Log1p(float64(count)) / math.Log1p(float64(max))
+	}
+	return float64(count) / float64(max)
+}
+
+// Returns the color at the given position, from 0 to 1, along the color ramp.
+func rampColor(f float64) color.RGBA {
+	f = math.Max(0, math.Min(1, f)) * float64(len(rampStops)-1)
+	i := int(f)
+	if i >= len(rampStops)-1 {
+		return rampStops[len(rampStops)-1]
+	}
+	a, b, r := rampStops[i], rampStops[i+1], f-float64(i)
+	return color.RGBA{
+		uint8(float64(a.R) + (float64(b.R)-float64(a.R))*r),
+		uint8(float64(a.G) + (float64(b.G)-float64(a.G))*r),
+		uint8(float64(a.B) + (float64(b.B)-float64(a.B))*r),
+		opaque}
+}
+
+// Returns the positions along the color ramp of each power of ten up to the
+// given largest count, for marking the scale of counts on a legend.
+func (s CountScale) ticks(max int) []float64 {
+	var ticks []float64
+	for count := 1; count <= max; count *= 10 {
+		ticks = append(ticks, s.fraction(count, max))
+	}
+	return ticks
+}
+
+// Utility function to draw a color-scale legend along the right edge of a
+// visualization, as a vertical color ramp running from 0 at the bottom to 1 at
+// the top. As there are no figures on the visualizations, the scale is
+// indicated by tick marks on the left side of the ramp at the given positions
+// along it.
+func drawRampLegend(vis *image.RGBA, ticks []float64) {
+	w, h := vis.Bounds().Max.X, vis.Bounds().Max.Y
+	x0 := w - legendWidth + 4
+	for y := 0; y < h; y++ {
+		c := rampColor(float64(h-1-y) / math.Max(float64(h-1), 1))
+		for x := x0 + 2; x < w; x++ {
+			vis.Set(x, y, c)
+		}
+	}
+	gridColor := color.RGBA{grid, grid, grid, opaque}
+	for _, f := range ticks {
+		y := h - 1 - int(f*float64(h-1))
+		vis.Set(x0, y, gridColor)
+		vis.Set(x0+1, y, gridColor)
+	}
+}
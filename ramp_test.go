@@ -0,0 +1,64 @@
+// Perspective: Graphing library for quality control in event-driven systems
+
+// Copyright (C) 2016 Christian Paro <christian.paro@gmail.com>,
+//                                   <cparo@digitalocean.com>
+
+// This program is free software: you can redistribute it and/or modify it under
+// the terms of the GNU General Public License version 2 as published by the
+// Free Software Foundation.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+
+// You should have received a copy of the GNU General Public License along with
+// this program. If not, see <http://www.gnu.org/licenses/>.
+
+package perspective
+
+import "testing"
+
+func TestParseCountScale(t *testing.T) {
+	for s, name := range countScaleNames {
+		parsed, err := ParseCountScale(name)
+		if err != nil || parsed != s {
+			t.Errorf("ParseCountScale(%q) = %v, %v", name, parsed, err)
+		}
+	}
+	if _, err := ParseCountScale("sqrt"); err == nil {
+		t.Error("ParseCountScale(\"sqrt\") should have failed")
+	}
+}
+
+func TestRampColor(t *testing.T) {
+	if rampColor(-1) != rampStops[0] || rampColor(0) != rampStops[0] {
+		t.Error("Ramp does not start at its first stop.")
+	}
+	if rampColor(1) != rampStops[len(rampStops)-1] ||
+		rampColor(2) != rampStops[len(rampStops)-1] {
+		t.Error("Ramp does not end at its last stop.")
+	}
+	// Viridis gets steadily lighter, which should hold between stops too.
+	last := -1
+	for i := 0; i <= 100; i++ {
+		c := rampColor(float64(i) / 100)
+		luma := int(c.R)*299 + int(c.G)*587 + int(c.B)*114
+		if luma < last {
+			t.Fatalf("Ramp gets darker at %d%%", i)
+		}
+		last = luma
+	}
+}
+
+func TestCountScaleFraction(t *testing.T) {
+	if f := CountLinear.fraction(25, 100); f != 0.25 {
+		t.Errorf("Linear fraction of 25/100 was %f", f)
+	}
+	if f := CountLog.fraction(9, 99); f != 0.5 {
+		t.Errorf("Log fraction of 9/99 was %f", f)
+	}
+	if f := CountLog.fraction(0, 0); f != 0 {
+		t.Errorf("Fraction with no counts was %f", f)
+	}
+}
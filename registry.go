@@ -0,0 +1,303 @@
+// Perspective: Graphing library for quality control in event-driven systems
+
+// Copyright (C) 2016 Christian Paro <christian.paro@gmail.com>,
+//                                   <cparo@digitalocean.com>
+
+// This program is free software: you can redistribute it and/or modify it under
+// the terms of the GNU General Public License version 2 as published by the
+// Free Software Foundation.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+
+// You should have received a copy of the GNU General Public License along with
+// this program. If not, see <http://www.gnu.org/licenses/>.
+
+package perspective
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParamType is the type of value taken by a visualizer parameter.
+type ParamType int
+
+const (
+	// IntParam takes an integer, held as an int.
+	IntParam ParamType = iota
+	// FloatParam takes a floating-point number, held as a float64.
+	FloatParam
+	// BoolParam takes a boolean value, held as a bool.
+	BoolParam
+	// TimeParam takes a point in time in any form accepted by ParseTime, held
+	// as an int64 count of nanoseconds since the beginning of the Unix epoch.
+	TimeParam
+	// DurationParam takes a length of time in any form accepted by
+	// ParseDuration, held as an int64 count of nanoseconds.
+	DurationParam
+	// ChoiceParam takes one of a list of names, held as a string.
+	ChoiceParam
+	// LocationParam takes the name of a time zone, held as a *time.Location.
+	LocationParam
+)
+
+var paramTypeNames = map[ParamType]string{
+	IntParam:      "int",
+	FloatParam:    "float",
+	BoolParam:     "bool",
+	TimeParam:     "time",
+	DurationParam: "duration",
+	ChoiceParam:   "choice",
+	LocationParam: "time zone",
+}
+
+func (t ParamType) String() string {
+	return paramTypeNames[t]
+}
+
+// Param declares a parameter taken by a visualizer (or another action on event
+// data), given as a command-line flag or a query parameter of the same name.
+type Param struct {
+	Name    string                  // Name of the parameter
+	Alias   string                  // Alternative name, kept for compatibility
+	Type    ParamType               // Type of value taken by the parameter
+	Default string                  // Value taken when none is given, if any
+	Choices []string                // Values accepted by a choice parameter
+	Check   func(interface{}) error // Validation of parsed values, if any
+	Usage   string                  // Description of the parameter, for help
+}
+
+// Params holds the parsed values of parameters, by name. Parameters which were
+// not given and have no default value are left out.
+type Params map[string]interface{}
+
+// Bool returns the value of the named boolean parameter.
+func (p Params) Bool(name string) bool {
+	return p[name].(bool)
+}
+
+// Float returns the value of the named floating-point parameter.
+func (p Params) Float(name string) float64 {
+	return p[name].(float64)
+}
+
+// Int returns the value of the named integer parameter.
+func (p Params) Int(name string) int {
+	return p[name].(int)
+}
+
+// Location returns the value of the named time-zone parameter.
+func (p Params) Location(name string) *time.Location {
+	return p[name].(*time.Location)
+}
+
+// String returns the value of the named choice parameter.
+func (p Params) String(name string) string {
+	return p[name].(string)
+}
+
+// Time returns the value, in nanoseconds, of the named time or duration
+// parameter.
+func (p Params) Time(name string) int64 {
+	return p[name].(int64)
+}
+
+// ParamError describes a value rejected for a parameter.
+type ParamError struct {
+	Name   string `json:"parameter"` // Name of the parameter
+	Value  string `json:"value"`     // Value given for the parameter
+	Reason string `json:"reason"`    // Reason the value was rejected
+}
+
+func (e *ParamError) Error() string {
+	return fmt.Sprintf("invalid %s: \"%s\" (%s)", e.Name, e.Value, e.Reason)
+}
+
+// ParseParams parses values for the given parameters, as returned by the lookup
+// function for each parameter's name (or alias), which returns an empty string
+// for those not given. Each rejected value is passed to the malformed function
+// and the parameter's default value is taken instead.
+func ParseParams(
+	params []Param,
+	lookup func(name string) string,
+	malformed func(err *ParamError)) Params {
+
+	now := time.Now().UnixNano()
+	p := make(Params)
+	for i := range params {
+		param := &params[i]
+		value := lookup(param.Name)
+		if value == "" && param.Alias != "" {
+			value = lookup(param.Alias)
+		}
+		if value == "" {
+			value = param.Default
+		}
+		if value == "" {
+			continue
+		}
+		parsed, err := param.parse(value, now)
+		if err != nil {
+			malformed(&ParamError{param.Name, value, err.Error()})
+			if param.Default == "" {
+				continue
+			}
+			parsed, _ = param.parse(param.Default, now)
+		}
+		p[param.Name] = parsed
+	}
+	return p
+}
+
+// Parses and validates the given value for the parameter, with relative times
+// taken as offsets from the given current time.
+func (param *Param) parse(value string, now int64) (interface{}, error) {
+	var parsed interface{}
+	var err error
+	switch param.Type {
+	case IntParam:
+		parsed, err = strconv.Atoi(value)
+		if err != nil {
+			err = fmt.Errorf("not an integer")
+		}
+	case FloatParam:
+		var f float64
+		f, err = strconv.ParseFloat(value, 64)
+		if err != nil {
+			err = fmt.Errorf("not a number")
+		} else if math.IsNaN(f) || math.IsInf(f, 0) {
+			err = fmt.Errorf("not a finite number")
+		}
+		parsed = f
+	case BoolParam:
+		parsed, err = strconv.ParseBool(value)
+		if err != nil {
+			err = fmt.Errorf("not true or false")
+		}
+	case TimeParam:
+		parsed, err = ParseTime(value, now)
+	case DurationParam:
+		parsed, err = ParseDuration(value)
+	case ChoiceParam:
+		parsed = value
+		err = fmt.Errorf("not one of %s", strings.Join(param.Choices, ", "))
+		for _, choice := range param.Choices {
+			if value == choice {
+				err = nil
+			}
+		}
+	case LocationParam:
+		parsed, err = time.LoadLocation(value)
+		if err != nil {
+			err = fmt.Errorf("unknown time zone")
+		}
+	}
+	if err == nil && param.Check != nil {
+		err = param.Check(parsed)
+	}
+	return parsed, err
+}
+
+// Returns a check that numeric parameter values are no less than min.
+func atLeast(min float64) func(interface{}) error {
+	return func(value interface{}) error {
+		if !(number(value) >= min) {
+			return fmt.Errorf("must be at least %g", min)
+		}
+		return nil
+	}
+}
+
+// Returns a check that numeric parameter values lie within [min, max].
+func between(min float64, max float64) func(interface{}) error {
+	return func(value interface{}) error {
+		if n := number(value); !(n >= min && n <= max) {
+			return fmt.Errorf("must be from %g to %g", min, max)
+		}
+		return nil
+	}
+}
+
+// Checks that a numeric parameter value is greater than zero.
+func positive(value interface{}) error {
+	if !(number(value) > 0) {
+		return fmt.Errorf("must be positive")
+	}
+	return nil
+}
+
+// Returns the given numeric parameter value as a float64.
+func number(value interface{}) float64 {
+	switch n := value.(type) {
+	case int:
+		return float64(n)
+	case int64:
+		return float64(n)
+	case float64:
+		return n
+	}
+	return math.NaN()
+}
+
+// ParamCheck validates the values of parameters against each other, returning
+// an error for the parameter whose value is rejected, if any.
+type ParamCheck func(Params) *ParamError
+
+// Returns a check which applies each of the given checks in turn, returning
+// the first error found.
+func allChecks(checks ...ParamCheck) ParamCheck {
+	return func(p Params) *ParamError {
+		for _, check := range checks {
+			if err := check(p); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// VisualizerSpec declares a visualizer: the name of the action which renders
+// it, the parameters it takes, and how to construct it from their values.
+type VisualizerSpec struct {
+	Name   string                  // Action name, like "vis-scatter"
+	Usage  string                  // Description of the visualizer, for help
+	Params []Param                 // Parameters taken by the visualizer
+	Check  ParamCheck              // Validation across parameters, if any
+	New    func(Params) Visualizer // Constructor for a visualizer generator
+}
+
+// Registry of visualizers, by action name:
+var visualizerSpecs = make(map[string]*VisualizerSpec)
+
+// RegisterVisualizer adds the given visualizer to the registry, making it
+// available to front ends under its action name.
+func RegisterVisualizer(spec *VisualizerSpec) {
+	if _, exists := visualizerSpecs[spec.Name]; exists {
+		panic(fmt.Sprintf("visualizer registered twice: \"%s\"", spec.Name))
+	}
+	visualizerSpecs[spec.Name] = spec
+}
+
+// LookupVisualizer returns the registered visualizer with the given action
+// name, or nil if there is none.
+func LookupVisualizer(name string) *VisualizerSpec {
+	return visualizerSpecs[name]
+}
+
+// VisualizerNames returns the action names of all registered visualizers, in
+// sorted order.
+func VisualizerNames() []string {
+	names := make([]string, 0, len(visualizerSpecs))
+	for name := range visualizerSpecs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,145 @@
+// Perspective: Graphing library for quality control in event-driven systems
+
+// Copyright (C) 2016 Christian Paro <christian.paro@gmail.com>,
+//                                   <cparo@digitalocean.com>
+
+// This program is free software: you can redistribute it and/or modify it under
+// the terms of the GNU General Public License version 2 as published by the
+// Free Software Foundation.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+
+// You should have received a copy of the GNU General Public License along with
+// this program. If not, see <http://www.gnu.org/licenses/>.
+
+package perspective
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestParseParams(t *testing.T) {
+	params := []Param{
+		WidthParam,
+		BGParam,
+		MaxTimeParam,
+		PeriodLengthParam,
+		JitterParam,
+		LegendParam,
+		{"count", "n", IntParam, "", nil, nil, "A count."}}
+	var rejected []string
+	p := ParseParams(
+		params,
+		func(name string) string {
+			return map[string]string{
+				"width":         "wide",
+				"bg":            "300",
+				"period-length": "1day",
+				"jitter":        "seeded",
+				"legend":        "true",
+				"n":             "7"}[name]
+		},
+		func(err *ParamError) {
+			rejected = append(rejected, err.Name)
+		})
+	if len(rejected) != 2 || rejected[0] != "width" || rejected[1] != "bg" {
+		t.Errorf("Rejected %v, expected [width bg]", rejected)
+	}
+	if p.Int("width") != 256 || p.Int("bg") != 32 {
+		t.Errorf("Rejected values not replaced by defaults: %v", p)
+	}
+	if p.Time("max-time") < time.Now().UnixNano()-int64(time.Minute) {
+		t.Errorf("Got max-time %d, expected now", p.Time("max-time"))
+	}
+	if p.Time("period-length") != 86400*int64(time.Second) {
+		t.Errorf("Got period-length %d", p.Time("period-length"))
+	}
+	if p.jitter() != JitterSeeded || !p.Bool("legend") || p.Int("count") != 7 {
+		t.Errorf("Got %v", p)
+	}
+}
+
+func TestParseParamsOmitsMissing(t *testing.T) {
+	p := ParseParams(
+		AxisParams,
+		func(string) string { return "" },
+		func(err *ParamError) { t.Error(err) })
+	if _, exists := p["min-run-time"]; exists {
+		t.Error("Missing parameter without a default was given a value")
+	}
+	if p.runTimeAxis() != NewLog2Axis(16) {
+		t.Errorf("Got axis %+v", p.runTimeAxis())
+	}
+	p["run-time-axis"] = "linear"
+	if p.runTimeAxis() != NewLinearAxis(16, 0, 0) {
+		t.Errorf("Got axis %+v", p.runTimeAxis())
+	}
+}
+
+func TestParseParamsRejectsNonFinite(t *testing.T) {
+	for _, value := range []string{"NaN", "Inf", "-Inf", "1e-320"} {
+		var rejected *ParamError
+		p := ParseParams(
+			AxisParams,
+			func(name string) string {
+				if name == "min-run-time" {
+					return value
+				}
+				return ""
+			},
+			func(err *ParamError) { rejected = err })
+		if rejected == nil {
+			rejected = checkAxis(p)
+		}
+		if rejected == nil || rejected.Name != "min-run-time" {
+			t.Errorf("Got %v for min-run-time %s", rejected, value)
+		}
+	}
+	for _, value := range []string{"NaN", "Inf"} {
+		param := Param{"n", "", FloatParam, "", nil, positive, ""}
+		if _, err := param.parse(value, 0); err == nil {
+			t.Errorf("Accepted %s", value)
+		}
+	}
+	if positive(math.NaN()) == nil || atLeast(0)(math.NaN()) == nil ||
+		between(0, 1)(math.NaN()) == nil {
+		t.Error("NaN passed a bounds check")
+	}
+}
+
+// Every registered visualizer should accept the defaults for all of its
+// parameters and every choice for each choice parameter.
+func TestVisualizerSpecs(t *testing.T) {
+	for _, name := range VisualizerNames() {
+		spec := LookupVisualizer(name)
+		for _, param := range spec.Params {
+			choices := append([]string{""}, param.Choices...)
+			for _, choice := range choices {
+				p := ParseParams(
+					spec.Params,
+					func(n string) string {
+						if n == param.Name {
+							return choice
+						}
+						return ""
+					},
+					func(err *ParamError) {
+						t.Errorf("%s: %v", name, err)
+					})
+				if spec.Check != nil {
+					if err := spec.Check(p); err != nil {
+						t.Errorf("%s: %v", name, err)
+					}
+				}
+				if spec.New(p) == nil {
+					t.Errorf("%s: no visualizer constructed", name)
+				}
+			}
+		}
+	}
+}
@@ -23,17 +23,31 @@ import (
 )
 
 type runTimeLine struct {
-	w         int     // Width of the visualization
-	h         int     // Height of the visualization
-	tA        float64 // Lower limit of time range to be visualized
-	tτ        float64 // Length of time range to be visualized
-	yLog2     float64 // Number of pixels over which elapsed times double
-	nS        []int   // Counts of successful events by x-axis position
-	nF        []int   // Counts of failed events by x-axis position
-	nA        []int   // Counts of active events by x-axis position
-	t         []int   // Sums of run-times of events by x-position
-	xGrid     int     // Number of vertical grid divisions
-	bg        int     // Background grey level
+	w     int         // Width of the visualization
+	h     int         // Height of the visualization
+	tA    int64       // Lower limit of time range to be visualized
+	tτ    float64     // Length of time range to be visualized
+	axis  RunTimeAxis // Mapping of run times to the y-axis
+	nS    []int       // Counts of successful events by x-axis position
+	nF    []int       // Counts of failed events by x-axis position
+	nA    []int       // Counts of active events by x-axis position
+	t     []float64   // Sums of run-times of events by x-position, in seconds
+	xGrid int         // Number of vertical grid divisions
+	bg    int         // Background grey level
+}
+
+func init() {
+	RegisterVisualizer(&VisualizerSpec{
+		"vis-run-time-line",
+		"Line graph of mean event run times over their start times.",
+		timeRangeParams(withAxis(XGridParam)...),
+		allChecks(CheckTimeRange, checkAxis, checkArea(maxArea)),
+		func(p Params) Visualizer {
+			return NewRunTimeLine(
+				p.Int("width"), p.Int("height"), p.Int("bg"),
+				p.Time("min-time"), p.Time("max-time"), p.runTimeAxis(),
+				p.Int("x-grid"))
+		}})
 }
 
 // NewRunTimeLine returns an line-graph event-run-time-visualization generator.
@@ -41,30 +55,30 @@ func NewRunTimeLine(
 	width int,
 	height int,
 	bg int,
-	minTime int,
-	maxTime int,
-	yLog2 float64,
+	minTime int64,
+	maxTime int64,
+	axis RunTimeAxis,
 	xGrid int) Visualizer {
 
 	return &runTimeLine{
 		width,
 		height,
-		float64(minTime),
+		minTime,
 		float64(maxTime - minTime),
-		yLog2,
-		make([]int, width),
+		axis.fitted(height),
 		make([]int, width),
 		make([]int, width),
 		make([]int, width),
+		make([]float64, width),
 		xGrid,
 		bg}
 }
 
-// Record accepts an EventData pointer and plots it onto the visualization.
-func (v *runTimeLine) Record(e *EventData) {
+// Record accepts an EventData64 pointer and plots it onto the visualization.
+func (v *runTimeLine) Record(e *EventData64) {
 
 	// Position on the x-axis corresponds to the event's start time.
-	x := int(float64(v.w) * (float64(e.Start) - v.tA) / v.tτ)
+	x := int(float64(v.w) * float64(e.Start-v.tA) / v.tτ)
 
 	// Update count and aggregate run-time values for appropriate x-position.
 	if e.Status == 0 {
@@ -74,7 +88,28 @@ func (v *runTimeLine) Record(e *EventData) {
 	} else {
 		v.nA[x]++
 	}
-	v.t[x] = v.t[x] + int(e.Run)
+	v.t[x] = v.t[x] + seconds(e.Run)
+}
+
+// Shard returns an empty event-run-time-visualization generator with the same
+// configuration, for recording a share of the events in parallel.
+func (v *runTimeLine) Shard() ShardedVisualizer {
+	shard := *v
+	shard.nS = make([]int, len(v.nS))
+	shard.nF = make([]int, len(v.nF))
+	shard.nA = make([]int, len(v.nA))
+	shard.t = make([]float64, len(v.t))
+	return &shard
+}
+
+// Merge folds the counts and run-time sums of a shard back into the
+// visualization.
+func (v *runTimeLine) Merge(shard ShardedVisualizer) {
+	o := shard.(*runTimeLine)
+	mergeInts(v.nS, o.nS)
+	mergeInts(v.nF, o.nF)
+	mergeInts(v.nA, o.nA)
+	mergeFloat64s(v.t, o.t)
 }
 
 // Render returns the visualization constructed from all previously-recorded
@@ -89,15 +124,20 @@ func (v *runTimeLine) Render() image.Image {
 	v.drawGrid(vis)
 
 	// Draw the lines.
+	var clips axisClips
 	xLast, yLast := 0, 0;
 	for x := 0; x < v.w; x++ {
 
-		// We only calculate logs on source time values which exceed 1 in order
-		// to put a floor value of zero on the output value.
-		y := 0
+		// Mean run times are floored at the origin of the run-time axis, which
+		// by default puts a floor value of zero on the output value for those
+		// which do not exceed 1, and pinned to its bounds if they are set.
 		n := v.nS[x] + v.nF[x] + v.nA[x]
-		this := float64(v.t[x])/math.Max(float64(n), 1)
-		if this > 1 { y = int(v.yLog2*math.Log2(this)) }
+		this := v.t[x]/math.Max(float64(n), 1)
+		yOffset, clip := v.axis.flooredOffset(this)
+		y := int(yOffset)
+		if n > 0 {
+			clips.count(clip)
+		}
 
 		// Color line according to relative quantities of completed, failed, and
 		// successful events recorded at during the time range corresponding to
@@ -139,20 +179,30 @@ func (v *runTimeLine) Render() image.Image {
 	}
 
 	// Flatline data from last data point out to end of graph, and make line
-	// dotted after real data has ceased to be available.
-	n := v.nS[xLast] + v.nF[xLast] + v.nA[xLast]
-	r := uint8(32 + 128 * v.nF[xLast] / n)
-	g := uint8(32 + 128 * v.nA[xLast] / n)
-	b := uint8(32 + 128 * v.nS[xLast] / n)
-	for x := xLast; x < v.w; x += 4 {
-		for yPos := yLast; yPos <= yLast + stroke; yPos++ {
-			c := getRGBA(vis, x, v.h-yPos)
-			c.R += r
-			c.G += g
-			c.B += b
+	// dotted after real data has ceased to be available. With no data at all,
+	// there is no line to draw.
+	if n := v.nS[xLast] + v.nF[xLast] + v.nA[xLast]; n > 0 {
+		r := uint8(32 + 128 * v.nF[xLast] / n)
+		g := uint8(32 + 128 * v.nA[xLast] / n)
+		b := uint8(32 + 128 * v.nS[xLast] / n)
+		for x := xLast; x < v.w; x += 4 {
+			for yPos := yLast; yPos <= yLast + stroke; yPos++ {
+				c := getRGBA(vis, x, v.h-yPos)
+				c.R += r
+				c.G += g
+				c.B += b
+			}
 		}
 	}
 
+	// Mark any bounds at which mean run times were clipped.
+	if clips.lo > 0 {
+		drawYClipLine(vis, v.h-1)
+	}
+	if clips.hi > 0 {
+		drawYClipLine(vis, 0)
+	}
+
 	return vis
 }
 
@@ -165,8 +215,9 @@ func (v *runTimeLine) drawGrid(vis *image.RGBA) {
 		}
 	}
 
-	// Draw horizontal grid lines on each doubling of the run time in seconds.
-	for y := float64(v.h); y > 0; y -= v.yLog2 {
+	// Draw horizontal grid lines on each step along the run-time axis.
+	step := v.axis.gridStep()
+	for y := float64(v.h); y > 0 && step >= minGridStep; y -= step {
 		drawYGridLine(vis, int(y))
 	}
 }
@@ -20,23 +20,39 @@ package perspective
 import (
 	"image"
 	"math"
-	"math/rand"
 )
 
 // Note that floating-point pre-rendering canvases have a two-pixel bleed on all
 // edges to allow for simple use of the bloom effect's convolution kernel.
 type scatter struct {
-	w     int       // Width of the visualization
-	h     int       // Height of the visualization
-	s     []float64 // Channel for successful events
-	f     []float64 // Channel for failed events
-	a     []float64 // Channel for active events
-	tA    float64   // Lower limit of time range to be visualized
-	tτ    float64   // Length of time range to be visualized
-	yLog2 float64   // Number of pixels over which elapsed times double
-	cΔ    float64   // Increment for color channel value increases
-	xGrid int       // Number of vertical grid divisions
-	bg    int       // Background gray level
+	w       int         // Width of the visualization
+	h       int         // Height of the visualization
+	s       []float64   // Channel for successful events
+	f       []float64   // Channel for failed events
+	a       []float64   // Channel for active events
+	tA      int64       // Lower limit of time range to be visualized
+	tτ      float64     // Length of time range to be visualized
+	axis    RunTimeAxis // Mapping of run times to the y-axis
+	clips   axisClips   // Counts of events clipped at run-time axis bounds
+	cΔ      float64     // Increment for color channel value increases
+	xGrid   int         // Number of vertical grid divisions
+	bg      int         // Background gray level
+	jitter  Jitter      // Mode for noise applied to run times
+	quantum float64     // Resolution of recorded run times, in seconds
+}
+
+func init() {
+	RegisterVisualizer(&VisualizerSpec{
+		"vis-scatter",
+		"Scatter plot of event run times over their start times.",
+		timeRangeParams(withAxis(ColorStepsParam, XGridParam, JitterParam)...),
+		allChecks(CheckTimeRange, checkAxis, checkArea(maxFloatArea)),
+		func(p Params) Visualizer {
+			return NewScatter(
+				p.Int("width"), p.Int("height"), p.Int("bg"),
+				p.Time("min-time"), p.Time("max-time"), p.runTimeAxis(),
+				p.Float("color-steps"), p.Int("x-grid"), p.jitter())
+		}})
 }
 
 // NewScatter returns a floating-point scatter-visualization generator.
@@ -44,11 +60,12 @@ func NewScatter(
 	width int,
 	height int,
 	bg int,
-	minTime int,
-	maxTime int,
-	yLog2 float64,
+	minTime int64,
+	maxTime int64,
+	axis RunTimeAxis,
 	colorSteps float64,
-	xGrid int) Visualizer {
+	xGrid int,
+	jitter Jitter) Visualizer {
 
 	return (&scatter{
 		width,
@@ -56,29 +73,46 @@ func NewScatter(
 		make([]float64, (width+4)*(height+4)),
 		make([]float64, (width+4)*(height+4)),
 		make([]float64, (width+4)*(height+4)),
-		float64(minTime),
+		minTime,
 		float64(maxTime - minTime),
-		float64(yLog2),
+		axis.fitted(height),
+		axisClips{},
 		saturated / colorSteps,
 		xGrid,
-		bg})
+		bg,
+		jitter,
+		1})
 }
 
-// Record accepts an EventData pointer and plots it onto the visualization.
-func (v *scatter) Record(e *EventData) {
-
-	// Apply a bit of random "noise" (on a Gaussian distribution, with a
-	// standard deviation of 0.5), to the time scale to avoid Moire patterns
-	// and quantization artifacts which could distract from real patterns or
-	// create a false sense of consistency in the run times of short-lived
-	// events.
-	t := float64(e.Run) + rand.NormFloat64() / 2
+// Record accepts an EventData64 pointer and plots it onto the visualization.
+func (v *scatter) Record(e *EventData64) {
+
+	// Apply a bit of "noise" (on a Gaussian distribution, with a standard
+	// deviation of half the resolution at which run times were measured), to
+	// the time scale to avoid Moire patterns and quantization artifacts which
+	// could distract from real patterns or create a false sense of consistency
+	// in the run times of short-lived events.
+	t := seconds(e.Run) + v.jitter.offset(e)*v.quantum
+
+	// Run times below the origin of an axis with no minimum set fall below
+	// the plot.
+	yOffset, clip := v.axis.offset(t)
+	if yOffset < 0 {
+		return
+	}
 
-	xP := int(float64(v.w) * (float64(e.Start) - v.tA) / v.tτ)
-	yP := v.h - int(v.yLog2*math.Log2(t))
+	xP := int(float64(v.w) * float64(e.Start-v.tA) / v.tτ)
+	yP := v.h - int(yOffset)
 
 	w, h := v.w, v.h
 
+	// Pin events clipped at the bounds of the run-time axis to the nearest row
+	// on which their convolved plot points will still fit within the canvas.
+	if clip != 0 {
+		yP = int(math.Max(2, math.Min(float64(h-4), float64(yP))))
+		v.clips.count(clip)
+	}
+
 	// Select appropriate canvas layer based on the event's status code.
 	var frame []float64
 	if e.Status == 0 {
@@ -106,6 +140,31 @@ func (v *scatter) Record(e *EventData) {
 	}
 }
 
+// Shard returns an empty scatter-visualization generator with the same
+// configuration, for recording a share of the events in parallel.
+func (v *scatter) Shard() ShardedVisualizer {
+	shard := *v
+	shard.s = make([]float64, len(v.s))
+	shard.f = make([]float64, len(v.f))
+	shard.a = make([]float64, len(v.a))
+	return &shard
+}
+
+// Merge folds the channels of a shard back into the visualization.
+func (v *scatter) Merge(shard ShardedVisualizer) {
+	o := shard.(*scatter)
+	mergeFloat64s(v.s, o.s)
+	mergeFloat64s(v.f, o.f)
+	mergeFloat64s(v.a, o.a)
+	v.clips.merge(&o.clips)
+}
+
+// SetResolution sets the resolution, in seconds, at which the run times of the
+// events to be recorded were measured, to scale the noise applied to them.
+func (v *scatter) SetResolution(quantum float64) {
+	v.quantum = quantum
+}
+
 // Render returns the visualization constructed from all previously-recorded
 // data points.
 func (v *scatter) Render() image.Image {
@@ -121,10 +180,18 @@ func (v *scatter) Render() image.Image {
 		}
 	}
 
-	// Draw horizontal grid lines on each doubling of the run time in seconds.
-	for y := float64(h); y > 0; y -= v.yLog2 {
+	// Draw horizontal grid lines on each step along the run-time axis, and mark
+	// any bounds at which events were clipped.
+	step := v.axis.gridStep()
+	for y := float64(h); y > 0 && step >= minGridStep; y -= step {
 		drawYGridLine(vis, int(y))
 	}
+	if v.clips.lo > 0 {
+		drawYClipLine(vis, h-1)
+	}
+	if v.clips.hi > 0 {
+		drawYClipLine(vis, 0)
+	}
 
 	// Render point data to final image.
 	s, f, a := v.s, v.f, v.a
@@ -0,0 +1,124 @@
+// Perspective: Graphing library for quality control in event-driven systems
+
+// Copyright (C) 2016 Christian Paro <christian.paro@gmail.com>,
+//                                   <cparo@digitalocean.com>
+
+// This program is free software: you can redistribute it and/or modify it under
+// the terms of the GNU General Public License version 2 as published by the
+// Free Software Foundation.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+
+// You should have received a copy of the GNU General Public License along with
+// this program. If not, see <http://www.gnu.org/licenses/>.
+
+package perspective
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Units of time accepted as suffixes for times and durations, with plural and
+// multi-letter units ahead of any units they end with so the longest matching
+// suffix is always the one found.
+var timeUnits = []struct {
+	suffix string
+	ns     int64
+}{
+	{"years", 31536000 * int64(time.Second)}, // Assume 365-day year
+	{"year", 31536000 * int64(time.Second)},
+	{"months", 2678400 * int64(time.Second)}, // Assume 31-day month
+	{"month", 2678400 * int64(time.Second)},
+	{"weeks", 604800 * int64(time.Second)},
+	{"week", 604800 * int64(time.Second)},
+	{"days", 86400 * int64(time.Second)},
+	{"day", 86400 * int64(time.Second)},
+	{"ms", int64(time.Millisecond)},
+	{"us", int64(time.Microsecond)},
+	{"µs", int64(time.Microsecond)},
+	{"ns", int64(time.Nanosecond)},
+	{"h", int64(time.Hour)},
+	{"m", int64(time.Minute)},
+	{"s", int64(time.Second)},
+}
+
+// ParseDuration parses a length of time, given as a (possibly fractional)
+// number with an optional unit suffix (years, months, weeks, days, h, m, s, ms,
+// us or ns) and defaulting to seconds, and returns it in nanoseconds.
+func ParseDuration(value string) (int64, error) {
+	unit := int64(time.Second)
+	number := value
+	for _, u := range timeUnits {
+		if strings.HasSuffix(value, u.suffix) {
+			number, unit = strings.TrimSuffix(value, u.suffix), u.ns
+			break
+		}
+	}
+	// Integer values are parsed exactly, to avoid any rounding errors in large
+	// values (like epoch times given in milliseconds).
+	if i, err := strconv.ParseInt(number, 10, 64); err == nil {
+		if i > math.MaxInt64/unit || i < math.MinInt64/unit {
+			return 0, fmt.Errorf("duration out of range: \"%s\"", value)
+		}
+		return i * unit, nil
+	}
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil || math.IsNaN(n) {
+		return 0, fmt.Errorf("malformed duration: \"%s\"", value)
+	}
+	if math.Abs(n*float64(unit)) >= math.MaxInt64 {
+		return 0, fmt.Errorf("duration out of range: \"%s\"", value)
+	}
+	return int64(math.Floor(n*float64(unit) + 0.5)), nil
+}
+
+// ParseTimeUnit parses the name of a unit of time (any of the unit suffixes
+// accepted by ParseDuration, like "s" or "ms") and returns its length in
+// nanoseconds.
+func ParseTimeUnit(unit string) (int64, error) {
+	ns, err := ParseDuration("1" + unit)
+	if err != nil || ns <= 0 {
+		return 0, fmt.Errorf("unrecognized time unit: \"%s\"", unit)
+	}
+	return ns, nil
+}
+
+// ParseTime parses a point in time and returns it in nanoseconds since the
+// beginning of the Unix epoch. Times may be given as a human-friendly timestamp
+// (like "2016-08-08 12:34:56.789 UTC"), as "now" for the given current time,
+// as a negative duration indicating an offset backward from the current time
+// (like "-1h" or "-250ms"), or as a duration since the beginning of the epoch
+// (so a plain integer is read as Unix epoch time in seconds, and
+// "1470659696789ms" as epoch milliseconds).
+func ParseTime(value string, now int64) (int64, error) {
+	if value == "now" {
+		return now, nil
+	}
+	// Attempt parsing the time as a human-friendly timestamp...
+	// Format is: "YYYY-MM-DD HH:MM:SS Z", with optional fractional seconds.
+	timeValue, err := time.Parse("2006-01-02 15:04:05 MST", value)
+	if err == nil {
+		return timeValue.UnixNano(), nil
+	}
+	// Check for leading "-" as indication of time offset backward from NOW()
+	// rather than forward from the beginning of the Unix epoch.
+	if strings.HasPrefix(value, "-") {
+		offset, err := ParseDuration(value)
+		if err != nil {
+			return 0, fmt.Errorf("malformed time: \"%s\"", value)
+		}
+		return now + offset, nil
+	}
+	t, err := ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("malformed time: \"%s\"", value)
+	}
+	return t, nil
+}
@@ -0,0 +1,80 @@
+// Perspective: Graphing library for quality control in event-driven systems
+
+// Copyright (C) 2016 Christian Paro <christian.paro@gmail.com>,
+//                                   <cparo@digitalocean.com>
+
+// This program is free software: you can redistribute it and/or modify it under
+// the terms of the GNU General Public License version 2 as published by the
+// Free Software Foundation.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+
+// You should have received a copy of the GNU General Public License along with
+// this program. If not, see <http://www.gnu.org/licenses/>.
+
+package perspective
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	cases := map[string]int64{
+		"90":       90 * int64(time.Second),
+		"1.5":      1500 * int64(time.Millisecond),
+		"250ms":    250 * int64(time.Millisecond),
+		"-250ms":   -250 * int64(time.Millisecond),
+		"3us":      3 * int64(time.Microsecond),
+		"3µs":      3 * int64(time.Microsecond),
+		"7ns":      7,
+		"2h":       2 * int64(time.Hour),
+		"15m":      15 * int64(time.Minute),
+		"1day":     86400 * int64(time.Second),
+		"2weeks":   1209600 * int64(time.Second),
+		"1year":    31536000 * int64(time.Second),
+		"0.5month": 1339200 * int64(time.Second),
+	}
+	for value, expected := range cases {
+		parsed, err := ParseDuration(value)
+		if err != nil {
+			t.Errorf("ParseDuration(%q) failed: %v", value, err)
+		} else if parsed != expected {
+			t.Errorf("ParseDuration(%q) = %d, expected %d",
+				value, parsed, expected)
+		}
+	}
+	for _, value := range []string{"", "s", "1x", "NaN", "1e300", "10000000000"} {
+		if _, err := ParseDuration(value); err == nil {
+			t.Errorf("ParseDuration(%q) should have failed", value)
+		}
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	now := 1470659696 * int64(time.Second)
+	cases := map[string]int64{
+		"1470659696":                  1470659696 * int64(time.Second),
+		"1470659696789ms":             1470659696789 * int64(time.Millisecond),
+		"now":                         now,
+		"-1h":                         now - int64(time.Hour),
+		"-250ms":                      now - 250*int64(time.Millisecond),
+		"2016-08-08 12:34:56 UTC":     1470659696 * int64(time.Second),
+		"2016-08-08 12:34:56.789 UTC": 1470659696789 * int64(time.Millisecond),
+	}
+	for value, expected := range cases {
+		parsed, err := ParseTime(value, now)
+		if err != nil {
+			t.Errorf("ParseTime(%q) failed: %v", value, err)
+		} else if parsed != expected {
+			t.Errorf("ParseTime(%q) = %d, expected %d",
+				value, parsed, expected)
+		}
+	}
+	if _, err := ParseTime("yesterday", now); err == nil {
+		t.Error("ParseTime(\"yesterday\") should have failed")
+	}
+}
@@ -0,0 +1,411 @@
+// Perspective: Graphing library for quality control in event-driven systems
+
+// Copyright (C) 2016 Christian Paro <christian.paro@gmail.com>,
+//                                   <cparo@digitalocean.com>
+
+// This program is free software: you can redistribute it and/or modify it under
+// the terms of the GNU General Public License version 2 as published by the
+// Free Software Foundation.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+
+// You should have received a copy of the GNU General Public License along with
+// this program. If not, see <http://www.gnu.org/licenses/>.
+
+package perspective
+
+import (
+	"bytes"
+	"flag"
+	"image"
+	"image/draw"
+	"image/png"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "Rewrite golden images.")
+
+const (
+	testStart  = 1400000000 // Start of synthetic event time range, in seconds.
+	testRange  = 86400      // Length of synthetic event time range, in seconds.
+	testEvents = 20000      // Number of synthetic events to generate.
+)
+
+// Bounds of the synthetic event time range, in nanoseconds.
+const (
+	testA = testStart * int64(time.Second)
+	testΩ = (testStart + testRange) * int64(time.Second)
+)
+
+// Generates a deterministic set of synthetic events for the given seed, spread
+// evenly over the test time range with exponentially distributed run times and
+// a daily cycle in failure rates, so visualizations have some structure to them.
+// Times are whole seconds, as they would be in a feed in the original format.
+func syntheticEvents(n int, seed int64) []EventData64 {
+	r := rand.New(rand.NewSource(seed))
+	events := make([]EventData64, n)
+	for i := range events {
+		start := testStart + i*testRange/n
+		status := int8(0)
+		if r.Intn(testRange) < start%testRange/4 {
+			status = int8(1 + r.Intn(3))
+		} else if r.Intn(20) == 0 {
+			status = -1
+		}
+		run := int64(r.ExpFloat64()*16 + r.Float64()*r.Float64()*120)
+		events[i] = EventData64{
+			ID:       int64(i),
+			Start:    int64(start) * int64(time.Second),
+			Run:      run * int64(time.Second),
+			Type:     uint8(r.Intn(4)),
+			Status:   status,
+			Region:   uint8(r.Intn(3)),
+			Progress: uint8(r.Intn(101))}
+	}
+	return events
+}
+
+// Generates events as syntheticEvents does, but with run times measured to the
+// millisecond, a good share of them under a second, as they would be in a feed
+// in the high-resolution format.
+func subSecondEvents(n int, seed int64) []EventData64 {
+	r := rand.New(rand.NewSource(seed))
+	events := syntheticEvents(n, seed)
+	for i := range events {
+		events[i].Run = int64(r.ExpFloat64()*2000) * int64(time.Millisecond)
+	}
+	return events
+}
+
+// Map of visualizer names to constructors for the generators covered by golden
+// image comparisons.
+var testVisualizers = map[string]func() Visualizer{
+	"calendar": func() Visualizer {
+		return NewCalendar(
+			256, 128, 32, testA, testΩ, CalendarDayHour, CalendarSuccessRate,
+			CountLinear, time.FixedZone("EST", -5*3600), true)
+	},
+	"cdf": func() Visualizer {
+		return NewCDF(256, 128, 32, NewLog2Axis(32), GroupStatus, false)
+	},
+	"cdf-region-survival": func() Visualizer {
+		return NewCDF(256, 128, 32, NewLog2Axis(32), GroupRegion, true)
+	},
+	"concurrency": func() Visualizer {
+		return NewConcurrency(256, 128, 32, testA, testΩ, GroupStatus, 4)
+	},
+	"concurrency-type": func() Visualizer {
+		return NewConcurrency(256, 128, 32, testA, testΩ, GroupType, 4)
+	},
+	"count-lines": func() Visualizer {
+		return NewCountLines(
+			256, 128, 32, testA, testΩ, 0.85, 4)
+	},
+	"gantt": func() Visualizer {
+		return NewGantt(
+			256, 128, 32, testA, testA+(testΩ-testA)/64, GroupType, 0, 4)
+	},
+	"gantt-truncated": func() Visualizer {
+		return NewGantt(
+			256, 128, 32, testA, testA+(testΩ-testA)/64, GroupRegion, 100, 4)
+	},
+	"heatmap": func() Visualizer {
+		return NewHeatmap(
+			256, 128, 32, testA, testΩ, NewLog2Axis(16), 64, 32, CountLinear,
+			4, false)
+	},
+	"heatmap-log-legend": func() Visualizer {
+		return NewHeatmap(
+			256, 128, 32, testA, testΩ, NewLinearAxis(0, 0, 60), 64, 32,
+			CountLog, 4, true)
+	},
+	"histogram": func() Visualizer {
+		return NewHistogram(256, 128, 32, NewLog2Axis(16), JitterSeeded)
+	},
+	"median-lines": func() Visualizer {
+		return NewMedianLines(
+			256, 128, 32, testA, testΩ, NewLog2Axis(16), 0.85, 4)
+	},
+	"polar-scatter": func() Visualizer {
+		return NewPolarScatter(
+			256, 256, 32, testA, testΩ, testA, testΩ-testA,
+			NewLog2Axis(16), 1, JitterSeeded)
+	},
+	"progress-stall": func() Visualizer {
+		return NewProgressStall(256, 128, 32, NewLog2Axis(16), 7200, 1)
+	},
+	"run-time-line": func() Visualizer {
+		return NewRunTimeLine(
+			256, 128, 32, testA, testΩ, NewLog2Axis(16), 4)
+	},
+	"scatter-linear": func() Visualizer {
+		return NewScatter(
+			256, 128, 32, testA, testΩ,
+			NewLinearAxis(0, 5, 60), 1, 4, JitterSeeded)
+	},
+	"scatter": func() Visualizer {
+		return NewScatter(
+			256, 128, 32, testA, testΩ, NewLog2Axis(16), 1, 4,
+			JitterSeeded)
+	},
+}
+
+// Map of visualizer names to constructors for the generators covered by golden
+// image comparisons over events with sub-second run times, all with the default
+// run-time axis, which should plot them as the original log2 mapping did.
+var subSecondVisualizers = map[string]func() Visualizer{
+	"cdf-subsecond": func() Visualizer {
+		return NewCDF(256, 128, 32, NewLog2Axis(32), GroupStatus, false)
+	},
+	"heatmap-subsecond": func() Visualizer {
+		return NewHeatmap(
+			256, 128, 32, testA, testΩ, NewLog2Axis(16), 64, 32, CountLinear,
+			4, false)
+	},
+	"histogram-subsecond": func() Visualizer {
+		return NewHistogram(256, 128, 32, NewLog2Axis(16), JitterSeeded)
+	},
+	"median-lines-subsecond": func() Visualizer {
+		return NewMedianLines(
+			256, 128, 32, testA, testΩ, NewLog2Axis(16), 0.85, 4)
+	},
+	"scatter-subsecond": func() Visualizer {
+		return NewScatter(
+			256, 128, 32, testA, testΩ, NewLog2Axis(16), 1, 4,
+			JitterSeeded)
+	},
+}
+
+// Returns the names of all visualizers covered by golden image comparisons.
+func goldenNames() []string {
+	var names []string
+	for name := range testVisualizers {
+		names = append(names, name)
+	}
+	for name := range subSecondVisualizers {
+		names = append(names, name)
+	}
+	return names
+}
+
+// Renders the named visualizer over the synthetic event set, or over the set
+// with sub-second run times for those covered with it.
+func renderTestVisualization(name string) *image.RGBA {
+	var v Visualizer
+	var events []EventData64
+	if constructor, exists := subSecondVisualizers[name]; exists {
+		v = constructor()
+		events = subSecondEvents(testEvents, 1)
+		if q, ok := v.(QuantizedVisualizer); ok {
+			q.SetResolution(0.001)
+		}
+	} else {
+		v = testVisualizers[name]()
+		events = syntheticEvents(testEvents, 1)
+	}
+	for i := range events {
+		v.Record(&events[i])
+	}
+	return toRGBA(v.Render())
+}
+
+func toRGBA(i image.Image) *image.RGBA {
+	if rgba, ok := i.(*image.RGBA); ok {
+		return rgba
+	}
+	rgba := image.NewRGBA(i.Bounds())
+	draw.Draw(rgba, rgba.Bounds(), i, i.Bounds().Min, draw.Src)
+	return rgba
+}
+
+func TestGoldenImages(t *testing.T) {
+	for _, name := range goldenNames() {
+		path := filepath.Join("testdata", name+".png")
+		rendered := renderTestVisualization(name)
+
+		if *update {
+			var buf bytes.Buffer
+			if err := png.Encode(&buf, rendered); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Errorf("%s: failed to read golden image: %v", name, err)
+			continue
+		}
+		golden, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Errorf("%s: failed to decode golden image: %v", name, err)
+			continue
+		}
+		expected := toRGBA(golden)
+		if !rendered.Bounds().Eq(expected.Bounds()) {
+			t.Errorf(
+				"%s: rendered bounds %v, expected %v",
+				name,
+				rendered.Bounds(),
+				expected.Bounds())
+			continue
+		}
+		if !bytes.Equal(rendered.Pix, expected.Pix) {
+			t.Errorf("%s: rendered image differs from golden image", name)
+		}
+	}
+}
+
+// Rendering the same events twice with seeded jitter should produce identical
+// images, or golden image comparisons would be meaningless.
+func TestRenderingIsDeterministic(t *testing.T) {
+	for _, name := range goldenNames() {
+		a := renderTestVisualization(name)
+		b := renderTestVisualization(name)
+		if !bytes.Equal(a.Pix, b.Pix) {
+			t.Errorf("%s: repeated renders differ", name)
+		}
+	}
+}
+
+// With the default run-time axis, sub-second run times are not clipped, so no
+// visualization should mark a bound at which they were.
+func TestDefaultAxisDoesNotClip(t *testing.T) {
+	for name := range subSecondVisualizers {
+		rendered := renderTestVisualization(name)
+		b := rendered.Bounds()
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				if rendered.RGBAAt(x, y) == clipColor {
+					t.Fatalf("%s: clip marker drawn at (%d, %d)", name, x, y)
+				}
+			}
+		}
+	}
+}
+
+// Every visualization should render promptly with no events recorded, rather
+// than scaling by a count of zero.
+func TestRenderEmpty(t *testing.T) {
+	for _, name := range goldenNames() {
+		constructor, exists := subSecondVisualizers[name]
+		if !exists {
+			constructor = testVisualizers[name]
+		}
+		done := make(chan struct{})
+		go func() {
+			constructor().Render()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: render with no events never finished", name)
+		}
+	}
+}
+
+// Visualizations which bin run times should drop those which cannot be mapped
+// onto their run-time axis rather than index out of their bins.
+func TestUnmappableRunTimes(t *testing.T) {
+	events := syntheticEvents(testEvents, 1)
+	for _, axis := range []RunTimeAxis{
+		NewLogAxis(16, 2, 1e-320, 0),
+		NewLinearAxis(math.NaN(), 0, 0)} {
+
+		for _, v := range []Visualizer{
+			NewHistogram(256, 128, 32, axis, JitterNone),
+			NewCDF(256, 128, 32, axis, GroupStatus, false)} {
+
+			for i := range events {
+				v.Record(&events[i])
+			}
+		}
+	}
+}
+
+func benchmarkVisualizer(b *testing.B, name string) {
+	events := syntheticEvents(testEvents, 1)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		v := testVisualizers[name]()
+		for i := range events {
+			v.Record(&events[i])
+		}
+		v.Render()
+	}
+}
+
+func BenchmarkCalendar(b *testing.B) {
+	benchmarkVisualizer(b, "calendar")
+}
+
+func BenchmarkConcurrency(b *testing.B) {
+	benchmarkVisualizer(b, "concurrency")
+}
+
+func BenchmarkCountLines(b *testing.B) {
+	benchmarkVisualizer(b, "count-lines")
+}
+
+func BenchmarkHeatmap(b *testing.B) {
+	benchmarkVisualizer(b, "heatmap")
+}
+
+func BenchmarkHistogram(b *testing.B) {
+	benchmarkVisualizer(b, "histogram")
+}
+
+func BenchmarkMedianLines(b *testing.B) {
+	benchmarkVisualizer(b, "median-lines")
+}
+
+func BenchmarkPolarScatter(b *testing.B) {
+	benchmarkVisualizer(b, "polar-scatter")
+}
+
+func BenchmarkRunTimeLine(b *testing.B) {
+	benchmarkVisualizer(b, "run-time-line")
+}
+
+func BenchmarkScatter(b *testing.B) {
+	benchmarkVisualizer(b, "scatter")
+}
+
+// Benchmarks for the pixel access method cited in getRGBA's comments, against
+// the image's own At() and Set() methods.
+func BenchmarkGetRGBA(b *testing.B) {
+	vis := initializeVisualization(256, 256, 32)
+	for i := 0; i < b.N; i++ {
+		for y := 0; y < 256; y++ {
+			for x := 0; x < 256; x++ {
+				c := getRGBA(vis, x, y)
+				c.R++
+			}
+		}
+	}
+}
+
+func BenchmarkAtSet(b *testing.B) {
+	vis := initializeVisualization(256, 256, 32)
+	for i := 0; i < b.N; i++ {
+		for y := 0; y < 256; y++ {
+			for x := 0; x < 256; x++ {
+				c := vis.RGBAAt(x, y)
+				c.R++
+				vis.SetRGBA(x, y, c)
+			}
+		}
+	}
+}
@@ -23,18 +23,34 @@ import (
 )
 
 type medianLines struct {
-	w         int       // Width of the visualization
-	h         int       // Height of the visualization
-	s         []float64 // Channel for successful events
-	f         []float64 // Channel for failed events
-	a         []float64 // Channel for active events
-	n         []float64 // Array for count of events on each x-coordinate slice
-	resonance float64   // Inverse of geometric decay for moving window
-	tA        float64   // Lower limit of time range to be visualized
-	tτ        float64   // Length of time range to be visualized
-	yLog2     float64   // Number of pixels over which elapsed times double
-	xGrid     int       // Number of vertical grid divisions
-	bg        int       // Background gray level
+	w         int         // Width of the visualization
+	h         int         // Height of the visualization
+	s         []float64   // Channel for successful events
+	f         []float64   // Channel for failed events
+	a         []float64   // Channel for active events
+	n         []float64   // Array for count of events on each x-coordinate slice
+	resonance float64     // Inverse of geometric decay for moving window
+	tA        int64       // Lower limit of time range to be visualized
+	tτ        float64     // Length of time range to be visualized
+	axis      RunTimeAxis // Mapping of run times to the y-axis
+	clips     axisClips   // Counts of events clipped at run-time axis bounds
+	xGrid     int         // Number of vertical grid divisions
+	bg        int         // Background gray level
+}
+
+func init() {
+	RegisterVisualizer(&VisualizerSpec{
+		"vis-median-lines",
+		"Smoothed lines of median run times of successful and failed " +
+			"events over their start times.",
+		timeRangeParams(withAxis(ResonanceParam, XGridParam)...),
+		allChecks(CheckTimeRange, checkAxis, checkArea(maxFloatArea)),
+		func(p Params) Visualizer {
+			return NewMedianLines(
+				p.Int("width"), p.Int("height"), p.Int("bg"),
+				p.Time("min-time"), p.Time("max-time"), p.runTimeAxis(),
+				p.Float("smoothing-resonance"), p.Int("x-grid"))
+		}})
 }
 
 // NewMedianLines returns a weighted-median-line visualization generator.
@@ -42,9 +58,9 @@ func NewMedianLines(
 	width int,
 	height int,
 	bg int,
-	minTime int,
-	maxTime int,
-	yLog2 float64,
+	minTime int64,
+	maxTime int64,
+	axis RunTimeAxis,
 	resonance float64,
 	xGrid int) Visualizer {
 
@@ -56,21 +72,36 @@ func NewMedianLines(
 		make([]float64, (width)*(height)),
 		make([]float64, (width)),
 		resonance,
-		float64(minTime),
+		minTime,
 		float64(maxTime - minTime),
-		float64(yLog2),
+		axis.fitted(height),
+		axisClips{},
 		xGrid,
 		bg})
 }
 
-// Record accepts an EventData pointer and plots it onto the visualization.
-func (v *medianLines) Record(e *EventData) {
+// Record accepts an EventData64 pointer and plots it onto the visualization.
+func (v *medianLines) Record(e *EventData64) {
+
+	// Run times below the origin of an axis with no minimum set fall below
+	// the plot.
+	yOffset, clip := v.axis.offset(seconds(e.Run))
+	if yOffset < 0 {
+		return
+	}
 
-	x := int(float64(v.w) * (float64(e.Start) - v.tA) / v.tτ)
-	y := v.h - int(v.yLog2*math.Log2(float64(e.Run)))
+	x := int(float64(v.w) * float64(e.Start-v.tA) / v.tτ)
+	y := v.h - int(yOffset)
 
 	w, h := v.w, v.h
 
+	// Pin events clipped at the bounds of the run-time axis to the outermost
+	// rows of the canvas.
+	if clip != 0 && e.Status == 0 {
+		y = int(math.Max(0, math.Min(float64(h-1), float64(y))))
+		v.clips.count(clip)
+	}
+
 	// Only look at successfully-completed events
 	var frame []float64
 	if e.Status == 0 {
@@ -82,6 +113,28 @@ func (v *medianLines) Record(e *EventData) {
 	}
 }
 
+// Shard returns an empty weighted-median-line visualization generator with the
+// same configuration, for recording a share of the events in parallel.
+func (v *medianLines) Shard() ShardedVisualizer {
+	shard := *v
+	shard.s = make([]float64, len(v.s))
+	shard.f = make([]float64, len(v.f))
+	shard.a = make([]float64, len(v.a))
+	shard.n = make([]float64, len(v.n))
+	return &shard
+}
+
+// Merge folds the density grids and column counts of a shard back into the
+// visualization.
+func (v *medianLines) Merge(shard ShardedVisualizer) {
+	o := shard.(*medianLines)
+	mergeFloat64s(v.s, o.s)
+	mergeFloat64s(v.f, o.f)
+	mergeFloat64s(v.a, o.a)
+	mergeFloat64s(v.n, o.n)
+	v.clips.merge(&o.clips)
+}
+
 // Render returns the visualization constructed from all previously-recorded
 // data points.
 func (v *medianLines) Render() image.Image {
@@ -97,10 +150,18 @@ func (v *medianLines) Render() image.Image {
 		}
 	}
 
-	// Draw horizontal grid lines on each doubling of the run time in seconds.
-	for y := float64(h); y > 0; y -= v.yLog2 {
+	// Draw horizontal grid lines on each step along the run-time axis, and mark
+	// any bounds at which events were clipped.
+	step := v.axis.gridStep()
+	for y := float64(h); y > 0 && step >= minGridStep; y -= step {
 		drawYGridLine(vis, int(y))
 	}
+	if v.clips.lo > 0 {
+		drawYClipLine(vis, h-1)
+	}
+	if v.clips.hi > 0 {
+		drawYClipLine(vis, 0)
+	}
 
 	// Find window for smoothing filter.
 	window := 0